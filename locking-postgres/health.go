@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"sync/atomic"
+)
+
+// state tracks the progress of Handle, for the benefit of health checks
+type state struct {
+	running   atomic.Bool
+	stopped   atomic.Bool
+	leader    atomic.Bool
+	listening atomic.Bool
+}
+
+// Health reports on the state of this Input, and is compatible with the
+// HealthChecker interface from github.com/dapper-data/dapper-orchestrator-contrib/webhooks
+// which means it can be passed to that package's liveness and readiness handlers.
+//
+// An Input is live until Handle returns (and again should Handle be called
+// anew), and ready while Handle is running; whether or not this replica is the one holding the lock, and so the one
+// emitting Events, is reported in the detail as "leader"
+func (p Postgres) Health() (live, ready bool, detail map[string]any) {
+	running := p.state.running.Load()
+	stopped := p.state.stopped.Load()
+
+	return !stopped, running && !stopped, map[string]any{
+		"running":   running,
+		"leader":    p.state.leader.Load(),
+		"listening": p.state.listening.Load(),
+	}
+}
+
+func (p Postgres) started() {
+	p.state.running.Store(true)
+	p.state.stopped.Store(false)
+}
+
+func (p Postgres) stopped() {
+	p.state.stopped.Store(true)
+	p.state.leader.Store(false)
+	p.state.listening.Store(false)
+}
@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"testing"
+)
+
+func TestPostgres_Health(t *testing.T) {
+	p := Postgres{state: new(state)}
+
+	for _, test := range []struct {
+		name         string
+		setup        func()
+		expectLive   bool
+		expectReady  bool
+		expectLeader bool
+	}{
+		{"unstarted", func() {}, true, false, false},
+		{"waiting on lock", func() { p.state.running.Store(true) }, true, true, false},
+		{"holding lock", func() { p.state.leader.Store(true) }, true, true, true},
+		{"stopped", p.stopped, false, false, false},
+		{"restarted", p.started, true, true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.setup()
+
+			live, ready, detail := p.Health()
+			if live != test.expectLive {
+				t.Errorf("expected live %v, received %v", test.expectLive, live)
+			}
+
+			if ready != test.expectReady {
+				t.Errorf("expected ready %v, received %v", test.expectReady, ready)
+			}
+
+			if detail["leader"] != test.expectLeader {
+				t.Errorf("expected leader %v, received %v", test.expectLeader, detail["leader"])
+			}
+		})
+	}
+}
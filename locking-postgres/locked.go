@@ -0,0 +1,158 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// healthChecker is satisfied by Inputs which report their health, such as
+// those in github.com/dapper-data/dapper-orchestrator-contrib/webhooks
+type healthChecker interface {
+	Health() (live, ready bool, detail map[string]any)
+}
+
+// LockedInput wraps an orchestrator.Input such that, of all the replicas
+// running it, only the one holding a Locker's lock is handling at once.
+//
+// The wrapped Input must return from Handle once its context is cancelled,
+// and must support Handle being called again afterwards, since that is how
+// a replica is stood down when it loses the lock, and started again should
+// it regain it. An Input whose Handle ignores its context keeps handling
+// after the lock has passed elsewhere. The Inputs in
+// github.com/dapper-data/dapper-orchestrator-contrib/webhooks, and the
+// Postgres Input in this package, all behave this way
+type LockedInput struct {
+	orchestrator.Input
+
+	locker *Locker
+	state  *state
+}
+
+// LockInput wraps in such that its Handle function is only called while
+// holding l's lock
+func LockInput(in orchestrator.Input, l *Locker) LockedInput {
+	return LockedInput{
+		Input:  in,
+		locker: l,
+		state:  new(state),
+	}
+}
+
+// Handle implements the Handle function of the orchestrator.Input interface
+//
+// It blocks until the lock is acquired, and then calls the Handle function
+// of the wrapped Input with a context which is cancelled should the lock
+// be lost, in which case the lock is campaigned for again. The wrapped
+// Input can retrieve the Lease it is running under via LeaseFromContext
+func (i LockedInput) Handle(ctx context.Context, c chan orchestrator.Event) (err error) {
+	i.state.running.Store(true)
+	i.state.stopped.Store(false)
+
+	defer i.state.stopped.Store(true)
+
+	for {
+		var lease *Lease
+
+		lease, err = i.locker.Acquire(ctx)
+		if err != nil {
+			return
+		}
+
+		i.state.leader.Store(true)
+
+		lctx, cancel := lease.Context(ctx)
+		err = i.Input.Handle(lctx, c)
+		cancel()
+
+		i.state.leader.Store(false)
+
+		select {
+		case <-lease.Lost():
+			lease.Release()
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+		default:
+			lease.Release()
+
+			return
+		}
+	}
+}
+
+// Health reports on the health of the wrapped Input, where it does so,
+// adding whether or not this replica holds the lock as "leader".
+//
+// Replicas waiting on the lock are ready, as far as this function is
+// concerned, regardless of the wrapped Input
+func (i LockedInput) Health() (live, ready bool, detail map[string]any) {
+	live = !i.state.stopped.Load()
+	ready = live && i.state.running.Load()
+	detail = make(map[string]any)
+
+	leader := i.state.leader.Load()
+
+	if hc, ok := i.Input.(healthChecker); ok && leader {
+		live, ready, detail = hc.Health()
+	}
+
+	detail["leader"] = leader
+
+	return
+}
+
+// LockedProcess wraps an orchestrator.Process such that, of all the
+// replicas running it, only one is running at once
+type LockedProcess struct {
+	orchestrator.Process
+
+	locker *Locker
+}
+
+// LockProcess wraps p such that its Run function is only called while
+// holding l's lock
+func LockProcess(p orchestrator.Process, l *Locker) LockedProcess {
+	return LockedProcess{
+		Process: p,
+		locker:  l,
+	}
+}
+
+// Run implements the Run function of the orchestrator.Process interface
+//
+// Where another replica holds the lock, Run returns immediately with the
+// status ProcessUnstarted, rather than waiting; this makes LockedProcess
+// suitable for work which each replica triggers, but which only needs to
+// happen once, such as scheduled jobs.
+//
+// Otherwise the wrapped Process is run with a context which is cancelled
+// should the lock be lost, and from which the Lease it runs under can be
+// retrieved via LeaseFromContext
+func (p LockedProcess) Run(ctx context.Context, e orchestrator.Event) (ps orchestrator.ProcessStatus, err error) {
+	lease, err := p.locker.TryAcquire(ctx)
+	if errors.As(err, new(LockHeldErr)) {
+		return orchestrator.ProcessStatus{
+			Name:   p.ID(),
+			Logs:   []string{err.Error()},
+			Status: orchestrator.ProcessUnstarted,
+		}, nil
+	}
+
+	if err != nil {
+		return orchestrator.ProcessStatus{
+			Name:   p.ID(),
+			Status: orchestrator.ProcessUnstarted,
+		}, err
+	}
+
+	defer lease.Release()
+
+	lctx, cancel := lease.Context(ctx)
+	defer cancel()
+
+	return p.Process.Run(lctx, e)
+}
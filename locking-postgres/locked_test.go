@@ -0,0 +1,194 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+type dummyInput struct {
+	handled chan *Lease
+}
+
+func (d dummyInput) ID() string { return "dummy" }
+
+func (d dummyInput) Handle(ctx context.Context, _ chan orchestrator.Event) error {
+	lease, _ := LeaseFromContext(ctx)
+	d.handled <- lease
+
+	<-ctx.Done()
+
+	return ctx.Err()
+}
+
+func (d dummyInput) Health() (bool, bool, map[string]any) {
+	return true, false, map[string]any{"dummy": true}
+}
+
+type dummyProcess struct {
+	ran chan *Lease
+}
+
+func (d dummyProcess) ID() string { return "dummy" }
+
+func (d dummyProcess) Run(ctx context.Context, _ orchestrator.Event) (orchestrator.ProcessStatus, error) {
+	lease, _ := LeaseFromContext(ctx)
+	d.ran <- lease
+
+	return orchestrator.ProcessStatus{Name: d.ID(), Status: orchestrator.ProcessSuccess}, nil
+}
+
+func TestLockedInput_Health(t *testing.T) {
+	i := LockInput(dummyInput{}, nil)
+
+	for _, test := range []struct {
+		name         string
+		setup        func()
+		expectReady  bool
+		expectLeader bool
+		expectDummy  bool
+	}{
+		{"unstarted", func() {}, false, false, false},
+		{"waiting on lock", func() { i.state.running.Store(true) }, true, false, false},
+		{"holding lock", func() { i.state.leader.Store(true) }, false, true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.setup()
+
+			_, ready, detail := i.Health()
+			if ready != test.expectReady {
+				t.Errorf("expected ready %v, received %v", test.expectReady, ready)
+			}
+
+			if detail["leader"] != test.expectLeader {
+				t.Errorf("expected leader %v, received %v", test.expectLeader, detail["leader"])
+			}
+
+			if _, ok := detail["dummy"]; ok != test.expectDummy {
+				t.Errorf("expected wrapped detail %v, received %v", test.expectDummy, detail)
+			}
+		})
+	}
+}
+
+func TestLockedInput_Handle(t *testing.T) {
+	db := testDB(t)
+
+	l := NewLocker(db.DB, "test_locked_input", WithLockTable("test_locks"))
+	handled := make(chan *Lease, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- LockInput(dummyInput{handled}, l).Handle(ctx, nil)
+		}()
+	}
+
+	if lease := <-handled; lease == nil {
+		t.Error("expected input to be handed its lease")
+	}
+
+	select {
+	case <-handled:
+		t.Error("expected only one input to handle at once")
+
+	case <-time.After(time.Second):
+	}
+
+	cancel()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != context.Canceled {
+			t.Errorf("expected %v, received %v", context.Canceled, err)
+		}
+	}
+}
+
+func TestLockedProcess_Run(t *testing.T) {
+	db := testDB(t)
+
+	l := NewLocker(db.DB, "test_locked_process", WithLockTable("test_locks"))
+	ran := make(chan *Lease, 1)
+	p := LockProcess(dummyProcess{ran}, l)
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ps.Status != orchestrator.ProcessSuccess || <-ran == nil {
+		t.Errorf("expected process to run with its lease, received %#v", ps)
+	}
+
+	t.Run("lock held elsewhere", func(t *testing.T) {
+		lease, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer lease.Release()
+
+		ps, err := p.Run(context.Background(), orchestrator.Event{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ps.Status != orchestrator.ProcessUnstarted {
+			t.Errorf("expected %v, received %v", orchestrator.ProcessUnstarted, ps.Status)
+		}
+
+		select {
+		case <-ran:
+			t.Error("expected process not to run")
+
+		default:
+		}
+	})
+}
+
+func TestLockedInput_Handle_Restart(t *testing.T) {
+	db := testDB(t)
+
+	l := NewLocker(db.DB, "test_locked_input_restart", WithLockTable("test_locks"))
+	i := LockInput(dummyInput{make(chan *Lease, 1)}, l)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	i.Handle(ctx, nil)
+
+	if live, _, _ := i.Health(); live {
+		t.Fatal("expected input not to be live once Handle returns")
+	}
+
+	// Hold the lock, so that the second call to Handle waits on it
+	lease, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer lease.Release()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	go i.Handle(ctx, nil)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		live, ready, _ := i.Health()
+		if live && ready {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected input to be live and ready once Handle is called again, received %v, %v", live, ready)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
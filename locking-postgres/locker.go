@@ -0,0 +1,347 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// LockHeldErr is returned by Locker.TryAcquire when the lock is held
+// elsewhere
+type LockHeldErr struct {
+	name string
+}
+
+// Error returns the error text for this error
+func (e LockHeldErr) Error() string {
+	return fmt.Sprintf("lock %s is held elsewhere", e.name)
+}
+
+// Locker provides a lock, held by at most one process at a time across
+// any number of replicas sharing a database, which can be used to ensure
+// only a single replica of an Input or Process is active at once.
+//
+// Locks are session level advisory locks, held on a connection dedicated
+// to that purpose. Postgres releases these as soon as the session holding
+// them ends, so where a holder dies, or loses its connection, the next
+// replica waiting on the lock takes over without any cleanup.
+//
+// Each time the lock is acquired, a fencing token is incremented in the
+// lock table, and made available via Lease.Token, so that anything acting
+// on behalf of a lock holder can refuse work from a holder which has since
+// been superseded
+type Locker struct {
+	db   *sql.DB
+	name string
+	key  int64
+	opts options
+
+	mu      sync.Mutex
+	ensured bool
+}
+
+// NewLocker returns a Locker for the lock called name, in the database
+// db. Lockers sharing a name, and a database, share a lock
+func NewLocker(db *sql.DB, name string, opts ...Option) *Locker {
+	return &Locker{
+		db:   db,
+		name: name,
+		key:  lockKey(name),
+		opts: defaultOptions(opts),
+	}
+}
+
+// lockKey derives the advisory lock key for a name
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	return int64(h.Sum64())
+}
+
+// Name returns the name of the lock this Locker acquires
+func (l *Locker) Name() string {
+	return l.name
+}
+
+// Acquire blocks until the lock is acquired, or ctx is done, retrying
+// where the database can't be reached.
+//
+// The returned Lease must be released once finished with, whether or
+// not it has since been lost
+func (l *Locker) Acquire(ctx context.Context) (lease *Lease, err error) {
+	for {
+		lease, err = l.acquire(ctx, "SELECT true FROM pg_advisory_lock($1)")
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		// The database has gone away, or our connection to it
+		// has; wait a little before trying again
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-time.After(l.opts.retryWait):
+		}
+	}
+}
+
+// TryAcquire acquires the lock where it is free, returning a LockHeldErr
+// without waiting where it is not
+func (l *Locker) TryAcquire(ctx context.Context) (lease *Lease, err error) {
+	return l.acquire(ctx, "SELECT pg_try_advisory_lock($1)")
+}
+
+func (l *Locker) acquire(ctx context.Context, query string) (lease *Lease, err error) {
+	err = l.ensureTable(ctx)
+	if err != nil {
+		return
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return
+	}
+
+	// Have the server end our session, and so release the lock, should
+	// we go quiet for longer than our lease. The setting only exists from
+	// postgres 14, hence selecting it from pg_settings rather than
+	// setting it outright
+	_, err = conn.ExecContext(ctx, "SELECT set_config(name, $1, false) FROM pg_settings WHERE name = 'idle_session_timeout'", l.opts.lease.Milliseconds())
+	if err != nil {
+		discard(conn)
+
+		return
+	}
+
+	// pg_advisory_lock blocks until whichever replica currently holds
+	// the lock lets it go, or its session ends
+	var acquired bool
+
+	err = conn.QueryRowContext(ctx, query, l.key).Scan(&acquired)
+	if err != nil {
+		discard(conn)
+
+		return
+	}
+
+	if !acquired {
+		discard(conn)
+
+		return nil, LockHeldErr{l.name}
+	}
+
+	lease = &Lease{
+		locker: l,
+		conn:   conn,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	err = conn.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %[1]s (resource, name, token) VALUES ($1, $2, 1)
+ON CONFLICT (resource) DO UPDATE SET name = EXCLUDED.name, token = %[1]s.token + 1
+RETURNING token`, l.opts.table), l.key, l.name).Scan(&lease.token)
+	if err != nil {
+		discard(conn)
+
+		return nil, err
+	}
+
+	if l.opts.elected != nil {
+		l.opts.elected()
+	}
+
+	go lease.renew()
+
+	return
+}
+
+// ensureTable creates the lock table, should it not exist, and brings lock
+// tables created by earlier versions of this package up to date
+func (l *Locker) ensureTable(ctx context.Context) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ensured {
+		return
+	}
+
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	defer tx.Rollback()
+
+	// Replicas starting together would otherwise race to create the
+	// table
+	_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", lockKey(l.opts.table))
+	if err != nil {
+		return
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %[1]s (resource bigint primary key, name text, token bigint NOT NULL DEFAULT 0);
+ALTER TABLE %[1]s ALTER COLUMN resource TYPE bigint, ADD COLUMN IF NOT EXISTS name text, ADD COLUMN IF NOT EXISTS token bigint NOT NULL DEFAULT 0;`, l.opts.table))
+	if err != nil {
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	l.ensured = true
+
+	return
+}
+
+// leaseKey holds the Lease a context was derived from
+type leaseKey struct{}
+
+// LeaseFromContext returns the Lease held while ctx, as returned by
+// Lease.Context, was derived, if any
+func LeaseFromContext(ctx context.Context) (lease *Lease, ok bool) {
+	lease, ok = ctx.Value(leaseKey{}).(*Lease)
+
+	return
+}
+
+// Lease is a held lock, as returned by a Locker, which is renewed in the
+// background until it is released or lost
+type Lease struct {
+	locker *Locker
+	conn   *sql.Conn
+	token  int64
+
+	stop    chan struct{}
+	done    chan struct{}
+	release sync.Once
+}
+
+// Token returns the fencing token for this Lease, which is greater than
+// that of any Lease previously acquired from a Locker of the same name
+func (l *Lease) Token() int64 {
+	return l.token
+}
+
+// Lost returns a channel which is closed once this Lease can no longer be
+// relied upon, either because it couldn't be renewed before it expired,
+// or because it has been released
+func (l *Lease) Lost() <-chan struct{} {
+	return l.done
+}
+
+// Context returns a copy of parent which is cancelled should this Lease
+// be lost, and from which this Lease is available via LeaseFromContext
+func (l *Lease) Context(parent context.Context) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, cancel = context.WithCancel(context.WithValue(parent, leaseKey{}, l))
+
+	go func() {
+		select {
+		case <-l.done:
+			cancel()
+
+		case <-ctx.Done():
+		}
+	}()
+
+	return
+}
+
+// Release gives up this Lease, calling the OnDemoted callback of the
+// Locker it was acquired from. It is safe to call more than once
+func (l *Lease) Release() {
+	l.release.Do(l.unlock)
+}
+
+func (l *Lease) unlock() {
+	close(l.stop)
+	<-l.done
+
+	// Unlock explicitly so that the next holder needn't wait on the
+	// session ending; the connection is discarded rather than returned
+	// to the pool regardless, in case unlocking failed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.locker.key)
+	cancel()
+
+	discard(l.conn)
+
+	if l.locker.opts.demoted != nil {
+		l.locker.opts.demoted()
+	}
+}
+
+// renew checks in with the database a few times per lease, closing done
+// where it can't do so before the lease runs out
+func (l *Lease) renew() {
+	defer close(l.done)
+
+	lease := l.locker.opts.lease
+
+	t := time.NewTicker(lease / 3)
+	defer t.Stop()
+
+	expires := time.NewTimer(lease)
+	defer expires.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+
+		case <-expires.C:
+			return
+
+		case <-t.C:
+		}
+
+		// The lease is extended from before the renewal is sent, so
+		// that we always give up the lock before the server ends our
+		// session and hands it to someone else.
+		//
+		// A connection to a database which has gone away can block
+		// well beyond any context deadline, hence waiting on the
+		// renewal alongside the lease expiring
+		start := time.Now()
+		renewed := make(chan error, 1)
+
+		go func() {
+			renewed <- l.conn.PingContext(context.Background())
+		}()
+
+		select {
+		case <-l.stop:
+			return
+
+		case <-expires.C:
+			return
+
+		case err := <-renewed:
+			if err != nil {
+				return
+			}
+		}
+
+		if !expires.Stop() {
+			// Renewed just as the lease ran out
+			return
+		}
+
+		expires.Reset(lease - time.Since(start))
+	}
+}
+
+// discard closes conn, rather than returning it to the connection pool,
+// ensuring any session state such as advisory locks goes with it
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+}
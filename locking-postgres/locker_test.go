@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestDefaultOptions(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		opts   []Option
+		expect time.Duration
+	}{
+		{"default", nil, DefaultLeaseDuration},
+		{"configured", []Option{WithLeaseDuration(time.Minute)}, time.Minute},
+		{"invalid", []Option{WithLeaseDuration(-time.Minute)}, DefaultLeaseDuration},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o := defaultOptions(test.opts)
+			if o.lease != test.expect {
+				t.Errorf("expected %v, received %v", test.expect, o.lease)
+			}
+		})
+	}
+}
+
+func TestPostgres_lockerOptions(t *testing.T) {
+	var p Postgres
+	p.config.Name = "tests"
+
+	for _, test := range []struct {
+		name   string
+		opts   []Option
+		expect string
+	}{
+		{"default", nil, "lock_postgres_input_tests"},
+		{"other options", []Option{WithLeaseDuration(time.Minute)}, "lock_postgres_input_tests"},
+		{"configured", []Option{WithLockTable("shared_locks")}, "shared_locks"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if received := defaultOptions(p.lockerOptions(test.opts)).table; received != test.expect {
+				t.Errorf("expected %q, received %q", test.expect, received)
+			}
+		})
+	}
+}
+
+func TestLockKey(t *testing.T) {
+	if lockKey("a") != lockKey("a") {
+		t.Error("expected lock keys to be stable")
+	}
+
+	if lockKey("a") == lockKey("b") {
+		t.Error("expected lock keys to differ by name")
+	}
+}
+
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_CONN_STRING")
+	if dsn == "" {
+		t.Skip("TEST_DB_CONN_STRING not set")
+	}
+
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestLocker(t *testing.T) {
+	db := testDB(t)
+
+	var elected, demoted atomic.Int32
+
+	opts := []Option{
+		WithLeaseDuration(time.Second),
+		WithLockTable("test_locks"),
+		OnElected(func() { elected.Add(1) }),
+		OnDemoted(func() { demoted.Add(1) }),
+	}
+
+	first := NewLocker(db.DB, "test_locker", opts...)
+	second := NewLocker(db.DB, "test_locker", opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	held, err := first.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = second.TryAcquire(ctx)
+	if !errors.As(err, new(LockHeldErr)) {
+		t.Fatalf("expected error of type %T, received %#v", LockHeldErr{}, err)
+	}
+
+	type result struct {
+		lease *Lease
+		err   error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		var r result
+
+		r.lease, r.err = second.Acquire(ctx)
+		results <- r
+	}()
+
+	// The second locker must wait until the first lets go
+	select {
+	case <-results:
+		t.Fatal("expected second locker to wait on the first")
+
+	case <-time.After(2 * time.Second):
+	}
+
+	held.Release()
+	held.Release()
+
+	r := <-results
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	if r.lease.Token() <= held.Token() {
+		t.Errorf("expected token to increase from %d, received %d", held.Token(), r.lease.Token())
+	}
+
+	if elected.Load() != 2 || demoted.Load() != 1 {
+		t.Errorf("expected 2 acquisitions and 1 release, received %d and %d", elected.Load(), demoted.Load())
+	}
+
+	t.Run("session ends", func(t *testing.T) {
+		lctx, lcancel := r.lease.Context(ctx)
+		defer lcancel()
+
+		if l, ok := LeaseFromContext(lctx); !ok || l != r.lease {
+			t.Errorf("expected context to carry lease")
+		}
+
+		_, err := db.Exec("SELECT pg_terminate_backend(pid) FROM pg_locks WHERE locktype = 'advisory' AND pid != pg_backend_pid() AND ((classid::bigint << 32) | objid::bigint) = $1", second.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case <-lctx.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected lease to be lost")
+		}
+
+		r.lease.Release()
+
+		// And, with the lock released by postgres, the first
+		// locker can take over
+		lease, err := first.TryAcquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lease.Release()
+	})
+}
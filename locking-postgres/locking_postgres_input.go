@@ -20,21 +20,29 @@ import (
 // 2. The New function can be used as an orchestrator.NewInputFunc, which opens up a world of building pipelines on the fly
 //
 // This PostgresInput is the 'locking postgres input', in the sense that while many replicas of a pipeline
-// orchestrator may run at once, when this input connects to database for the first time it uses an internal
-// database table to provide a locking mechanism, which ensures only one Input is listening to database
-// operations at once.
+// orchestrator may run at once, each replica campaigns for leadership using a postgres advisory lock, which
+// ensures only one Input is listening to database operations at once. Should the leader die, or lose its
+// connection to the database, postgres releases the lock and another replica takes over.
 //
 // This Input can be used in place of the sample PostgresInput from the dapper-orchestrator package; it
 // has the same configuration and provides the same knobs to twiddle.
+//
+// By default triggers are created on every table in the public schema; other schemas and tables
+// can be selected, by name or glob, with WithTables and WithoutTables.
 type Postgres struct {
 	conn          *sqlx.DB
+	operations    map[orchestrator.Operation]string
+	tables        tableSelection
 	listener      *pq.Listener
 	config        orchestrator.InputConfig
 	listenerErrs  chan error
 	lockTableName string
+	state         *state
+	locker        *Locker
 }
 
 type postgresTriggerResult struct {
+	Schema    string                 `json:"schema"`
 	Table     string                 `json:"tbl"`
 	ID        any                    `json:"id"`
 	Operation orchestrator.Operation `json:"op"`
@@ -46,18 +54,44 @@ type postgresTriggerResult struct {
 // The InputConfig.ConnectionString argument can be a DSN, or a postgres
 // URL.
 //
+// Triggers are only created for the InputConfig.Operations passed, or for creates,
+// updates, and deletes where none are, and only on the tables selected with WithTables
+// and WithoutTables, or every table in the public schema where none are. Events carry
+// the schema qualified name of the table they came from, such as "public.orders", as
+// their Location.
+//
 // This function will error on:
 // 1. Invalid postgres connection strings
 // 2. Connection errors to postgres
 // 3. Errors creating a listener for database operations
+// 4. Operations which postgres can't trigger on, such as reads
+// 5. Malformed table patterns
 //
 // This function, somewhat permissively, has a 500ms timeout to postgres, which should
 // cover off all but the most slow networks, while at the same time not slowing execution
 // down too much _on_ those slow connections
-func New(ic orchestrator.InputConfig) (p Postgres, err error) {
+//
+// Leader election can be tuned, and observed, by passing Options such as WithLeaseDuration
+// and OnElected to WithLockerOptions
+func New(ic orchestrator.InputConfig, opts ...InputOption) (p Postgres, err error) {
 	p.config = ic
-	p.lockTableName = p.deriveLockTableName()
+
+	p.operations, err = triggerOperations(ic.Operations)
+	if err != nil {
+		return
+	}
+
+	o := defaultInputOptions(opts)
+
+	p.tables, err = newTableSelection(o.tables, o.excludedTables)
+	if err != nil {
+		return
+	}
+
+	lockerOpts := p.lockerOptions(o.locker)
+	p.lockTableName = defaultOptions(lockerOpts).table
 	p.listenerErrs = make(chan error)
+	p.state = new(state)
 
 	url := ic.ConnectionString
 	if strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
@@ -75,6 +109,8 @@ func New(ic orchestrator.InputConfig) (p Postgres, err error) {
 		return
 	}
 
+	p.locker = NewLocker(p.conn.DB, p.deriveLockTableName(), lockerOpts...)
+
 	p.listener = pq.NewListener(ic.ConnectionString, time.Second, time.Second*10, func(event pq.ListenerEventType, err error) {
 		p.listenerErrs <- err
 	})
@@ -89,39 +125,70 @@ func (p Postgres) ID() string {
 
 // Handle will:
 //
-// 1. Create triggers and pg_notify procedures so that changes to the database are picked up
-// 2. Create an internal table which instances of this PostgresInput will use to ensure operations are handled once
-// 3. Parse operations from the database, turning them into `orchestrator.Events`
+// 1. Create (or replace) triggers for the configured Operations, and pg_notify procedures, so that changes to the database are picked up
+// 2. Campaign for leadership against the other instances of this PostgresInput, to ensure operations are handled once
+// 3. Once elected, parse operations from the database, turning them into `orchestrator.Events`
 // From there, the orchestrator its self handles routing of events to different inputs
 //
+// Should this instance lose leadership, such as where it can't renew its lease, it stops listening to the
+// database and campaigns again.
+//
 // This function returns errors when garbage comes back from the database, and where database operations
 // go away. In such a situation, and where multiple instances of this input run across mutliple replicas
 // of an orchestrator, processing should carry on normally- just on another node
 func (p Postgres) Handle(ctx context.Context, c chan orchestrator.Event) (err error) {
+	p.started()
+	defer p.stopped()
+
 	err = p.configure()
 	if err != nil {
 		return
 	}
 
-	// Try to get a lock against our lock table
-	//
-	// This operation will block until we get the lock, meaning that
-	// the later call to p.listener.Listen() doesn't trigger and we don't
-	// end up with duplicate events.
-	//
-	// In theory, at least
-	err = p.getLock(p.lockTableName)
+	for {
+		err = p.lead(ctx, c)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// lead blocks until this instance is elected leader, and then emits Events
+// for as long as it remains so, returning nil where leadership is lost
+func (p Postgres) lead(ctx context.Context, c chan orchestrator.Event) (err error) {
+	lease, err := p.locker.Acquire(ctx)
 	if err != nil {
 		return
 	}
 
+	defer lease.Release()
+
+	p.state.leader.Store(true)
+	defer p.state.leader.Store(false)
+
 	err = p.listener.Listen(p.ID())
 	if err != nil {
-		return err
+		return
 	}
 
+	p.state.listening.Store(true)
+
+	defer func() {
+		p.state.listening.Store(false)
+
+		// Stop listening before leadership is given up, so that
+		// the next leader isn't emitting alongside us
+		p.listener.Unlisten(p.ID())
+	}()
+
 	for {
 		select {
+		case <-lease.Lost():
+			return nil
+
+		case <-ctx.Done():
+			return ctx.Err()
+
 		case n := <-p.listener.NotificationChannel():
 			err = p.handle(c, n)
 
@@ -133,8 +200,6 @@ func (p Postgres) Handle(ctx context.Context, c chan orchestrator.Event) (err er
 			return
 		}
 	}
-
-	return
 }
 
 func (p Postgres) handle(c chan orchestrator.Event, n *pq.Notification) (err error) {
@@ -149,13 +214,23 @@ func (p Postgres) handle(c chan orchestrator.Event, n *pq.Notification) (err err
 		return
 	}
 
+	if input.Schema == "" {
+		input.Schema = DefaultSchema
+	}
+
 	// Ignore changes to lock table
-	if input.Table == p.lockTableName {
+	if p.isLockTable(input.Schema, input.Table) {
+		return
+	}
+
+	// Ignore operations and tables we're not configured for, such as
+	// from triggers left over from a previous configuration
+	if _, ok := p.operations[input.Operation]; !ok || !p.tables.match(input.Schema, input.Table) {
 		return
 	}
 
 	c <- orchestrator.Event{
-		Location:  input.Table,
+		Location:  input.Schema + "." + input.Table,
 		Operation: input.Operation,
 		ID:        fmt.Sprintf("%v", input.ID),
 		Trigger:   p.ID(),
@@ -165,7 +240,7 @@ func (p Postgres) handle(c chan orchestrator.Event, n *pq.Notification) (err err
 }
 
 // configure will connect to the database and configure triggers and
-// notifies and lock tables and so on so that Handle can do what it needs to
+// notifies and so on so that Handle can do what it needs to
 func (p Postgres) configure() (err error) {
 	tf := p.triggerFunc()
 	tx := p.conn.MustBegin()
@@ -175,58 +250,152 @@ func (p Postgres) configure() (err error) {
 		return
 	}
 
-	tables := make([]string, 0)
-	err = tx.Select(&tables, "SELECT tablename FROM pg_catalog.pg_tables where schemaname = 'public' and tablename != $1;", p.lockTableName)
+	tables := make([]pgTable, 0)
+	err = tx.Select(&tables, "SELECT schemaname, tablename FROM pg_catalog.pg_tables WHERE schemaname NOT IN ('pg_catalog', 'information_schema') AND schemaname || '.' || tablename != $1;", qualifyTable(p.lockTableName))
 	if err != nil {
 		return
 	}
 
 	for _, table := range tables {
-		_, err = tx.Exec(p.addTrigger(table))
+		if !p.tables.match(table.Schema, table.Name) {
+			continue
+		}
+
+		_, err = tx.Exec(p.addTrigger(table.Schema, table.Name))
 		if err != nil {
 			return
 		}
 	}
 
-	// create lock table
-	_, err = tx.Exec(p.createLockTable(p.lockTableName))
-
-	return tx.Commit()
-}
-
-func (p Postgres) getLock(tbl string) (err error) {
-	tx, err := p.conn.Begin()
+	// Drop triggers from tables which are no longer selected, such as
+	// where the configuration has changed since they were created
+	triggers := make([]pgTrigger, 0)
+	err = tx.Select(&triggers, `SELECT n.nspname AS schemaname, c.relname AS tablename, t.tgname AS triggername
+FROM pg_catalog.pg_trigger t
+JOIN pg_catalog.pg_class c ON c.oid = t.tgrelid
+JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_catalog.pg_proc f ON f.oid = t.tgfoid
+WHERE f.proname = $1 AND NOT t.tgisinternal;`, strings.ToLower("process_record_"+p.ID()))
 	if err != nil {
 		return
 	}
 
-	_, err = tx.Exec(fmt.Sprintf("SELECT * FROM %s WHERE resource = 1 FOR UPDATE", tbl))
+	for _, trigger := range triggers {
+		if p.tables.match(trigger.Schema, trigger.Table) && !p.isLockTable(trigger.Schema, trigger.Table) {
+			continue
+		}
 
-	return
+		_, err = tx.Exec(fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s.%s;", pq.QuoteIdentifier(trigger.Name), pq.QuoteIdentifier(trigger.Schema), pq.QuoteIdentifier(trigger.Table)))
+		if err != nil {
+			return
+		}
+	}
+
+	return tx.Commit()
 }
 
 func (p Postgres) triggerFunc() string {
 	return fmt.Sprintf(`CREATE OR REPLACE FUNCTION process_record_%[1]s() RETURNS TRIGGER as $process_record_%[1]s$
 BEGIN
-    PERFORM pg_notify('%[1]s', json_build_object('tbl', TG_TABLE_NAME, 'id', COALESCE(NEW.id, 0), 'op', TG_OP)::Text);
+    PERFORM pg_notify('%[1]s', json_build_object('schema', TG_TABLE_SCHEMA, 'tbl', TG_TABLE_NAME, 'id', COALESCE(NEW.id, 0), 'op', TG_OP)::Text);
     RETURN NEW;
 END;
 $process_record_%[1]s$ LANGUAGE plpgsql;`, p.ID())
 }
 
-func (p Postgres) addTrigger(table string) string {
-	return fmt.Sprintf(`CREATE OR REPLACE TRIGGER %[1]s_%[2]s_trigger
-AFTER INSERT OR UPDATE OR DELETE ON %[1]s FOR EACH ROW
-EXECUTE PROCEDURE process_record_%[2]s();`, table, p.ID())
+// addTrigger returns the statement which creates the trigger on table, or
+// replaces it where it exists, so that triggers always reflect the
+// operations this input is configured for.
+//
+// Trigger names are lowercased before quoting, as postgres did to the
+// unquoted names of earlier versions, so that existing triggers are
+// replaced rather than duplicated
+func (p Postgres) addTrigger(schema, table string) string {
+	events := make([]string, 0, len(p.operations))
+	for _, op := range triggerableOperations {
+		if event, ok := p.operations[op]; ok {
+			events = append(events, event)
+		}
+	}
+
+	return fmt.Sprintf(`CREATE OR REPLACE TRIGGER %[1]s
+AFTER %[2]s ON %[3]s.%[4]s FOR EACH ROW
+EXECUTE PROCEDURE process_record_%[5]s();`, pq.QuoteIdentifier(strings.ToLower(table+"_"+p.ID()+"_trigger")), strings.Join(events, " OR "), pq.QuoteIdentifier(schema), pq.QuoteIdentifier(table), p.ID())
 }
 
-func (p Postgres) deriveLockTableName() string {
-	return fmt.Sprintf("lock_postgres_input_%s", p.ID())
+// pgTable is a table, as selected from pg_catalog
+type pgTable struct {
+	Schema string `db:"schemaname"`
+	Name   string `db:"tablename"`
 }
 
-// createLockTable will create an arbitrary table we can use for locks, thus
-// allowing multiple instances of an orchestrator run, without having multiple
-// pg_listen streams open- which would mean processing the same event multiple times
-func (p Postgres) createLockTable(table string) string {
-	return fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (resource int primary key);`, table)
+// pgTrigger is a trigger created by an input, as selected from pg_catalog
+type pgTrigger struct {
+	Schema string `db:"schemaname"`
+	Table  string `db:"tablename"`
+	Name   string `db:"triggername"`
+}
+
+// UnsupportedOperationErr is returned when an input is configured with an
+// Operation which postgres can't fire a trigger for
+type UnsupportedOperationErr struct {
+	op orchestrator.Operation
+}
+
+// Error returns the error text for this error
+func (e UnsupportedOperationErr) Error() string {
+	return fmt.Sprintf("postgres can't trigger on %s operations", e.op)
+}
+
+// triggerableOperations lists the Operations which can be triggered on, in
+// the order trigger events are written
+var triggerableOperations = []orchestrator.Operation{
+	orchestrator.OperationCreate,
+	orchestrator.OperationUpdate,
+	orchestrator.OperationDelete,
+}
+
+// triggerEvents maps Operations to the trigger events which cause them
+var triggerEvents = map[orchestrator.Operation]string{
+	orchestrator.OperationCreate: "INSERT",
+	orchestrator.OperationUpdate: "UPDATE",
+	orchestrator.OperationDelete: "DELETE",
+}
+
+// triggerOperations returns the set of Operations to trigger on, mapped to
+// their trigger events, from those configured, defaulting to all of them
+func triggerOperations(configured []orchestrator.Operation) (ops map[orchestrator.Operation]string, err error) {
+	if len(configured) == 0 {
+		configured = triggerableOperations
+	}
+
+	ops = make(map[orchestrator.Operation]string)
+	for _, op := range configured {
+		event, ok := triggerEvents[op]
+		if !ok {
+			return nil, UnsupportedOperationErr{op}
+		}
+
+		ops[op] = event
+	}
+
+	return
+}
+
+// isLockTable returns true where schema.table is this Input's lock table;
+// lock tables without a schema are taken to be in DefaultSchema, as with
+// table patterns
+func (p Postgres) isLockTable(schema, table string) bool {
+	return schema+"."+table == qualifyTable(p.lockTableName)
+}
+
+// lockerOptions returns the Options for this Input's Locker, given those
+// passed via WithLockerOptions. The lock table is our own unless set
+// otherwise, and is left out of the tables we trigger on either way
+func (p Postgres) lockerOptions(opts []Option) []Option {
+	return append([]Option{WithLockTable(p.deriveLockTableName())}, opts...)
+}
+
+func (p Postgres) deriveLockTableName() string {
+	return fmt.Sprintf("lock_postgres_input_%s", p.ID())
 }
@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/lib/pq"
+)
+
+func TestPostgres_addTrigger(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		ops       []orchestrator.Operation
+		expect    string
+		expectErr error
+	}{
+		{"unconfigured", nil, "AFTER INSERT OR UPDATE OR DELETE ON", nil},
+		{"creates only", []orchestrator.Operation{orchestrator.OperationCreate}, "AFTER INSERT ON", nil},
+		{"out of order", []orchestrator.Operation{orchestrator.OperationDelete, orchestrator.OperationCreate}, "AFTER INSERT OR DELETE ON", nil},
+		{"duplicated", []orchestrator.Operation{orchestrator.OperationUpdate, orchestrator.OperationUpdate}, "AFTER UPDATE ON", nil},
+		{"reads", []orchestrator.Operation{orchestrator.OperationRead}, "", UnsupportedOperationErr{}},
+		{"unknown", []orchestrator.Operation{orchestrator.OperationUnknown}, "", UnsupportedOperationErr{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				p   Postgres
+				err error
+			)
+
+			p.config.Name = "tests"
+
+			p.operations, err = triggerOperations(test.ops)
+			if test.expectErr != nil {
+				if !errors.As(err, new(UnsupportedOperationErr)) {
+					t.Errorf("expected error of type %T, received %#v", test.expectErr, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stmt := p.addTrigger("public", "Orders")
+			if !strings.Contains(stmt, test.expect+` "public"."Orders" FOR EACH ROW`) {
+				t.Errorf("expected trigger %q, received\n%s", test.expect, stmt)
+			}
+
+			// Named as earlier, unquoted, versions were, once folded by postgres
+			if !strings.HasPrefix(stmt, `CREATE OR REPLACE TRIGGER "orders_tests_trigger"`) {
+				t.Errorf("expected trigger to be named orders_tests_trigger, received\n%s", stmt)
+			}
+		})
+	}
+}
+
+func TestPostgres_handle(t *testing.T) {
+	p := Postgres{lockTableName: "lock_postgres_input_tests"}
+	p.config.Name = "tests"
+
+	var err error
+
+	p.tables, err = newTableSelection([]string{"*", "sales.*"}, []string{"audit_*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.operations, err = triggerOperations([]orchestrator.Operation{orchestrator.OperationCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		extra  string
+		expect string
+	}{
+		{"configured operation", `{"tbl": "orders", "id": 1, "op": "INSERT"}`, "public.orders"},
+		{"unconfigured operation", `{"tbl": "orders", "id": 1, "op": "DELETE"}`, ""},
+		{"lock table", `{"tbl": "lock_postgres_input_tests", "id": 1, "op": "INSERT"}`, ""},
+		{"lock table name in another schema", `{"schema": "sales", "tbl": "lock_postgres_input_tests", "id": 1, "op": "INSERT"}`, "sales.lock_postgres_input_tests"},
+		{"selected schema", `{"schema": "sales", "tbl": "orders", "id": 1, "op": "INSERT"}`, "sales.orders"},
+		{"unselected schema", `{"schema": "hr", "tbl": "staff", "id": 1, "op": "INSERT"}`, ""},
+		{"excluded table", `{"schema": "public", "tbl": "audit_log", "id": 1, "op": "INSERT"}`, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := make(chan orchestrator.Event, 1)
+
+			err := p.handle(c, &pq.Notification{Extra: test.extra})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var location string
+			if len(c) == 1 {
+				location = (<-c).Location
+			}
+
+			if location != test.expect {
+				t.Errorf("expected event from %q, received %q", test.expect, location)
+			}
+		})
+	}
+}
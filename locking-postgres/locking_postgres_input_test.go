@@ -2,6 +2,7 @@ package postgres_test
 
 import (
 	"context"
+	"errors"
 	"os"
 	"testing"
 	"time"
@@ -38,6 +39,19 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestNew_Operations(t *testing.T) {
+	_, err := postgres.New(orchestrator.InputConfig{
+		ConnectionString: os.Getenv("TEST_DB_CONN_STRING"),
+		Operations: []orchestrator.Operation{
+			orchestrator.OperationCreate,
+			orchestrator.OperationRead,
+		},
+	})
+	if !errors.As(err, new(postgres.UnsupportedOperationErr)) {
+		t.Errorf("expected error of type %T, received %#v", postgres.UnsupportedOperationErr{}, err)
+	}
+}
+
 func TestPostgresInput_Process(t *testing.T) {
 	dsn := os.Getenv("TEST_DB_CONN_STRING")
 
@@ -45,9 +59,6 @@ func TestPostgresInput_Process(t *testing.T) {
 		ConnectionString: dsn,
 		Name:             "test_input",
 		Type:             "postgres",
-		Operations: []orchestrator.Operation{
-			orchestrator.OperationCreate,
-		},
 	})
 	if err != nil {
 		t.Fatal(err)
@@ -97,3 +108,60 @@ func TestPostgresInput_Process(t *testing.T) {
 		t.Errorf("expected 5 notification, received %d", count)
 	}
 }
+
+func TestPostgresInput_Process_Operations(t *testing.T) {
+	dsn := os.Getenv("TEST_DB_CONN_STRING")
+
+	p, err := postgres.New(orchestrator.InputConfig{
+		ConnectionString: dsn,
+		Name:             "test_input_operations",
+		Type:             "postgres",
+		Operations: []orchestrator.Operation{
+			orchestrator.OperationCreate,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure there's at least one table in the database so we can generate
+	// triggers
+	conn.Exec("CREATE TABLE IF NOT EXISTS some_test_table (id numeric);")
+
+	c := make(chan orchestrator.Event)
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		conn.Exec("SELECT pg_notify('test_input_operations', json_build_object('tbl', 'test', 'id', '1', 'op', 'INSERT')::Text);")
+		conn.Exec("SELECT pg_notify('test_input_operations', json_build_object('tbl', 'test', 'id', '1', 'op', 'UPDATE')::Text);")
+		conn.Exec("SELECT pg_notify('test_input_operations', json_build_object('tbl', 'test', 'id', '1', 'op', 'DELETE')::Text);")
+
+		conn.Exec("SELECT pg_notify('test_input_operations', json_build_object('tbl', 'test', 'id', '1', 'op', 'UPDATE')::Text);")
+
+		conn.Exec("SELECT pg_notify('test_input_operations', json_build_object('tbl', 'test', 'id', '1', 'op', 'INSERT')::Text);")
+
+		// Operations we're not configured for, such as the updates
+		// and deletes above, should be ignored
+		conn.Exec("SELECT pg_notify('test_input_operations', 'some bollocks');")
+	}()
+
+	count := 0
+	go func() {
+		for range c {
+			count++
+		}
+	}()
+
+	err = p.Handle(context.Background(), c)
+	if err == nil {
+		t.Errorf("expected error, received none")
+	}
+
+	if count != 2 {
+		t.Errorf("expected 2 notification, received %d", count)
+	}
+}
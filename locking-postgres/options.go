@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"time"
+)
+
+// DefaultLeaseDuration is how long a leader holds on to leadership without
+// being able to reach the database, unless set with WithLeaseDuration
+const DefaultLeaseDuration = 10 * time.Second
+
+// DefaultLockTable is the table a Locker records fencing tokens in, unless
+// set with WithLockTable
+const DefaultLockTable = "dapper_locks"
+
+// Option configures optional behaviour of a Locker, including the Locker a
+// Postgres Input campaigns for leadership with, via WithLockerOptions
+type Option func(*options)
+
+type options struct {
+	lease     time.Duration
+	table     string
+	elected   func()
+	demoted   func()
+	retryWait time.Duration
+}
+
+func defaultOptions(opts []Option) (o options) {
+	o.lease = DefaultLeaseDuration
+	o.table = DefaultLockTable
+	o.retryWait = time.Second
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return
+}
+
+// WithLeaseDuration sets how long a lock holder keeps its lock without
+// being able to reach the database.
+//
+// The holder renews its lease a few times per lease duration; should it
+// fail to for the whole of the lease the lock is considered lost. On
+// servers which support it (PostgreSQL 14 onwards), the holder's session
+// is also ended by the server after a lease duration of silence, which
+// releases the lock to another replica even where the holder has hung or
+// been partitioned from the database
+func WithLeaseDuration(d time.Duration) Option {
+	return func(o *options) {
+		if d > 0 {
+			o.lease = d
+		}
+	}
+}
+
+// WithLockTable sets the table fencing tokens are recorded in, which is
+// created where it doesn't already exist
+func WithLockTable(table string) Option {
+	return func(o *options) {
+		if table != "" {
+			o.table = table
+		}
+	}
+}
+
+// OnElected sets a function to be called whenever the lock is acquired;
+// for a Postgres Input, whenever this replica becomes the leader, just
+// before it starts listening for database operations
+func OnElected(f func()) Option {
+	return func(o *options) {
+		o.elected = f
+	}
+}
+
+// OnDemoted sets a function to be called whenever the lock is given up;
+// for a Postgres Input, whenever this replica stops being the leader,
+// whether because it lost its lease or because Handle returned
+func OnDemoted(f func()) Option {
+	return func(o *options) {
+		o.demoted = f
+	}
+}
+
+// InputOption configures optional behaviour of a Postgres Input
+type InputOption func(*inputOptions)
+
+type inputOptions struct {
+	locker         []Option
+	tables         []string
+	excludedTables []string
+}
+
+func defaultInputOptions(opts []InputOption) (o inputOptions) {
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return
+}
+
+// WithLockerOptions configures the Locker a Postgres Input campaigns for
+// leadership with.
+//
+// Unless set with WithLockTable, the lock table is one of the Input's
+// own, named for its ID. Either way the lock table is never triggered on
+func WithLockerOptions(opts ...Option) InputOption {
+	return func(o *inputOptions) {
+		o.locker = append(o.locker, opts...)
+	}
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// DefaultSchema is the schema table patterns without a schema of their own,
+// and notifications without a schema, are taken to refer to
+const DefaultSchema = "public"
+
+// InvalidTablePatternErr is returned when a pattern passed to WithTables or
+// WithoutTables is malformed
+type InvalidTablePatternErr struct {
+	pattern string
+	err     error
+}
+
+// Error returns the error text for this error
+func (e InvalidTablePatternErr) Error() string {
+	return fmt.Sprintf("invalid table pattern %q: %v", e.pattern, e.err)
+}
+
+// Unwrap returns the underlying error
+func (e InvalidTablePatternErr) Unwrap() error {
+	return e.err
+}
+
+// WithTables sets the tables a Postgres Input triggers on, replacing the
+// default of every table in the public schema.
+//
+// Each pattern is of the form schema.table, where either part may be a
+// glob as understood by path.Match, such as "sales.*" or "*.orders_*";
+// patterns without a schema refer to the public schema
+func WithTables(patterns ...string) InputOption {
+	return func(o *inputOptions) {
+		o.tables = append(o.tables, patterns...)
+	}
+}
+
+// WithoutTables sets tables a Postgres Input does not trigger on, even
+// where they are matched by WithTables, using the same patterns
+func WithoutTables(patterns ...string) InputOption {
+	return func(o *inputOptions) {
+		o.excludedTables = append(o.excludedTables, patterns...)
+	}
+}
+
+// tableSelection chooses the tables triggers are created on
+type tableSelection struct {
+	include []string
+	exclude []string
+}
+
+func newTableSelection(include, exclude []string) (s tableSelection, err error) {
+	if len(include) == 0 {
+		include = []string{"*"}
+	}
+
+	s.include, err = qualifyPatterns(include)
+	if err != nil {
+		return
+	}
+
+	s.exclude, err = qualifyPatterns(exclude)
+
+	return
+}
+
+// qualifyTable returns name qualified with DefaultSchema, where it has no
+// schema of its own
+func qualifyTable(name string) string {
+	if !strings.Contains(name, ".") {
+		return DefaultSchema + "." + name
+	}
+
+	return name
+}
+
+func qualifyPatterns(patterns []string) (qualified []string, err error) {
+	qualified = make([]string, len(patterns))
+
+	for i, pattern := range patterns {
+		pattern = qualifyTable(pattern)
+
+		// Check patterns up front, so that matching needn't
+		_, err = path.Match(pattern, "")
+		if err != nil {
+			return nil, InvalidTablePatternErr{patterns[i], err}
+		}
+
+		qualified[i] = pattern
+	}
+
+	return
+}
+
+// match returns true where schema.table is included, and not excluded
+func (s tableSelection) match(schema, table string) bool {
+	name := schema + "." + table
+
+	return matchAny(s.include, name) && !matchAny(s.exclude, name)
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		// Patterns are validated when the selection is created
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
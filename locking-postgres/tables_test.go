@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTableSelection_match(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		include []string
+		exclude []string
+		schema  string
+		table   string
+		expect  bool
+	}{
+		{"default", nil, nil, "public", "orders", true},
+		{"default, other schema", nil, nil, "sales", "orders", false},
+		{"explicit table", []string{"orders"}, nil, "public", "orders", true},
+		{"explicit table, not listed", []string{"orders"}, nil, "public", "customers", false},
+		{"qualified table", []string{"sales.orders"}, nil, "sales", "orders", true},
+		{"schema glob", []string{"sales.*"}, nil, "sales", "invoices", true},
+		{"any schema", []string{"*.orders"}, nil, "hr", "orders", true},
+		{"table glob", []string{"orders_*"}, nil, "public", "orders_2024", true},
+		{"excluded", []string{"*.*"}, []string{"audit.*"}, "audit", "log", false},
+		{"excluded from default", nil, []string{"tmp_*"}, "public", "tmp_import", false},
+		{"not excluded", nil, []string{"tmp_*"}, "public", "imports", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := newTableSelection(test.include, test.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := s.match(test.schema, test.table); got != test.expect {
+				t.Errorf("expected %v, received %v", test.expect, got)
+			}
+		})
+	}
+}
+
+func TestNewTableSelection(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		include []string
+		exclude []string
+	}{
+		{"malformed include", []string{"sales.[orders"}, nil},
+		{"malformed exclude", nil, []string{"[audit"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newTableSelection(test.include, test.exclude)
+			if !errors.As(err, new(InvalidTablePatternErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidTablePatternErr{}, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/google/uuid"
+)
+
+// DefaultJournalSize is the number of deliveries a Journal retains when
+// created with a non-positive maxEntries
+const DefaultJournalSize = 1000
+
+// redactedHeaders are never recorded in a Journal, so that credentials
+// sent by callers aren't exposed via an Admin handler
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// UnknownDeliveryErr is returned when a Journal is asked for a delivery it
+// does not hold, either because it never existed or because it has expired
+type UnknownDeliveryErr struct{ id string }
+
+// Error returns the error text for this error
+func (e UnknownDeliveryErr) Error() string {
+	return fmt.Sprintf("unknown delivery %q", e.id)
+}
+
+// InputNotRunningErr is returned when replaying a delivery to an Input
+// which no longer exists, or whose Handle function has not yet been called
+type InputNotRunningErr struct{ input string }
+
+// Error returns the error text for this error
+func (e InputNotRunningErr) Error() string {
+	return fmt.Sprintf("input %q is not running", e.input)
+}
+
+// MissingAuthenticatorErr is returned by NewAdmin when no Authenticator is
+// provided; the admin API exposes raw request bodies and so is never served
+// unauthenticated
+type MissingAuthenticatorErr struct{}
+
+// Error returns the error text for this error
+func (e MissingAuthenticatorErr) Error() string {
+	return "error creating admin handler: missing authenticator"
+}
+
+// Delivery is a request received by an Input, as recorded by a Journal
+type Delivery struct {
+	ID         string             `json:"id"`
+	Input      string             `json:"input"`
+	ReceivedAt time.Time          `json:"received_at"`
+	Headers    http.Header        `json:"headers,omitempty"`
+	Body       string             `json:"body,omitempty"`
+	Event      orchestrator.Event `json:"event"`
+}
+
+// Journal records the deliveries received by one or more Inputs, so that
+// they can be inspected and replayed via an Admin handler
+//
+// Retention is bounded both by count and by age; whichever limit is hit
+// first causes the oldest deliveries to be dropped
+type Journal struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxAge     time.Duration
+	deliveries []Delivery
+	inputs     map[string]*Input
+}
+
+// NewJournal returns a Journal which keeps, at most, the last maxEntries
+// deliveries, none of which are older than maxAge.
+//
+// A non-positive maxEntries uses DefaultJournalSize, and a zero maxAge
+// keeps deliveries until they are pushed out by newer ones
+func NewJournal(maxEntries int, maxAge time.Duration) *Journal {
+	if maxEntries <= 0 {
+		maxEntries = DefaultJournalSize
+	}
+
+	return &Journal{
+		maxEntries: maxEntries,
+		maxAge:     maxAge,
+		deliveries: make([]Delivery, 0),
+		inputs:     make(map[string]*Input),
+	}
+}
+
+// WithJournal records every delivery an Input successfully receives into
+// Journal j.
+//
+// Only Input records deliveries; the option has no effect on a StreamInput
+func WithJournal(j *Journal) InputOption {
+	return func(o *inputOptions) {
+		o.journal = j
+	}
+}
+
+// List returns the deliveries currently retained, newest first
+func (j *Journal) List() (d []Delivery) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.prune()
+
+	d = make([]Delivery, len(j.deliveries))
+	for i := range j.deliveries {
+		d[len(d)-1-i] = j.deliveries[i]
+	}
+
+	return
+}
+
+// Get returns a specific delivery by its ID
+func (j *Journal) Get(id string) (d Delivery, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.prune()
+
+	for _, d = range j.deliveries {
+		if d.ID == id {
+			return
+		}
+	}
+
+	return Delivery{}, UnknownDeliveryErr{id}
+}
+
+// Replay re-injects the Events of the specified deliveries into the Inputs
+// which originally received them, in the order given, from where they flow
+// through the pipeline as if they had just been received
+func (j *Journal) Replay(ctx context.Context, ids ...string) (err error) {
+	for _, id := range ids {
+		var d Delivery
+
+		d, err = j.Get(id)
+		if err != nil {
+			return
+		}
+
+		j.mu.Lock()
+		in, ok := j.inputs[d.Input]
+		j.mu.Unlock()
+
+		if !ok {
+			return InputNotRunningErr{d.Input}
+		}
+
+		err = in.inject(ctx, d.Event)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (j *Journal) register(in *Input) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.inputs[in.ID()] = in
+}
+
+// unregister removes in from the Inputs replayed to, leaving alone any
+// Input which has since been registered under the same ID
+func (j *Journal) unregister(in *Input) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.inputs[in.ID()] == in {
+		delete(j.inputs, in.ID())
+	}
+}
+
+func (j *Journal) record(input string, req *http.Request, body []byte, e orchestrator.Event) {
+	h := req.Header.Clone()
+	for _, k := range redactedHeaders {
+		h.Del(k)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.deliveries = append(j.deliveries, Delivery{
+		ID:         uuid.NewString(),
+		Input:      input,
+		ReceivedAt: time.Now(),
+		Headers:    h,
+		Body:       string(body),
+		Event:      e,
+	})
+
+	j.prune()
+}
+
+// prune drops deliveries which exceed the bounds of this Journal; callers
+// must hold the lock
+func (j *Journal) prune() {
+	drop := max(len(j.deliveries)-j.maxEntries, 0)
+
+	if j.maxAge > 0 {
+		cutoff := time.Now().Add(-j.maxAge)
+		for drop < len(j.deliveries) && j.deliveries[drop].ReceivedAt.Before(cutoff) {
+			drop++
+		}
+	}
+
+	if drop > 0 {
+		j.deliveries = append(j.deliveries[:0:0], j.deliveries[drop:]...)
+	}
+}
+
+// Admin is an http.Handler which exposes the contents of a Journal,
+// allowing deliveries to be listed, inspected, and replayed.
+//
+// It serves the following routes, relative to wherever it is mounted:
+//
+//	GET  /events               list retained deliveries, newest first
+//	GET  /events/{id}          inspect a single delivery
+//	POST /events/{id}/replay   replay a single delivery
+//	POST /replay               replay the deliveries in the body {"ids": [...]}
+//
+// As with Input, Admin doesn't expose an HTTP server of its own, and so
+// would usually be mounted with something like:
+//
+//	http.Handle("/admin/", http.StripPrefix("/admin", admin))
+type Admin struct {
+	journal *Journal
+	auth    Authenticator
+}
+
+// NewAdmin returns an Admin handler for Journal j, protected by
+// Authenticator a
+func NewAdmin(j *Journal, a Authenticator) (admin Admin, err error) {
+	if a == nil {
+		err = MissingAuthenticatorErr{}
+
+		return
+	}
+
+	admin.journal = j
+	admin.auth = a
+
+	return
+}
+
+// ServeHTTP implements the http.Handler interface
+func (a Admin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requireAuth(a.auth, a.route)(w, r)
+}
+
+func (a Admin) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "events":
+		writeJSON(w, http.StatusOK, a.journal.List())
+
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "events":
+		d, err := a.journal.Get(parts[1])
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, d)
+
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "events" && parts[2] == "replay":
+		a.replay(w, r, []string{parts[1]})
+
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "replay":
+		body := new(struct {
+			IDs []string `json:"ids"`
+		})
+
+		err := json.NewDecoder(r.Body).Decode(body)
+		if err != nil || len(body.IDs) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		a.replay(w, r, body.IDs)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a Admin) replay(w http.ResponseWriter, r *http.Request, ids []string) {
+	err := a.journal.Replay(r.Context(), ids...)
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string][]string{"replayed": ids})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch err.(type) {
+	case UnknownDeliveryErr, UnknownDeadLetterErr:
+		status = http.StatusNotFound
+
+	case InputNotRunningErr, UnknownProcessErr:
+		status = http.StatusServiceUnavailable
+
+	case DryRunRedriveErr:
+		status = http.StatusConflict
+
+	default:
+		if errors.As(err, new(BadStatusErr)) {
+			status = http.StatusBadGateway
+		}
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,282 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestJournal_Retention(t *testing.T) {
+	j := NewJournal(2, time.Hour)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer some-secret")
+	req.Header.Set("X-Custom", "custom")
+
+	for _, id := range []string{"a", "b", "c"} {
+		j.record("test-webhook-input", req, []byte(id), orchestrator.Event{ID: id})
+	}
+
+	d := j.List()
+	if len(d) != 2 {
+		t.Fatalf("expected 2 deliveries, received %d", len(d))
+	}
+
+	if d[0].Event.ID != "c" || d[1].Event.ID != "b" {
+		t.Errorf("expected newest deliveries first, received %q, %q", d[0].Event.ID, d[1].Event.ID)
+	}
+
+	if d[0].Headers.Get("Authorization") != "" {
+		t.Errorf("authorization header should be redacted")
+	}
+
+	if d[0].Headers.Get("X-Custom") != "custom" {
+		t.Errorf("expected custom header to be recorded")
+	}
+
+	// Age out everything
+	j.maxAge = time.Nanosecond
+	time.Sleep(time.Millisecond)
+
+	if len(j.List()) != 0 {
+		t.Errorf("expected deliveries to expire")
+	}
+}
+
+func TestNewAdmin(t *testing.T) {
+	_, err := NewAdmin(NewJournal(0, 0), nil)
+	if err == nil {
+		t.Fatal("expected error, received none")
+	}
+
+	_ = err.Error() // does nothing but increase codecoverage /shrug
+
+	if _, ok := err.(MissingAuthenticatorErr); !ok {
+		t.Errorf("expected error of type %T, received %T", MissingAuthenticatorErr{}, err)
+	}
+}
+
+func TestAdmin_ServeHTTP(t *testing.T) {
+	j := NewJournal(10, 0)
+
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "test-webhook-input",
+		ConnectionString: "/webhooks/test-webhook-input/events",
+	}, WithJournal(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unstarted, err := NewInput(orchestrator.InputConfig{
+		Name:             "unstarted-webhook-input",
+		ConnectionString: "/webhooks/unstarted-webhook-input/events",
+	}, WithJournal(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Stand in for Handle, which would otherwise register wh against
+	// http.DefaultServeMux
+	wh.health.state.Store(stateRunning)
+
+	events := make(chan orchestrator.Event, 10)
+	go func() {
+		for e := range wh.c {
+			events <- e
+		}
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, wh.ic.ConnectionString, bytes.NewBufferString(`{"location":"a-table","operation":"create","id":"0xabadbabe"}`))
+	wh.handler(httptest.NewRecorder(), req)
+
+	<-events
+
+	// unstarted has never had Handle called, and so can't be replayed to
+	j.record(unstarted.ID(), req, nil, orchestrator.Event{Operation: orchestrator.OperationCreate})
+
+	deliveries := j.List()
+	if len(deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, received %d", len(deliveries))
+	}
+
+	unstartedID, startedID := deliveries[0].ID, deliveries[1].ID
+
+	admin, err := NewAdmin(j, BearerAuthenticator{Token: "s3cr3t"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		token        string
+		expectStatus int
+	}{
+		{"missing auth is refused", http.MethodGet, "/events", "", "", http.StatusUnauthorized},
+		{"wrong token is refused", http.MethodGet, "/events", "", "nope", http.StatusUnauthorized},
+		{"list deliveries", http.MethodGet, "/events", "", "s3cr3t", http.StatusOK},
+		{"inspect delivery", http.MethodGet, "/events/" + startedID, "", "s3cr3t", http.StatusOK},
+		{"inspect unknown delivery", http.MethodGet, "/events/nonsuch", "", "s3cr3t", http.StatusNotFound},
+		{"replay delivery", http.MethodPost, "/events/" + startedID + "/replay", "", "s3cr3t", http.StatusAccepted},
+		{"replay many deliveries", http.MethodPost, "/replay", `{"ids":["` + startedID + `","` + startedID + `"]}`, "s3cr3t", http.StatusAccepted},
+		{"replay to stopped input", http.MethodPost, "/events/" + unstartedID + "/replay", "", "s3cr3t", http.StatusServiceUnavailable},
+		{"replay nothing", http.MethodPost, "/replay", `{"ids":[]}`, "s3cr3t", http.StatusBadRequest},
+		{"unknown route", http.MethodDelete, "/events", "", "s3cr3t", http.StatusNotFound},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			recorder := httptest.NewRecorder()
+			admin.ServeHTTP(recorder, req)
+
+			result := recorder.Result()
+			if test.expectStatus != result.StatusCode {
+				t.Errorf("expected %d, received %d", test.expectStatus, result.StatusCode)
+			}
+
+			if result.StatusCode == http.StatusUnauthorized && result.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case replayed := <-events:
+			if replayed.ID != "0xabadbabe" || replayed.Trigger != "test-webhook-input" {
+				t.Errorf("unexpected replayed event %#v", replayed)
+			}
+
+		case <-time.After(time.Second):
+			t.Fatalf("expected 3 replayed event(s), received %d", i)
+		}
+	}
+
+	// ensure listings are valid json
+	recorder := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Authorization", "Bearer s3cr3t")
+	admin.ServeHTTP(recorder, req)
+
+	listed := make([]Delivery, 0)
+	err = json.NewDecoder(recorder.Body).Decode(&listed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listed) != 2 {
+		t.Errorf("expected 2 deliveries, received %d", len(listed))
+	}
+}
+
+func TestInput_inject_whileStarting(t *testing.T) {
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "injected-webhook-input",
+		ConnectionString: "/webhooks/injected-webhook-input/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := make(chan orchestrator.Event)
+	go wh.Handle(context.Background(), c)
+
+	// Replays may arrive before, or while, Handle starts
+	injected := make(chan error, 1)
+	go func() {
+		for {
+			err := wh.inject(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate})
+			if !errors.As(err, new(InputNotRunningErr)) {
+				injected <- err
+
+				return
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for injected event")
+	}
+
+	if err := <-injected; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournal_InputLifecycle(t *testing.T) {
+	j := NewJournal(10, 0)
+
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "journalled-webhook-input",
+		ConnectionString: "/webhooks/journalled-webhook-input/events",
+	}, WithJournal(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"location":"a-table","operation":"create","id":"0xabadbabe"}`
+
+	// Refused deliveries, whether Handle has stopped or nothing reads the
+	// Event before the request goes away, are not journalled
+	wh.health.state.Store(stateStopped)
+
+	rec := httptest.NewRecorder()
+	wh.handler(rec, httptest.NewRequest(http.MethodPost, wh.ic.ConnectionString, bytes.NewBufferString(body)))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, received %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	wh.health.state.Store(stateRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rec = httptest.NewRecorder()
+	wh.handler(rec, httptest.NewRequest(http.MethodPost, wh.ic.ConnectionString, bytes.NewBufferString(body)).WithContext(ctx))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, received %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	if d := j.List(); len(d) != 0 {
+		t.Fatalf("expected no deliveries, received %#v", d)
+	}
+
+	go func() { <-wh.c }()
+
+	rec = httptest.NewRecorder()
+	wh.handler(rec, httptest.NewRequest(http.MethodPost, wh.ic.ConnectionString, bytes.NewBufferString(body)))
+
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("expected %d, received %d", http.StatusAccepted, rec.Code)
+	}
+
+	d := j.List()
+	if len(d) != 1 {
+		t.Fatalf("expected 1 delivery, received %d", len(d))
+	}
+
+	// Closed Inputs can no longer be replayed to
+	wh.Close()
+
+	err = j.Replay(context.Background(), d[0].ID)
+	if !errors.As(err, new(InputNotRunningErr)) {
+		t.Errorf("expected error of type %T, received %#v", InputNotRunningErr{}, err)
+	}
+}
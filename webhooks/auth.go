@@ -0,0 +1,108 @@
+package webhooks
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// UnauthorizedErr is returned by an Authenticator when a request does not
+// carry valid credentials
+type UnauthorizedErr struct{}
+
+// Error returns the error text for this error
+func (e UnauthorizedErr) Error() string {
+	return "unauthorized"
+}
+
+// Authenticator validates the credentials of inbound requests, such as
+// those made to an Admin handler, or to an Input configured via
+// WithAuthenticator
+type Authenticator interface {
+	// Authenticate returns an error (usually UnauthorizedErr) when a
+	// request should be refused
+	Authenticate(*http.Request) error
+
+	// Challenge returns the value of the WWW-Authenticate header sent
+	// to clients who fail authentication
+	Challenge() string
+}
+
+// BasicAuthenticator is an Authenticator which expects requests to carry
+// a specific username and password via HTTP basic auth
+type BasicAuthenticator struct {
+	Username string
+	Password string
+}
+
+// Authenticate implements the Authenticator interface
+func (a BasicAuthenticator) Authenticate(r *http.Request) error {
+	u, p, ok := r.BasicAuth()
+	if !ok || !secureCompare(u, a.Username) || !secureCompare(p, a.Password) {
+		return UnauthorizedErr{}
+	}
+
+	return nil
+}
+
+// Challenge implements the Authenticator interface
+func (a BasicAuthenticator) Challenge() string {
+	return `Basic realm="webhooks"`
+}
+
+// SecurityScheme implements the SecuritySchemer interface
+func (a BasicAuthenticator) SecurityScheme() (string, SecurityScheme) {
+	return "basicAuth", SecurityScheme{Type: "http", Scheme: "basic"}
+}
+
+// BearerAuthenticator is an Authenticator which expects requests to carry
+// a specific token in an `Authorization: Bearer` header
+type BearerAuthenticator struct {
+	Token string
+}
+
+// Authenticate implements the Authenticator interface
+func (a BearerAuthenticator) Authenticate(r *http.Request) error {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !secureCompare(token, a.Token) {
+		return UnauthorizedErr{}
+	}
+
+	return nil
+}
+
+// Challenge implements the Authenticator interface
+func (a BearerAuthenticator) Challenge() string {
+	return `Bearer realm="webhooks"`
+}
+
+// SecurityScheme implements the SecuritySchemer interface
+func (a BearerAuthenticator) SecurityScheme() (string, SecurityScheme) {
+	return "bearerAuth", SecurityScheme{Type: "http", Scheme: "bearer"}
+}
+
+// requireAuth wraps an http.HandlerFunc, refusing requests which fail
+// authentication with a 401
+func requireAuth(a Authenticator, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.Authenticate(r) != nil {
+			w.Header().Set("WWW-Authenticate", a.Challenge())
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// secureCompare compares two strings in constant time, where an empty
+// expected value never matches, so an unconfigured Authenticator fails
+// closed
+func secureCompare(given, expect string) bool {
+	if expect == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expect)) == 1
+}
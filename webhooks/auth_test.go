@@ -0,0 +1,41 @@
+package webhooks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticators(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		auth         Authenticator
+		setup        func(*http.Request)
+		expectAccept bool
+	}{
+		{"basic auth, valid", BasicAuthenticator{"user", "pass"}, func(r *http.Request) { r.SetBasicAuth("user", "pass") }, true},
+		{"basic auth, wrong password", BasicAuthenticator{"user", "pass"}, func(r *http.Request) { r.SetBasicAuth("user", "nope") }, false},
+		{"basic auth, missing", BasicAuthenticator{"user", "pass"}, func(r *http.Request) {}, false},
+		{"basic auth, unconfigured fails closed", BasicAuthenticator{}, func(r *http.Request) { r.SetBasicAuth("", "") }, false},
+		{"bearer, valid", BearerAuthenticator{"token"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, true},
+		{"bearer, wrong token", BearerAuthenticator{"token"}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, false},
+		{"bearer, wrong scheme", BearerAuthenticator{"token"}, func(r *http.Request) { r.Header.Set("Authorization", "token") }, false},
+		{"bearer, unconfigured fails closed", BearerAuthenticator{}, func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			test.setup(req)
+
+			err := test.auth.Authenticate(req)
+			if test.expectAccept && err != nil {
+				t.Errorf("unexpected error %#v", err)
+			} else if !test.expectAccept && err == nil {
+				t.Errorf("expected error, received none")
+			}
+
+			if test.auth.Challenge() == "" {
+				t.Errorf("expected a challenge")
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ExecutionContext keys used to configure the circuit breaker a Process
+// shares with every other Process sending to the same host with the same
+// settings
+const (
+	// BreakerThresholdKey sets the number of consecutive failures after
+	// which the circuit breaker for a target host opens, failing calls
+	// fast rather than waiting on a receiver which is down.
+	//
+	// By default no circuit breaker is used
+	BreakerThresholdKey = "breaker_threshold"
+
+	// BreakerCooldownKey sets how long a circuit breaker stays open before
+	// letting a single trial call through, as a duration string such as
+	// "30s". The default is DefaultBreakerCooldown
+	BreakerCooldownKey = "breaker_cooldown"
+)
+
+// DefaultBreakerCooldown is how long a circuit breaker stays open when no
+// BreakerCooldownKey is set
+const DefaultBreakerCooldown = time.Second * 30
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState int32
+
+const (
+	// BreakerClosed lets every call through
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen fails every call with a CircuitOpenErr
+	BreakerOpen
+
+	// BreakerHalfOpen lets a single trial call through, the outcome of
+	// which either closes or reopens the breaker
+	BreakerHalfOpen
+)
+
+// String returns the name of a BreakerState
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+
+	case BreakerOpen:
+		return "open"
+
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return "unknown"
+}
+
+// CircuitOpenErr is returned by a Process whose circuit breaker is open,
+// without a call being made
+type CircuitOpenErr struct {
+	host  string
+	until time.Time
+}
+
+// Error returns the error text for this error
+func (e CircuitOpenErr) Error() string {
+	return fmt.Sprintf("error calling webhook: circuit breaker for %s is open until %s", e.host, e.until.Format(time.RFC3339))
+}
+
+// breakerOutcome is the result of a call, as far as a CircuitBreaker is
+// concerned
+type breakerOutcome int
+
+const (
+	outcomeSuccess breakerOutcome = iota
+	outcomeFailure
+
+	// outcomeIgnored covers calls which say nothing about the health of
+	// the receiver, such as those cancelled by the caller
+	outcomeIgnored
+)
+
+// CircuitBreaker tracks failures calling a single target host, opening
+// after a number of consecutive failures so that calls fail fast while
+// the receiver is down.
+//
+// Breakers are shared by every Process which targets the same host with
+// the same threshold and cooldown, and can be listed with CircuitBreakers
+// for monitoring. They also implement HealthChecker, reporting as not ready
+// while open.
+//
+// Calls count as failures where they fail to reach the receiver, or where
+// the response is classified as retryable; see RetryableStatusesKey and
+// BodyRulesKey. Terminal failures show the receiver is up, and so count
+// as successes
+type CircuitBreaker struct {
+	host      string
+	threshold int
+	cooldown  time.Duration
+	logger    *slog.Logger
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// breakerKey identifies the CircuitBreaker shared by Processes targeting
+// the same host with the same settings
+type breakerKey struct {
+	host      string
+	threshold int
+	cooldown  time.Duration
+}
+
+// breakers holds the CircuitBreaker of each target host and settings
+var breakers = struct {
+	sync.Mutex
+	m map[breakerKey]*CircuitBreaker
+}{m: make(map[breakerKey]*CircuitBreaker)}
+
+// CircuitBreakers returns the circuit breakers in use, ordered by host
+func CircuitBreakers() (b []*CircuitBreaker) {
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	b = make([]*CircuitBreaker, 0, len(breakers.m))
+	for _, cb := range breakers.m {
+		b = append(b, cb)
+	}
+
+	sort.Slice(b, func(i, j int) bool { return b[i].ID() < b[j].ID() })
+
+	return
+}
+
+// breakerFromConfig returns the CircuitBreaker for the host of target and
+// the configured settings, creating it if this is the first Process to
+// target that host with those settings, or nil where no breaker is
+// configured
+func breakerFromConfig(ec map[string]string, target string, logger *slog.Logger) (cb *CircuitBreaker, err error) {
+	threshold, err := intValue(ec, BreakerThresholdKey, 0)
+	if err != nil || threshold <= 0 {
+		return
+	}
+
+	cooldown, err := durationValue(ec, BreakerCooldownKey, DefaultBreakerCooldown)
+	if err != nil {
+		return
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, InvalidConfigErr{TargetURLKey, target, err}
+	}
+
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	key := breakerKey{u.Host, threshold, cooldown}
+
+	cb, ok := breakers.m[key]
+	if !ok {
+		cb = &CircuitBreaker{
+			host:      u.Host,
+			threshold: threshold,
+			cooldown:  cooldown,
+			logger:    logger,
+		}
+
+		breakers.m[key] = cb
+	}
+
+	return
+}
+
+// Host returns the target host this breaker guards
+func (b *CircuitBreaker) Host() string {
+	return b.host
+}
+
+// State returns the current state of this breaker
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
+
+// ID implements the HealthChecker interface, identifying this breaker by
+// its host and settings, since a host may have several breakers
+func (b *CircuitBreaker) ID() string {
+	return fmt.Sprintf("breaker:%s/%d/%s", b.host, b.threshold, b.cooldown)
+}
+
+// Health implements the HealthChecker interface.
+//
+// A CircuitBreaker is always live, and ready unless open
+func (b *CircuitBreaker) Health() (live, ready bool, detail map[string]any) {
+	state := b.State()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	detail = map[string]any{
+		"host":      b.host,
+		"threshold": b.threshold,
+		"cooldown":  b.cooldown.String(),
+		"state":     state.String(),
+		"failures":  b.failures,
+	}
+
+	if state != BreakerClosed {
+		detail["opened_at"] = b.openedAt
+	}
+
+	return true, state != BreakerOpen, detail
+}
+
+// allow returns a CircuitOpenErr if a call should not be made
+func (b *CircuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return CircuitOpenErr{b.host, b.openedAt.Add(b.cooldown)}
+		}
+
+		b.transition(BreakerHalfOpen)
+
+		fallthrough
+
+	case BreakerHalfOpen:
+		if b.trial {
+			return CircuitOpenErr{b.host, time.Now()}
+		}
+
+		b.trial = true
+	}
+
+	return nil
+}
+
+// record updates this breaker with the outcome of a call allowed by allow
+func (b *CircuitBreaker) record(o breakerOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	halfOpen := b.state == BreakerHalfOpen
+	b.trial = false
+
+	switch o {
+	case outcomeSuccess:
+		b.failures = 0
+		b.transition(BreakerClosed)
+
+	case outcomeFailure:
+		b.failures++
+		if halfOpen || b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			b.transition(BreakerOpen)
+		}
+	}
+}
+
+// transition moves this breaker into state s, logging the change; callers
+// must hold the lock
+func (b *CircuitBreaker) transition(s BreakerState) {
+	if b.state == s {
+		return
+	}
+
+	b.logger.Warn("circuit breaker state changed",
+		slog.String("host", b.host),
+		slog.String("from", b.state.String()),
+		slog.String("to", s.String()),
+		slog.Int("failures", b.failures),
+	)
+
+	b.state = s
+}
+
+// recordOutcome updates the circuit breaker guarding t, if any, with the
+// result of a call; err is either the error making the call, or the error
+// the response was classified as
+func (t target) recordOutcome(ctx context.Context, err error) {
+	if t.breaker == nil {
+		return
+	}
+
+	t.breaker.record(outcome(ctx, err))
+}
+
+// outcome classifies the result of a call for a CircuitBreaker; transport
+// errors and responses classified as retryable are failures, while
+// anything else shows the receiver is up
+func outcome(ctx context.Context, err error) breakerOutcome {
+	switch {
+	case err == nil, errors.As(err, new(TerminalStatusErr)):
+		return outcomeSuccess
+
+	case ctx.Err() != nil && errors.Is(err, ctx.Err()):
+		return outcomeIgnored
+	}
+
+	return outcomeFailure
+}
@@ -0,0 +1,283 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestProcess_Run_CircuitBreaker(t *testing.T) {
+	var (
+		broken   atomic.Bool
+		received atomic.Int64
+		calls    atomic.Int64
+	)
+
+	broken.Store(true)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		if broken.Load() {
+			w.WriteHeader(http.StatusBadGateway)
+
+			return
+		}
+
+		received.Add(1)
+	}))
+	defer srv.Close()
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey:        srv.URL,
+			BreakerThresholdKey: "3",
+			BreakerCooldownKey:  "50ms",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.targets[0].breaker.State() != BreakerClosed {
+		t.Fatalf("expected new breaker to be closed, received %s", p.targets[0].breaker.State())
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err = p.Run(context.Background(), orchestrator.Event{})
+		if !errors.As(err, new(BadStatusErr)) {
+			t.Fatalf("expected BadStatusErr, received %#v", err)
+		}
+	}
+
+	t.Run("opens after threshold failures", func(t *testing.T) {
+		if p.targets[0].breaker.State() != BreakerOpen {
+			t.Errorf("expected open breaker, received %s", p.targets[0].breaker.State())
+		}
+
+		ps, err := p.Run(context.Background(), orchestrator.Event{})
+		if !errors.As(err, new(CircuitOpenErr)) {
+			t.Errorf("expected CircuitOpenErr, received %#v", err)
+		}
+
+		if ps.Status != orchestrator.ProcessFail {
+			t.Errorf("expected failure, received %v", ps.Status)
+		}
+
+		if calls.Load() != 3 {
+			t.Errorf("expected open breaker to fail fast, but %d calls were made", calls.Load())
+		}
+
+		_, ready, _ := p.targets[0].breaker.Health()
+		if ready {
+			t.Error("expected open breaker not to be ready")
+		}
+	})
+
+	t.Run("shared with other processes targeting the same host", func(t *testing.T) {
+		other, err := NewProcess(orchestrator.ProcessConfig{
+			Name: "other",
+			ExecutionContext: map[string]string{
+				TargetURLKey:        srv.URL + "/elsewhere",
+				BreakerThresholdKey: "3",
+				BreakerCooldownKey:  "50ms",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = other.Run(context.Background(), orchestrator.Event{})
+		if !errors.As(err, new(CircuitOpenErr)) {
+			t.Errorf("expected CircuitOpenErr, received %#v", err)
+		}
+
+		// Processes with other settings get a breaker of their own,
+		// rather than inheriting those of the first Process
+		differing, err := NewProcess(orchestrator.ProcessConfig{
+			Name: "differing",
+			ExecutionContext: map[string]string{
+				TargetURLKey:        srv.URL + "/elsewhere",
+				BreakerThresholdKey: "100",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if differing.targets[0].breaker == p.targets[0].breaker || differing.targets[0].breaker.State() != BreakerClosed {
+			t.Errorf("expected a separate, closed, breaker")
+		}
+
+		found := false
+		for _, cb := range CircuitBreakers() {
+			found = found || cb == p.targets[0].breaker
+		}
+
+		if !found {
+			t.Error("expected breaker to be listed")
+		}
+	})
+
+	t.Run("failed trial reopens", func(t *testing.T) {
+		time.Sleep(time.Millisecond * 60)
+
+		if p.targets[0].breaker.State() != BreakerHalfOpen {
+			t.Errorf("expected half-open breaker, received %s", p.targets[0].breaker.State())
+		}
+
+		_, err := p.Run(context.Background(), orchestrator.Event{})
+		if !errors.As(err, new(BadStatusErr)) {
+			t.Errorf("expected BadStatusErr, received %#v", err)
+		}
+
+		if p.targets[0].breaker.State() != BreakerOpen {
+			t.Errorf("expected open breaker, received %s", p.targets[0].breaker.State())
+		}
+	})
+
+	t.Run("successful trial closes", func(t *testing.T) {
+		broken.Store(false)
+		time.Sleep(time.Millisecond * 60)
+
+		_, err := p.Run(context.Background(), orchestrator.Event{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.targets[0].breaker.State() != BreakerClosed {
+			t.Errorf("expected closed breaker, received %s", p.targets[0].breaker.State())
+		}
+
+		_, err = p.Run(context.Background(), orchestrator.Event{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if received.Load() != 2 {
+			t.Errorf("expected 2 deliveries, received %d", received.Load())
+		}
+	})
+}
+
+func TestProcess_Run_CircuitBreakerClassified(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		status     int
+		body       string
+		ec         map[string]string
+		opts       []ProcessOption
+		expectOpen bool
+	}{
+		{"retryable body on a 200", http.StatusOK, `{"status":"overloaded"}`, map[string]string{}, []ProcessOption{WithBodyRules(BodyRule{Field: "status", Value: "overloaded", Class: ClassRetryable})}, true},
+		{"terminal 503", http.StatusServiceUnavailable, "", map[string]string{TerminalStatusesKey: "503"}, nil, false},
+		{"retryable 429", http.StatusTooManyRequests, "", map[string]string{}, nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				io.WriteString(w, test.body)
+			}))
+			defer srv.Close()
+
+			test.ec[TargetURLKey] = srv.URL
+			test.ec[BreakerThresholdKey] = "2"
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			}, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				p.Run(context.Background(), orchestrator.Event{})
+			}
+
+			if open := p.targets[0].breaker.State() == BreakerOpen; open != test.expectOpen {
+				t.Errorf("expected open %v, received %s", test.expectOpen, p.targets[0].breaker.State())
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_HalfOpenAllowsSingleTrial(t *testing.T) {
+	cb := &CircuitBreaker{host: "example.com", threshold: 1, cooldown: time.Millisecond, logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	cb.allow()
+	cb.record(outcomeFailure)
+
+	time.Sleep(time.Millisecond * 2)
+
+	if err := cb.allow(); err != nil {
+		t.Fatalf("expected trial call to be allowed, received %#v", err)
+	}
+
+	if err := cb.allow(); !errors.As(err, new(CircuitOpenErr)) {
+		t.Errorf("expected CircuitOpenErr while trial in flight, received %#v", err)
+	}
+
+	// Cancelled calls say nothing about the receiver, but free up the
+	// trial slot
+	cb.record(outcomeIgnored)
+
+	if err := cb.allow(); err != nil {
+		t.Errorf("expected another trial call to be allowed, received %#v", err)
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, test := range []struct {
+		name   string
+		ctx    context.Context
+		err    error
+		expect breakerOutcome
+	}{
+		{"success", context.Background(), nil, outcomeSuccess},
+		{"terminal failure", context.Background(), TerminalStatusErr{}, outcomeSuccess},
+		{"retryable failure", context.Background(), RetryableStatusErr{}, outcomeFailure},
+		{"transport error", context.Background(), errors.New("connection refused"), outcomeFailure},
+		{"cancelled", cancelled, context.Canceled, outcomeIgnored},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if o := outcome(test.ctx, test.err); o != test.expect {
+				t.Errorf("expected %d, received %d", test.expect, o)
+			}
+		})
+	}
+}
+
+func TestNewProcess_BreakerConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"invalid threshold", map[string]string{BreakerThresholdKey: "some"}},
+		{"invalid cooldown", map[string]string{BreakerThresholdKey: "5", BreakerCooldownKey: "a while"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://breaker-config.example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ExecutionContext keys used to record and replay the calls a Process
+// makes, so that pipelines can be tested offline
+const (
+	// CassetteKey sets the path of a cassette file, into which calls are
+	// recorded, or from which they are replayed, depending on
+	// CassetteModeKey
+	CassetteKey = "cassette"
+
+	// CassetteModeKey is one of "record" or "replay". The default is
+	// "replay"
+	CassetteModeKey = "cassette_mode"
+
+	// CassetteMatchersKey lists, comma separated, which parts of a
+	// request must match a recorded request for it to be replayed, from
+	// "method", "url", and "body". The default is all three
+	CassetteMatchersKey = "cassette_matchers"
+
+	// CassetteRedactedHeadersKey lists, comma separated, headers whose
+	// values are never written to the cassette, alongside
+	// DefaultRedactedHeaders
+	CassetteRedactedHeadersKey = "cassette_redacted_headers"
+)
+
+// CassetteMode sets whether a Cassette records or replays calls
+type CassetteMode int
+
+const (
+	// CassetteReplay serves recorded responses, making no calls
+	CassetteReplay CassetteMode = iota
+
+	// CassetteRecord makes calls as normal, recording each request and
+	// response into the cassette file
+	CassetteRecord
+)
+
+// DefaultRedactedHeaders are the request and response headers whose values
+// are never written to a cassette.
+//
+// The credentials a Process is configured with, such as static headers
+// set via HeaderKeyPrefix, are redacted wherever they appear, regardless
+var DefaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"X-Api-Key",
+}
+
+// NoInteractionErr is returned when replaying a request which matches no
+// unplayed interaction in a cassette
+type NoInteractionErr struct{ method, url string }
+
+// Error returns the error text for this error
+func (e NoInteractionErr) Error() string {
+	return fmt.Sprintf("no recorded interaction matches %s %s", e.method, e.url)
+}
+
+// RecordedRequest is a request as stored in a cassette.
+//
+// For requests made by a Process, Body is the payload before any multipart
+// wrapping or compression, so that it is readable, and so that it matches
+// between recording and replay. Bodies which aren't valid UTF-8 are stored
+// base64 encoded, with BodyEncoding set to "base64"
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// RecordedResponse is a response as stored in a cassette, with its Body
+// stored as for a RecordedRequest
+type RecordedResponse struct {
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// base64Body is the BodyEncoding of bodies which aren't valid UTF-8
+const base64Body = "base64"
+
+// encodeBody returns b as stored in a cassette, along with its encoding
+func encodeBody(b []byte) (body, encoding string) {
+	if utf8.Valid(b) {
+		return string(b), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(b), base64Body
+}
+
+// decodeBody reverses encodeBody
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+
+	case base64Body:
+		return base64.StdEncoding.DecodeString(body)
+	}
+
+	return nil, fmt.Errorf("unknown body encoding %q", encoding)
+}
+
+// body returns the body of r, as sent. Cassettes are checked for bodies
+// which can't be decoded when they're read
+func (r RecordedRequest) body() []byte {
+	b, _ := decodeBody(r.Body, r.BodyEncoding)
+
+	return b
+}
+
+// Interaction is a single request and the response it received
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// Matcher decides whether a request, with body, matches a recorded one
+type Matcher func(r *http.Request, body []byte, recorded RecordedRequest) bool
+
+// MatchMethod matches requests with the same method
+func MatchMethod(r *http.Request, _ []byte, recorded RecordedRequest) bool {
+	return r.Method == recorded.Method
+}
+
+// MatchURL matches requests to the same URL, including the query string
+func MatchURL(r *http.Request, _ []byte, recorded RecordedRequest) bool {
+	return r.URL.String() == recorded.URL
+}
+
+// MatchBody matches requests with the same body. Where both bodies are
+// JSON they need only be equivalent, ignoring formatting and key order
+func MatchBody(_ *http.Request, body []byte, recorded RecordedRequest) bool {
+	rb := recorded.body()
+	if bytes.Equal(body, rb) {
+		return true
+	}
+
+	var a, b any
+	if json.Unmarshal(body, &a) != nil || json.Unmarshal(rb, &b) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+var matchers = map[string]Matcher{
+	"method": MatchMethod,
+	"url":    MatchURL,
+	"body":   MatchBody,
+}
+
+// CassetteOption configures optional behaviour of a Cassette
+type CassetteOption func(*Cassette)
+
+// WithMatchers sets the Matchers a request must satisfy to replay a
+// recorded interaction, in place of MatchMethod, MatchURL, and MatchBody
+func WithMatchers(m ...Matcher) CassetteOption {
+	return func(c *Cassette) {
+		c.matchers = m
+	}
+}
+
+// WithRedactedHeaders adds to the headers whose values are never written
+// to a cassette, alongside DefaultRedactedHeaders
+func WithRedactedHeaders(headers ...string) CassetteOption {
+	return func(c *Cassette) {
+		for _, h := range headers {
+			c.redacted[http.CanonicalHeaderKey(h)] = true
+		}
+	}
+}
+
+// Cassette records the calls made by Processes configured WithCassette into
+// a file, or replays them from it.
+//
+// When replaying, each interaction is served once, in the order recorded,
+// so that repeated identical requests receive the responses they did when
+// recorded
+type Cassette struct {
+	path     string
+	mode     CassetteMode
+	matchers []Matcher
+	redacted map[string]bool
+
+	mu           sync.Mutex
+	secrets      []string
+	interactions []Interaction
+	played       []bool
+}
+
+// NewCassette returns a Cassette for the file at path.
+//
+// In CassetteReplay mode the file must already exist; in CassetteRecord
+// mode it is created, or truncated, so that each recording starts afresh
+func NewCassette(path string, mode CassetteMode, opts ...CassetteOption) (c *Cassette, err error) {
+	c = &Cassette{
+		path:         path,
+		mode:         mode,
+		matchers:     []Matcher{MatchMethod, MatchURL, MatchBody},
+		redacted:     make(map[string]bool),
+		interactions: make([]Interaction, 0),
+	}
+
+	for _, h := range DefaultRedactedHeaders {
+		c.redacted[h] = true
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if mode == CassetteRecord {
+		return c, c.save()
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(b, &c.interactions)
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+	}
+
+	for _, in := range c.interactions {
+		_, err = decodeBody(in.Request.Body, in.Request.BodyEncoding)
+		if err == nil {
+			_, err = decodeBody(in.Response.Body, in.Response.BodyEncoding)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("reading cassette %s: %w", path, err)
+		}
+	}
+
+	c.played = make([]bool, len(c.interactions))
+
+	return
+}
+
+// Interactions returns the interactions held by this Cassette
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// WithCassette records or replays every call a Process makes via Cassette
+// c, wrapping whichever http.Client the Process would otherwise use
+func WithCassette(c *Cassette) ProcessOption {
+	return func(p *Process) {
+		p.cassette = c
+	}
+}
+
+// addSecrets adds to the values redacted from everything this Cassette
+// records
+func (c *Cassette) addSecrets(secrets []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.secrets = append(c.secrets, secrets...)
+}
+
+// cassettes holds the Cassettes opened via CassetteKey, by path, so that
+// Processes sharing a file share a Cassette
+var cassettes = struct {
+	sync.Mutex
+	m map[string]openCassette
+}{m: make(map[string]openCassette)}
+
+// openCassette is a Cassette opened via CassetteKey, along with the
+// configuration it was opened with, which any other Process sharing the
+// file must match
+type openCassette struct {
+	*Cassette
+
+	config string
+}
+
+// cassetteFromConfig returns the Cassette configured via CassetteKey, if
+// any, opening it if this is the first Process to use that file
+func cassetteFromConfig(ec map[string]string) (c *Cassette, err error) {
+	path, ok := ec[CassetteKey]
+	if !ok {
+		return
+	}
+
+	mode := CassetteReplay
+	switch v := ec[CassetteModeKey]; v {
+	case "", "replay":
+	case "record":
+		mode = CassetteRecord
+	default:
+		return nil, InvalidConfigErr{CassetteModeKey, v, fmt.Errorf("must be one of record or replay")}
+	}
+
+	var (
+		opts   []CassetteOption
+		names  []string
+		header []string
+	)
+
+	if v, ok := ec[CassetteMatchersKey]; ok {
+		var m []Matcher
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+
+			f, ok := matchers[name]
+			if !ok {
+				return nil, InvalidConfigErr{CassetteMatchersKey, v, fmt.Errorf("unknown matcher %q", name)}
+			}
+
+			m = append(m, f)
+			names = append(names, name)
+		}
+
+		opts = append(opts, WithMatchers(m...))
+	}
+
+	if v, ok := ec[CassetteRedactedHeadersKey]; ok {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				header = append(header, http.CanonicalHeaderKey(h))
+			}
+		}
+
+		sort.Strings(header)
+
+		opts = append(opts, WithRedactedHeaders(header...))
+	}
+
+	config := fmt.Sprintf("mode=%d matchers=%s redacted=%s", mode, strings.Join(names, ","), strings.Join(header, ","))
+
+	cassettes.Lock()
+	defer cassettes.Unlock()
+
+	open, ok := cassettes.m[path]
+	if ok {
+		if open.config != config {
+			return nil, InvalidConfigErr{CassetteKey, path, fmt.Errorf("already opened by another Process with a different %s, %s, or %s", CassetteModeKey, CassetteMatchersKey, CassetteRedactedHeadersKey)}
+		}
+
+		return open.Cassette, nil
+	}
+
+	c, err = NewCassette(path, mode, opts...)
+	if err != nil {
+		return nil, InvalidConfigErr{CassetteKey, path, err}
+	}
+
+	cassettes.m[path] = openCassette{c, config}
+
+	return
+}
+
+// transport returns an http.RoundTripper which records calls made via next,
+// or replays them
+func (c *Cassette) transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return cassetteTransport{c, next}
+}
+
+type cassetteTransport struct {
+	c    *Cassette
+	next http.RoundTripper
+}
+
+// cassettePayloadKey holds the payload of a request made by a Process,
+// before any multipart wrapping or compression
+type cassettePayloadKey struct{}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t cassetteTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+
+		if err != nil {
+			return
+		}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// Multipart boundaries are random, and compressed bodies unreadable,
+	// so record and match on what was encoded instead
+	if payload, ok := req.Context().Value(cassettePayloadKey{}).([]byte); ok {
+		body = payload
+	}
+
+	if t.c.mode == CassetteReplay {
+		// Recorded bodies had secrets redacted, so those being
+		// matched must too
+		return t.c.replay(req, []byte(t.c.redactSecrets(string(body))))
+	}
+
+	resp, err = t.next.RoundTrip(req)
+	if err != nil {
+		return
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	in := Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: t.c.redact(req.Header),
+		},
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: t.c.redact(resp.Header),
+		},
+	}
+
+	in.Request.Body, in.Request.BodyEncoding = encodeBody([]byte(t.c.redactSecrets(string(body))))
+	in.Response.Body, in.Response.BodyEncoding = encodeBody([]byte(t.c.redactSecrets(string(respBody))))
+
+	return resp, t.c.record(in)
+}
+
+func (c *Cassette) replay(req *http.Request, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, in := range c.interactions {
+		if c.played[i] || !c.match(req, body, in.Request) {
+			continue
+		}
+
+		c.played[i] = true
+
+		// Checked when the cassette was read
+		body, _ := decodeBody(in.Response.Body, in.Response.BodyEncoding)
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, NoInteractionErr{req.Method, req.URL.String()}
+}
+
+func (c *Cassette) match(req *http.Request, body []byte, recorded RecordedRequest) bool {
+	for _, m := range c.matchers {
+		if !m(req, body, recorded) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Cassette) record(in Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, in)
+
+	return c.save()
+}
+
+// save writes every interaction to the cassette file; callers must hold
+// the lock, or otherwise have sole access to c
+func (c *Cassette) save() (err error) {
+	b, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(c.path, append(b, '\n'), fs.FileMode(0600))
+}
+
+// redact returns a copy of h with the values of redacted headers replaced,
+// and secrets replaced in the values of the rest
+func (c *Cassette) redact(h http.Header) http.Header {
+	out := h.Clone()
+
+	for k, v := range out {
+		for i := range v {
+			if c.redacted[http.CanonicalHeaderKey(k)] {
+				v[i] = redacted
+			} else {
+				v[i] = c.redactSecrets(v[i])
+			}
+		}
+	}
+
+	return out
+}
+
+// redactSecrets replaces the secrets of every Process using this Cassette
+// in s
+func (c *Cassette) redactSecrets(s string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return redactSecrets(s, c.secrets)
+}
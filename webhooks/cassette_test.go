@@ -0,0 +1,361 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestCassette_RecordReplay(t *testing.T) {
+	var calls atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+
+		w.Header().Set("Set-Cookie", "session=abc123")
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		// Echo a credential back, as some APIs do in errors
+		w.Write([]byte(r.Header.Get("X-Partner-Key")))
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ec := map[string]string{
+		TargetURLKey:                      srv.URL + "/hook?x=1",
+		HeaderKeyPrefix + "Authorization": "Bearer sekrit",
+		HeaderKeyPrefix + "X-Partner-Key": "also-sekrit",
+	}
+
+	e := orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate, ID: "1"}
+
+	run := func(t *testing.T, c *Cassette) (errs []error) {
+		t.Helper()
+
+		p, err := NewProcess(orchestrator.ProcessConfig{Name: "tests", ExecutionContext: ec}, WithCassette(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 2; i++ {
+			_, err = p.Run(context.Background(), e)
+			errs = append(errs, err)
+		}
+
+		return
+	}
+
+	rec, err := NewCassette(path, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := run(t, rec)
+	srv.Close()
+
+	if calls.Load() != 2 || len(rec.Interactions()) != 2 {
+		t.Fatalf("expected 2 calls to be recorded, received %d calls and %d interactions", calls.Load(), len(rec.Interactions()))
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"sekrit", "abc123"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("expected %q to be redacted from cassette\n%s", secret, b)
+		}
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		c, err := NewCassette(path, CassetteReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		replayed := run(t, c)
+
+		for i := range recorded {
+			if (recorded[i] == nil) != (replayed[i] == nil) {
+				t.Errorf("call %d: recorded %v, replayed %v", i, recorded[i], replayed[i])
+			}
+		}
+
+		if !errors.As(replayed[0], new(RetryableStatusErr)) {
+			t.Errorf("expected recorded 503 to be replayed, received %#v", replayed[0])
+		}
+	})
+
+	t.Run("replay beyond recording", func(t *testing.T) {
+		c, err := NewCassette(path, CassetteReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errs := append(run(t, c), run(t, c)...)
+		if !errors.As(errs[2], new(NoInteractionErr)) {
+			t.Errorf("expected error of type %T, received %#v", NoInteractionErr{}, errs[2])
+		}
+	})
+
+	t.Run("unmatched body", func(t *testing.T) {
+		c, err := NewCassette(path, CassetteReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := NewProcess(orchestrator.ProcessConfig{Name: "tests", ExecutionContext: ec}, WithCassette(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = p.Run(context.Background(), orchestrator.Event{Location: "elsewhere", Operation: orchestrator.OperationCreate})
+		if !errors.As(err, new(NoInteractionErr)) {
+			t.Errorf("expected error of type %T, received %#v", NoInteractionErr{}, err)
+		}
+	})
+}
+
+func TestCassette_Config(t *testing.T) {
+	srv := bodyServer(t, http.StatusAccepted, "")
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	for _, mode := range []string{"record", "replay"} {
+		// Forget the cassette opened by the previous mode
+		cassettes.Lock()
+		delete(cassettes.m, path)
+		cassettes.Unlock()
+
+		p, err := NewProcess(orchestrator.ProcessConfig{
+			Name: "tests",
+			ExecutionContext: map[string]string{
+				TargetURLKey:        srv.URL,
+				CassetteKey:         path,
+				CassetteModeKey:     mode,
+				CassetteMatchersKey: "method, url",
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if mode == "replay" {
+			srv.Close()
+		}
+
+		_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: mode})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", mode, err)
+		}
+	}
+}
+
+func TestCassette_RecordReplay_Encoded(t *testing.T) {
+	// Responds with a body which isn't valid UTF-8
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte{0x1f, 0x8b, 0xff, 0x00})
+	}))
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	e := orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate, ID: "1"}
+
+	run := func(t *testing.T, c *Cassette) {
+		t.Helper()
+
+		p, err := NewProcess(orchestrator.ProcessConfig{
+			Name: "tests",
+			ExecutionContext: map[string]string{
+				TargetURLKey:          srv.URL,
+				ContentEncodingKey:    "gzip",
+				MultipartThresholdKey: "1",
+			},
+		}, WithCassette(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = p.Run(context.Background(), e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec, err := NewCassette(path, CassetteRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, rec)
+	srv.Close()
+
+	in := rec.Interactions()[0]
+	if !strings.Contains(in.Request.Body, `"orders"`) || in.Request.BodyEncoding != "" {
+		t.Errorf("expected the payload to be recorded before encoding, received %#v", in.Request)
+	}
+
+	if in.Response.BodyEncoding != "base64" {
+		t.Errorf("expected the response body to be recorded as base64, received %#v", in.Response)
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		c, err := NewCassette(path, CassetteReplay)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		run(t, c)
+	})
+
+	t.Run("binary response", func(t *testing.T) {
+		c, err := NewCassette(path, CassetteReplay, WithMatchers(MatchMethod))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := (&http.Client{Transport: c.transport(nil)}).Post(srv.URL, "application/json", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(b, []byte{0x1f, 0x8b, 0xff, 0x00}) {
+			t.Errorf("expected the recorded response body, received %v", b)
+		}
+	})
+}
+
+func TestCassette_RedactedHeadersKey(t *testing.T) {
+	srv := bodyServer(t, http.StatusAccepted, "")
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey:               srv.URL,
+			CassetteKey:                path,
+			CassetteModeKey:            "record",
+			CassetteRedactedHeadersKey: "x-secret-header, X-Rate-Limit-Remaining",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCassette(path, CassetteReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := c.Interactions()[0].Response.Headers
+	for _, name := range []string{"X-Secret-Header", "X-Rate-Limit-Remaining"} {
+		if h.Get(name) != redacted {
+			t.Errorf("expected %s to be redacted from cassette, received %q", name, h.Get(name))
+		}
+	}
+}
+
+func TestCassette_SharedConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	open := func(matchers string) (*Process, error) {
+		p, err := NewProcess(orchestrator.ProcessConfig{
+			Name: "tests",
+			ExecutionContext: map[string]string{
+				TargetURLKey:        "https://example.com",
+				CassetteKey:         path,
+				CassetteModeKey:     "record",
+				CassetteMatchersKey: matchers,
+			},
+		})
+
+		return &p, err
+	}
+
+	a, err := open("method,url")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := open("method, url")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.cassette != b.cassette {
+		t.Error("expected processes with the same cassette config to share a cassette")
+	}
+
+	_, err = open("method")
+	if !errors.As(err, new(InvalidConfigErr)) {
+		t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+	}
+}
+
+func TestMatchBody(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		body     string
+		recorded string
+		expect   bool
+	}{
+		{"identical", `hello`, `hello`, true},
+		{"different", `hello`, `goodbye`, false},
+		{"equivalent json", `{"a":1,"b":[1,2]}`, "{\n  \"b\": [1, 2],\n  \"a\": 1\n}", true},
+		{"different json", `{"a":1}`, `{"a":2}`, false},
+		{"empty", ``, ``, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if received := MatchBody(nil, []byte(test.body), RecordedRequest{Body: test.recorded}); received != test.expect {
+				t.Errorf("expected %v, received %v", test.expect, received)
+			}
+		})
+	}
+}
+
+func TestNewProcess_CassetteConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"missing replay file", map[string]string{CassetteKey: filepath.Join(dir, "missing.json")}},
+		{"unknown mode", map[string]string{CassetteKey: filepath.Join(dir, "a.json"), CassetteModeKey: "rewind"}},
+		{"unknown matcher", map[string]string{CassetteKey: filepath.Join(dir, "b.json"), CassetteMatchersKey: "method,headers"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
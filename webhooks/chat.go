@@ -0,0 +1,236 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// MessageTemplateKey sets the text/template used to render the message
+// sent by the chat Processes created with NewSlackProcess, NewTeamsProcess,
+// and NewDiscordProcess, such as:
+//
+//	"{{.Process}}: {{.Operation}} of {{.ID}} in {{.Location}}"
+//
+// The template is executed against a MessageData, whose values are escaped
+// for the target platform first, so the template itself may use that
+// platform's formatting. The default is DefaultMessageTemplate
+const MessageTemplateKey = "template"
+
+// DefaultMessageTemplate is the message template used when no
+// MessageTemplateKey is set
+const DefaultMessageTemplate = "{{.Operation}} of {{.ID}} in {{.Location}}{{with .Trigger}} (triggered by {{.}}){{end}}"
+
+// Maximum message lengths, in characters, for each chat platform. Longer
+// messages are truncated to fit
+const (
+	SlackMaxMessageLength   = 3000
+	TeamsMaxMessageLength   = 20000
+	DiscordMaxMessageLength = 2000
+)
+
+// MessageData is the data a message template is executed against
+type MessageData struct {
+	Process   string
+	Location  string
+	Operation string
+	ID        string
+	Trigger   string
+	RequestID string
+}
+
+// chatFormat describes how messages are escaped and sent to a single chat
+// platform
+type chatFormat struct {
+	maxLength int
+
+	// escape escapes a value for the platform's markup
+	escape func(string) string
+
+	// trim removes any escape sequence left incomplete by truncation
+	trim func(string) string
+
+	// body builds the payload for a rendered message
+	body func(msg string, data MessageData) any
+}
+
+// NewSlackProcess is an orchestrator.NewProcessFunc which configures a
+// Process sending a message to a Slack incoming webhook, set via
+// TargetURLKey, rendered from MessageTemplateKey.
+//
+// Values are escaped for Slack's mrkdwn, and messages are truncated to
+// SlackMaxMessageLength
+func NewSlackProcess(pc orchestrator.ProcessConfig, opts ...ProcessOption) (Process, error) {
+	return newChatProcess(pc, slackFormat, opts)
+}
+
+// NewTeamsProcess is an orchestrator.NewProcessFunc which configures a
+// Process sending an Adaptive Card to a Microsoft Teams incoming webhook or
+// workflow, set via TargetURLKey. The card holds the message rendered from
+// MessageTemplateKey, followed by the details of the Event.
+//
+// Values are escaped for Adaptive Card markdown, and messages are
+// truncated to TeamsMaxMessageLength
+func NewTeamsProcess(pc orchestrator.ProcessConfig, opts ...ProcessOption) (Process, error) {
+	return newChatProcess(pc, teamsFormat, opts)
+}
+
+// NewDiscordProcess is an orchestrator.NewProcessFunc which configures a
+// Process sending a message to a Discord webhook, set via TargetURLKey,
+// rendered from MessageTemplateKey.
+//
+// Values are escaped for Discord markdown, mentions are disabled so that
+// Events can't ping anybody, and messages are truncated to
+// DiscordMaxMessageLength
+func NewDiscordProcess(pc orchestrator.ProcessConfig, opts ...ProcessOption) (Process, error) {
+	return newChatProcess(pc, discordFormat, opts)
+}
+
+func newChatProcess(pc orchestrator.ProcessConfig, f chatFormat, opts []ProcessOption) (p Process, err error) {
+	text := DefaultMessageTemplate
+	if v, ok := pc.ExecutionContext[MessageTemplateKey]; ok {
+		text = v
+	}
+
+	tmpl, err := template.New(pc.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return p, InvalidConfigErr{MessageTemplateKey, text, err}
+	}
+
+	return NewProcess(pc, append(opts, WithPayload(f.payload(pc.Name, tmpl)))...)
+}
+
+// payload returns a PayloadFunc rendering Events with tmpl
+func (f chatFormat) payload(process string, tmpl *template.Template) PayloadFunc {
+	return func(ctx context.Context, e orchestrator.Event) ([]byte, error) {
+		id, _ := RequestIDFromContext(ctx)
+
+		data := MessageData{
+			Process:   f.escape(process),
+			Location:  f.escape(e.Location),
+			Operation: f.escape(e.Operation.String()),
+			ID:        f.escape(e.ID),
+			Trigger:   f.escape(e.Trigger),
+			RequestID: f.escape(id),
+		}
+
+		sb := new(strings.Builder)
+
+		err := tmpl.Execute(sb, data)
+		if err != nil {
+			return nil, fmt.Errorf("rendering message: %w", err)
+		}
+
+		return json.Marshal(f.body(f.truncate(sb.String()), data))
+	}
+}
+
+// truncate shortens msg to the platform's maximum length, marking where it
+// was cut with an ellipsis
+func (f chatFormat) truncate(msg string) string {
+	if utf8.RuneCountInString(msg) <= f.maxLength {
+		return msg
+	}
+
+	r := []rune(msg)[:f.maxLength-1]
+
+	return f.trim(string(r)) + "…"
+}
+
+var slackFormat = chatFormat{
+	maxLength: SlackMaxMessageLength,
+	escape:    strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace,
+	trim: func(s string) string {
+		if amp := strings.LastIndexByte(s, '&'); amp > strings.LastIndexByte(s, ';') {
+			return s[:amp]
+		}
+
+		return s
+	},
+	body: func(msg string, _ MessageData) any {
+		return map[string]any{
+			"text": msg,
+			"blocks": []any{
+				map[string]any{
+					"type": "section",
+					"text": map[string]any{"type": "mrkdwn", "text": msg},
+				},
+			},
+		}
+	},
+}
+
+var teamsFormat = chatFormat{
+	maxLength: TeamsMaxMessageLength,
+	escape:    markdownEscaper(`\*_[]()#-+!>`),
+	trim:      trimBackslash,
+	body: func(msg string, data MessageData) any {
+		facts := make([]any, 0, 4)
+		for _, f := range [][2]string{
+			{"Location", data.Location},
+			{"Operation", data.Operation},
+			{"ID", data.ID},
+			{"Trigger", data.Trigger},
+		} {
+			if f[1] != "" {
+				facts = append(facts, map[string]any{"title": f[0], "value": f[1]})
+			}
+		}
+
+		return map[string]any{
+			"type": "message",
+			"attachments": []any{
+				map[string]any{
+					"contentType": "application/vnd.microsoft.card.adaptive",
+					"content": map[string]any{
+						"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+						"type":    "AdaptiveCard",
+						"version": "1.4",
+						"body": []any{
+							map[string]any{"type": "TextBlock", "text": msg, "wrap": true},
+							map[string]any{"type": "FactSet", "facts": facts},
+						},
+					},
+				},
+			},
+		}
+	},
+}
+
+var discordFormat = chatFormat{
+	maxLength: DiscordMaxMessageLength,
+	escape:    markdownEscaper("\\*_~`|>#-[]()"),
+	trim:      trimBackslash,
+	body: func(msg string, _ MessageData) any {
+		return map[string]any{
+			"content":          msg,
+			"allowed_mentions": map[string]any{"parse": []string{}},
+		}
+	},
+}
+
+// markdownEscaper returns a function which backslash escapes each of chars
+func markdownEscaper(chars string) func(string) string {
+	pairs := make([]string, 0, len(chars)*2)
+	for _, c := range chars {
+		pairs = append(pairs, string(c), `\`+string(c))
+	}
+
+	return strings.NewReplacer(pairs...).Replace
+}
+
+// trimBackslash removes a trailing backslash which no longer escapes
+// anything
+func trimBackslash(s string) string {
+	n := len(s) - len(strings.TrimRight(s, `\`))
+	if n%2 == 1 {
+		return s[:len(s)-1]
+	}
+
+	return s
+}
@@ -0,0 +1,200 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// chatServer decodes the JSON body of each request into the value
+// returned by the channel
+func chatServer(t *testing.T) (*httptest.Server, chan map[string]any) {
+	t.Helper()
+
+	c := make(chan map[string]any, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("expected json content type, received %q", ct)
+		}
+
+		b, _ := io.ReadAll(r.Body)
+
+		var v map[string]any
+		if err := json.Unmarshal(b, &v); err != nil {
+			t.Errorf("invalid body %q: %v", b, err)
+		}
+
+		c <- v
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, c
+}
+
+// path walks a decoded JSON value by map key and slice index
+func path(v any, keys ...any) any {
+	for _, k := range keys {
+		switch k := k.(type) {
+		case string:
+			m, _ := v.(map[string]any)
+			v = m[k]
+
+		case int:
+			s, _ := v.([]any)
+			if k >= len(s) {
+				return nil
+			}
+
+			v = s[k]
+		}
+	}
+
+	return v
+}
+
+func TestChatProcesses(t *testing.T) {
+	e := orchestrator.Event{
+		Location:  "orders<script>",
+		Operation: orchestrator.OperationCreate,
+		ID:        "*1*",
+		Trigger:   "pg",
+	}
+
+	for _, test := range []struct {
+		name     string
+		f        func(orchestrator.ProcessConfig, ...ProcessOption) (Process, error)
+		template string
+		message  []any
+		expect   string
+	}{
+		{"slack default template", NewSlackProcess, "", []any{"text"}, "create of *1* in orders&lt;script&gt; (triggered by pg)"},
+		{"slack blocks", NewSlackProcess, "*{{.Process}}*: {{.ID}}", []any{"blocks", 0, "text", "text"}, "*chat*: *1*"},
+		{"teams card", NewTeamsProcess, "", []any{"attachments", 0, "content", "body", 0, "text"}, `create of \*1\* in orders<script\> (triggered by pg)`},
+		{"teams facts", NewTeamsProcess, "", []any{"attachments", 0, "content", "body", 1, "facts", 0, "value"}, `orders<script\>`},
+		{"discord", NewDiscordProcess, "**{{.Location}}** @everyone", []any{"content"}, `**orders<script\>** @everyone`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv, c := chatServer(t)
+
+			ec := map[string]string{TargetURLKey: srv.URL}
+			if test.template != "" {
+				ec[MessageTemplateKey] = test.template
+			}
+
+			p, err := test.f(orchestrator.ProcessConfig{
+				Name:             "chat",
+				ExecutionContext: ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.Run(context.Background(), e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body := <-c
+
+			if received := path(body, test.message...); received != test.expect {
+				t.Errorf("expected %q, received %q", test.expect, received)
+			}
+		})
+	}
+}
+
+func TestNewDiscordProcess_DisablesMentions(t *testing.T) {
+	srv, c := chatServer(t)
+
+	p, err := NewDiscordProcess(orchestrator.ProcessConfig{
+		Name:             "chat",
+		ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse, ok := path(<-c, "allowed_mentions", "parse").([]any)
+	if !ok || len(parse) != 0 {
+		t.Errorf("expected mentions to be disabled, received %#v", parse)
+	}
+}
+
+func TestChatFormat_Truncate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		f      chatFormat
+		value  string
+		expect string
+	}{
+		{"short messages are untouched", discordFormat, "hello", "hello"},
+		{"long messages are cut", discordFormat, strings.Repeat("a", 3000), strings.Repeat("a", DiscordMaxMessageLength-1) + "…"},
+		{"multibyte characters are counted once", discordFormat, strings.Repeat("é", 3000), strings.Repeat("é", DiscordMaxMessageLength-1) + "…"},
+		{"partial slack entities are dropped", slackFormat, strings.Repeat("a", SlackMaxMessageLength-3) + "&lt;", strings.Repeat("a", SlackMaxMessageLength-3) + "…"},
+		{"dangling backslashes are dropped", discordFormat, strings.Repeat("a", DiscordMaxMessageLength-2) + `\*b`, strings.Repeat("a", DiscordMaxMessageLength-2) + "…"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			received := test.f.truncate(test.value)
+			if received != test.expect {
+				t.Errorf("expected %d characters, received %d", utf8.RuneCountInString(test.expect), utf8.RuneCountInString(received))
+			}
+
+			if utf8.RuneCountInString(received) > test.f.maxLength {
+				t.Errorf("message exceeds %d characters", test.f.maxLength)
+			}
+		})
+	}
+}
+
+func TestNewChatProcess_InvalidTemplate(t *testing.T) {
+	for _, f := range []func(orchestrator.ProcessConfig, ...ProcessOption) (Process, error){
+		NewSlackProcess, NewTeamsProcess, NewDiscordProcess,
+	} {
+		_, err := f(orchestrator.ProcessConfig{
+			Name: "chat",
+			ExecutionContext: map[string]string{
+				TargetURLKey:       "https://example.com",
+				MessageTemplateKey: "{{.Location",
+			},
+		})
+		if !errors.As(err, new(InvalidConfigErr)) {
+			t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+		}
+	}
+}
+
+func TestChatProcess_UnknownTemplateField(t *testing.T) {
+	p, err := NewSlackProcess(orchestrator.ProcessConfig{
+		Name: "chat",
+		ExecutionContext: map[string]string{
+			TargetURLKey:       "https://example.com",
+			MessageTemplateKey: "{{.Nope}}",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{})
+	if err == nil {
+		t.Fatal("expected error, received none")
+	}
+
+	if ps.Status != orchestrator.ProcessUnstarted {
+		t.Errorf("expected process to be unstarted, received %v", ps.Status)
+	}
+}
@@ -0,0 +1,376 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ExecutionContext keys used to configure how a Process classifies the
+// responses it receives. Status lists are comma separated codes and
+// ranges, such as "404,409,500-599"
+const (
+	// SuccessStatusesKey lists statuses treated as success, in addition
+	// to 2xx
+	SuccessStatusesKey = "success_statuses"
+
+	// RetryableStatusesKey lists statuses treated as retryable failures,
+	// in place of DefaultRetryableStatuses
+	RetryableStatusesKey = "retryable_statuses"
+
+	// TerminalStatusesKey lists statuses treated as terminal failures.
+	// Any status not otherwise classified is terminal, so this is only
+	// needed to override the defaults, such as to treat a 2xx as a
+	// failure, or a 503 as not worth retrying.
+	//
+	// Where a status appears in several lists, success beats terminal,
+	// which beats retryable
+	TerminalStatusesKey = "terminal_statuses"
+
+	// BodyRulesKey lists rules which classify responses by a field in their
+	// JSON body, as a JSON array of BodyRules, where field is a dot
+	// separated path and class is one of "success", "retryable", or
+	// "terminal", such as:
+	//
+	//	[{"field": "status", "value": "failed", "class": "terminal"},
+	//	 {"field": "error.code", "value": "RATE_LIMITED", "class": "retryable"}]
+	//
+	// Values are compared as strings, so that numbers and booleans match
+	// their JSON form, such as "42" or "true", and null matches "null"
+	//
+	// Body rules take precedence over status codes, and the first rule
+	// to match wins
+	BodyRulesKey = "body_rules"
+)
+
+// DefaultRetryableStatuses are the statuses treated as retryable failures
+// when no RetryableStatusesKey is set
+const DefaultRetryableStatuses = "408,425,429,500-599"
+
+// Class is the classification of a response
+type Class int
+
+const (
+	// ClassSuccess responses are successful deliveries
+	ClassSuccess Class = iota
+
+	// ClassRetryable responses are failures which may succeed if the
+	// delivery is tried again later, and produce a RetryableStatusErr
+	ClassRetryable
+
+	// ClassTerminal responses are failures which will never succeed, and
+	// produce a TerminalStatusErr
+	ClassTerminal
+)
+
+// String returns the name of a Class
+func (c Class) String() string {
+	switch c {
+	case ClassSuccess:
+		return "success"
+
+	case ClassRetryable:
+		return "retryable"
+
+	case ClassTerminal:
+		return "terminal"
+	}
+
+	return "unknown"
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (c Class) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface,
+// accepting the names returned by String
+func (c *Class) UnmarshalText(b []byte) (err error) {
+	*c, err = parseClass(string(b))
+
+	return
+}
+
+func parseClass(s string) (c Class, err error) {
+	for c = ClassSuccess; c <= ClassTerminal; c++ {
+		if c.String() == s {
+			return
+		}
+	}
+
+	return 0, fmt.Errorf("unknown class %q", s)
+}
+
+// RetryableStatusErr is returned when a response is classified as a
+// retryable failure.
+//
+// It wraps a BadStatusErr, and so can also be matched as one
+type RetryableStatusErr struct {
+	BadStatusErr
+	reason string
+}
+
+// Error returns the error text for this error
+func (e RetryableStatusErr) Error() string {
+	return e.BadStatusErr.Error() + e.reason
+}
+
+// Unwrap returns the underlying BadStatusErr
+func (e RetryableStatusErr) Unwrap() error {
+	return e.BadStatusErr
+}
+
+// TerminalStatusErr is returned when a response is classified as a
+// terminal failure.
+//
+// It wraps a BadStatusErr, and so can also be matched as one
+type TerminalStatusErr struct {
+	BadStatusErr
+	reason string
+}
+
+// Error returns the error text for this error
+func (e TerminalStatusErr) Error() string {
+	return e.BadStatusErr.Error() + e.reason
+}
+
+// Unwrap returns the underlying BadStatusErr
+func (e TerminalStatusErr) Unwrap() error {
+	return e.BadStatusErr
+}
+
+// BodyRule classifies responses whose JSON body has Field (a dot separated
+// path) set to Value
+type BodyRule struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Class Class  `json:"class"`
+}
+
+// match returns whether the decoded JSON body v matches this rule
+func (r BodyRule) match(v any) bool {
+	for _, k := range strings.Split(r.Field, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return false
+		}
+
+		v, ok = m[k]
+		if !ok {
+			return false
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v == r.Value
+
+	case json.Number, bool:
+		return fmt.Sprint(v) == r.Value
+
+	case nil:
+		return r.Value == "null"
+	}
+
+	return false
+}
+
+// WithBodyRules adds rules which classify responses by the contents of
+// their JSON body, after any set via BodyRulesKey
+func WithBodyRules(rules ...BodyRule) ProcessOption {
+	return func(p *Process) {
+		p.classifier.body = append(p.classifier.body, rules...)
+	}
+}
+
+// statusRange is an inclusive range of status codes
+type statusRange struct{ min, max int }
+
+type statusRanges []statusRange
+
+func (s statusRanges) contains(status int) bool {
+	for _, r := range s {
+		if status >= r.min && status <= r.max {
+			return true
+		}
+	}
+
+	return false
+}
+
+// classifier decides the Class of a response
+type classifier struct {
+	success   statusRanges
+	retryable statusRanges
+	terminal  statusRanges
+	body      []BodyRule
+
+	// graphQL marks otherwise successful responses as terminal where
+	// they aren't GraphQL responses, or carry errors
+	graphQL bool
+}
+
+func classifierFromConfig(ec map[string]string) (c classifier, err error) {
+	for key, field := range map[string]*statusRanges{
+		SuccessStatusesKey:   &c.success,
+		RetryableStatusesKey: &c.retryable,
+		TerminalStatusesKey:  &c.terminal,
+	} {
+		*field, err = statusesValue(ec, key)
+		if err != nil {
+			return
+		}
+	}
+
+	if _, ok := ec[RetryableStatusesKey]; !ok {
+		c.retryable, _ = parseStatuses(DefaultRetryableStatuses)
+	}
+
+	v, ok := ec[BodyRulesKey]
+	if !ok {
+		return
+	}
+
+	d := json.NewDecoder(strings.NewReader(v))
+	d.DisallowUnknownFields()
+
+	err = d.Decode(&c.body)
+	if err != nil {
+		return c, InvalidConfigErr{BodyRulesKey, v, err}
+	}
+
+	for _, br := range c.body {
+		if br.Field == "" {
+			return c, InvalidConfigErr{BodyRulesKey, v, fmt.Errorf("rule %+v has no field", br)}
+		}
+	}
+
+	return
+}
+
+func statusesValue(ec map[string]string, key string) (s statusRanges, err error) {
+	v, ok := ec[key]
+	if !ok {
+		return
+	}
+
+	s, err = parseStatuses(v)
+	if err != nil {
+		err = InvalidConfigErr{key, v, err}
+	}
+
+	return
+}
+
+func parseStatuses(v string) (s statusRanges, err error) {
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		lo, hi, isRange := strings.Cut(part, "-")
+
+		var r statusRange
+
+		r.min, err = strconv.Atoi(lo)
+		if err != nil {
+			return
+		}
+
+		r.max = r.min
+		if isRange {
+			r.max, err = strconv.Atoi(hi)
+			if err != nil {
+				return
+			}
+		}
+
+		if r.min > r.max {
+			return nil, fmt.Errorf("invalid range %q", part)
+		}
+
+		s = append(s, r)
+	}
+
+	return
+}
+
+// classify returns nil for successful responses, and otherwise either a
+// RetryableStatusErr or a TerminalStatusErr. body is the (possibly
+// truncated) response body, where read
+func (c classifier) classify(url string, resp *http.Response, body []byte) error {
+	class, reason := c.class(resp.StatusCode, body)
+
+	bse := BadStatusErr{redactURL(url), resp.Status}
+
+	switch class {
+	case ClassRetryable:
+		return RetryableStatusErr{bse, reason}
+
+	case ClassTerminal:
+		return TerminalStatusErr{bse, reason}
+	}
+
+	return nil
+}
+
+func (c classifier) class(status int, body []byte) (Class, string) {
+	if len(c.body) > 0 && len(body) > 0 {
+		var v any
+
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+
+		if dec.Decode(&v) == nil {
+			for _, r := range c.body {
+				if r.match(v) {
+					return r.Class, fmt.Sprintf(": body field %s is %q", r.Field, r.Value)
+				}
+			}
+		}
+	}
+
+	class := c.statusClass(status)
+	if class != ClassSuccess || !c.graphQL {
+		return class, ""
+	}
+
+	r, ok := graphQLResponse(body)
+	if !ok {
+		return ClassTerminal, ": response is not a graphql response"
+	}
+
+	if len(r.Errors) > 0 {
+		msgs := make([]string, len(r.Errors))
+		for i, e := range r.Errors {
+			msgs[i] = e.Message
+		}
+
+		return ClassTerminal, ": graphql errors: " + strings.Join(msgs, "; ")
+	}
+
+	return ClassSuccess, ""
+}
+
+func (c classifier) statusClass(status int) Class {
+	switch {
+	case c.success.contains(status):
+		return ClassSuccess
+
+	case c.terminal.contains(status):
+		return ClassTerminal
+
+	case c.retryable.contains(status):
+		return ClassRetryable
+
+	case status/100 == 2:
+		return ClassSuccess
+	}
+
+	return ClassTerminal
+}
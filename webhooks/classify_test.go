@@ -0,0 +1,107 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestProcess_Run_Classification(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		status      int
+		body        string
+		ec          map[string]string
+		opts        []ProcessOption
+		expectError error
+	}{
+		{"2xx succeeds by default", http.StatusCreated, "", nil, nil, nil},
+		{"404 is terminal by default", http.StatusNotFound, "", nil, nil, TerminalStatusErr{}},
+		{"429 is retryable by default", http.StatusTooManyRequests, "", nil, nil, RetryableStatusErr{}},
+		{"503 is retryable by default", http.StatusServiceUnavailable, "", nil, nil, RetryableStatusErr{}},
+		{"409 as success", http.StatusConflict, "", map[string]string{SuccessStatusesKey: "404, 409"}, nil, nil},
+		{"404 as success", http.StatusNotFound, "", map[string]string{SuccessStatusesKey: "404,409"}, nil, nil},
+		{"503 as terminal", http.StatusServiceUnavailable, "", map[string]string{TerminalStatusesKey: "501-503"}, nil, TerminalStatusErr{}},
+		{"custom retryable list", http.StatusServiceUnavailable, "", map[string]string{RetryableStatusesKey: "502"}, nil, TerminalStatusErr{}},
+		{"202 as terminal", http.StatusAccepted, "", map[string]string{TerminalStatusesKey: "202"}, nil, TerminalStatusErr{}},
+		{"body rule marks 200 as terminal", http.StatusOK, `{"status":"failed"}`, map[string]string{BodyRulesKey: `[{"field":"status","value":"failed","class":"terminal"}]`}, nil, TerminalStatusErr{}},
+		{"nested body rule marks 200 as retryable", http.StatusOK, `{"error":{"code":"RATE_LIMITED"}}`, map[string]string{BodyRulesKey: `[{"field":"status","value":"failed","class":"terminal"}, {"field":"error.code","value":"RATE_LIMITED","class":"retryable"}]`}, nil, RetryableStatusErr{}},
+		{"body rule values may contain separators", http.StatusOK, `{"error":"a:b, c=d"}`, map[string]string{BodyRulesKey: `[{"field":"error","value":"a:b, c=d","class":"terminal"}]`}, nil, TerminalStatusErr{}},
+		{"body rule marks 409 as success", http.StatusConflict, `{"duplicate":true}`, map[string]string{BodyRulesKey: `[{"field":"duplicate","value":"true","class":"success"}]`}, nil, nil},
+		{"unmatched body rule falls back to status", http.StatusOK, `{"status":"ok"}`, map[string]string{BodyRulesKey: `[{"field":"status","value":"failed","class":"terminal"}]`}, nil, nil},
+		{"body rule against non-json body", http.StatusOK, `status=failed`, map[string]string{BodyRulesKey: `[{"field":"status","value":"failed","class":"terminal"}]`}, nil, nil},
+		{"numeric body rule via option", http.StatusOK, `{"code":42}`, nil, []ProcessOption{WithBodyRules(BodyRule{Field: "code", Value: "42", Class: ClassRetryable})}, RetryableStatusErr{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ec := map[string]string{TargetURLKey: bodyServer(t, test.status, test.body).URL}
+			for k, v := range test.ec {
+				ec[k] = v
+			}
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: ec,
+			}, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := p.Run(context.Background(), orchestrator.Event{})
+			if err == nil && test.expectError != nil {
+				t.Fatalf("expected error, received none")
+			} else if err != nil && test.expectError == nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			if err == nil {
+				if ps.Status != orchestrator.ProcessSuccess {
+					t.Errorf("expected success, received %v", ps.Status)
+				}
+
+				return
+			}
+
+			if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", test.expectError) {
+				t.Errorf("expected error of type %T, received %T", test.expectError, err)
+			}
+
+			if !errors.As(err, new(BadStatusErr)) {
+				t.Errorf("expected %T to wrap BadStatusErr", err)
+			}
+
+			if ps.Status != orchestrator.ProcessFail {
+				t.Errorf("expected failure, received %v", ps.Status)
+			}
+		})
+	}
+}
+
+func TestNewProcess_ClassificationConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"invalid status", map[string]string{SuccessStatusesKey: "four-oh-four"}},
+		{"invalid range", map[string]string{TerminalStatusesKey: "599-500"}},
+		{"malformed body rule", map[string]string{BodyRulesKey: "status=failed:terminal"}},
+		{"body rule without field", map[string]string{BodyRulesKey: `[{"value":"failed","class":"terminal"}]`}},
+		{"unknown body rule key", map[string]string{BodyRulesKey: `[{"feild":"status","value":"failed","class":"terminal"}]`}},
+		{"unknown body rule class", map[string]string{BodyRulesKey: `[{"field":"status","value":"failed","class":"fatal"}]`}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
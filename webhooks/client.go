@@ -0,0 +1,216 @@
+package webhooks
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ExecutionContext keys used to configure the HTTP client a Process
+// sends requests with; all are optional, and sit alongside TargetURLKey and
+// MethodKey
+const (
+	// TimeoutKey sets the overall timeout of a request, including
+	// connecting, any redirects, and reading the response, as
+	// a duration string such as "10s"
+	//
+	// By default requests do not time out
+	TimeoutKey = "timeout"
+
+	// CAFileKey points to a PEM encoded bundle of certificate authorities
+	// to trust, in addition to the system roots
+	CAFileKey = "ca_file"
+
+	// ClientCertKey and ClientKeyKey point to a PEM encoded certificate
+	// and private key, respectively, presented to servers which require
+	// mutual TLS. Both must be set together
+	ClientCertKey = "client_cert"
+	ClientKeyKey  = "client_key"
+
+	// ProxyURLKey sets the URL of a proxy to send requests via, or the
+	// value "none" to send requests directly.
+	//
+	// By default proxies are configured from the environment, via
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	ProxyURLKey = "proxy_url"
+
+	// MaxIdleConnsKey, MaxIdleConnsPerHostKey, and MaxConnsPerHostKey size
+	// the connection pool, as per the fields of the same name on
+	// http.Transport
+	MaxIdleConnsKey        = "max_idle_conns"
+	MaxIdleConnsPerHostKey = "max_idle_conns_per_host"
+	MaxConnsPerHostKey     = "max_conns_per_host"
+
+	// IdleConnTimeoutKey sets how long idle connections are kept in
+	// the pool for, as a duration string such as "90s"
+	IdleConnTimeoutKey = "idle_conn_timeout"
+)
+
+// maxDrain is the most of a response body read, and thrown away, in order
+// to return a connection to the pool; larger responses close the connection
+const maxDrain = 64 << 10
+
+// InvalidConfigErr is returned when an ExecutionContext value can't be
+// parsed, or points to a file which can't be loaded
+type InvalidConfigErr struct {
+	key, value string
+	err        error
+}
+
+// Error returns the error text for this error
+func (e InvalidConfigErr) Error() string {
+	return fmt.Sprintf("error creating webhook: invalid %q config value %q: %v", e.key, e.value, e.err)
+}
+
+// Unwrap returns the underlying error
+func (e InvalidConfigErr) Unwrap() error {
+	return e.err
+}
+
+// WithHTTPClient sets the http.Client a Process sends requests with,
+// ignoring any client configuration in the ExecutionContext
+func WithHTTPClient(c *http.Client) ProcessOption {
+	return func(p *Process) {
+		p.client = c
+	}
+}
+
+// newHTTPClient builds an http.Client from an ExecutionContext
+func newHTTPClient(ec map[string]string) (c *http.Client, err error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	c = &http.Client{Transport: t}
+
+	c.Timeout, err = durationValue(ec, TimeoutKey, 0)
+	if err != nil {
+		return
+	}
+
+	t.IdleConnTimeout, err = durationValue(ec, IdleConnTimeoutKey, t.IdleConnTimeout)
+	if err != nil {
+		return
+	}
+
+	for key, field := range map[string]*int{
+		MaxIdleConnsKey:        &t.MaxIdleConns,
+		MaxIdleConnsPerHostKey: &t.MaxIdleConnsPerHost,
+		MaxConnsPerHostKey:     &t.MaxConnsPerHost,
+	} {
+		*field, err = intValue(ec, key, *field)
+		if err != nil {
+			return
+		}
+	}
+
+	t.Proxy, err = proxyValue(ec)
+	if err != nil {
+		return
+	}
+
+	t.TLSClientConfig, err = tlsConfig(ec)
+
+	return
+}
+
+func tlsConfig(ec map[string]string) (tc *tls.Config, err error) {
+	tc = new(tls.Config)
+
+	if f, ok := ec[CAFileKey]; ok {
+		var b []byte
+
+		b, err = os.ReadFile(f)
+		if err != nil {
+			return nil, InvalidConfigErr{CAFileKey, f, err}
+		}
+
+		tc.RootCAs, err = x509.SystemCertPool()
+		if err != nil {
+			tc.RootCAs = x509.NewCertPool()
+		}
+
+		if !tc.RootCAs.AppendCertsFromPEM(b) {
+			return nil, InvalidConfigErr{CAFileKey, f, fmt.Errorf("no certificates found")}
+		}
+	}
+
+	cert, certOK := ec[ClientCertKey]
+	key, keyOK := ec[ClientKeyKey]
+
+	switch {
+	case certOK && keyOK:
+		var pair tls.Certificate
+
+		pair, err = tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, InvalidConfigErr{ClientCertKey, cert, err}
+		}
+
+		tc.Certificates = []tls.Certificate{pair}
+
+	case certOK:
+		return nil, InvalidConfigErr{ClientKeyKey, "", fmt.Errorf("must be set alongside %q", ClientCertKey)}
+
+	case keyOK:
+		return nil, InvalidConfigErr{ClientCertKey, "", fmt.Errorf("must be set alongside %q", ClientKeyKey)}
+	}
+
+	return
+}
+
+func proxyValue(ec map[string]string) (func(*http.Request) (*url.URL, error), error) {
+	v, ok := ec[ProxyURLKey]
+	if !ok {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	if v == "none" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(v)
+	if err != nil || u.Host == "" {
+		return nil, InvalidConfigErr{ProxyURLKey, redactURL(v), fmt.Errorf("not a valid proxy url")}
+	}
+
+	return http.ProxyURL(u), nil
+}
+
+func durationValue(ec map[string]string, key string, def time.Duration) (time.Duration, error) {
+	v, ok := ec[key]
+	if !ok {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, InvalidConfigErr{key, v, err}
+	}
+
+	return d, nil
+}
+
+func intValue(ec map[string]string, key string, def int) (int, error) {
+	v, ok := ec[key]
+	if !ok {
+		return def, nil
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, InvalidConfigErr{key, v, err}
+	}
+
+	return i, nil
+}
+
+// drain reads and discards what remains of a response body before closing
+// it, so that the underlying connection can be reused
+func drain(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
@@ -0,0 +1,271 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// writePEM writes a PEM block of type t to a new file in dir
+func writePEM(t *testing.T, dir, name, typ string, b []byte) string {
+	t.Helper()
+
+	f := filepath.Join(dir, name)
+
+	err := os.WriteFile(f, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: b}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// clientCertificate generates a self signed client certificate, returning
+// the paths to the certificate and key, and a pool containing it
+func clientCertificate(t *testing.T, dir string) (cert, key string, pool *x509.CertPool) {
+	t.Helper()
+
+	pk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "webhooks-test-client"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &pk.PublicKey, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kb, err := x509.MarshalECPrivateKey(pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool = x509.NewCertPool()
+	pool.AddCert(parsed)
+
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", kb), pool
+}
+
+func TestNewProcess_ClientConfig(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, _ := clientCertificate(t, dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	os.WriteFile(notPEM, []byte("nope"), 0600)
+
+	for _, test := range []struct {
+		name        string
+		ec          map[string]string
+		expectError bool
+	}{
+		{"defaults are fine", map[string]string{}, false},
+		{"full config is fine", map[string]string{
+			TimeoutKey:             "5s",
+			IdleConnTimeoutKey:     "30s",
+			MaxIdleConnsKey:        "10",
+			MaxIdleConnsPerHostKey: "5",
+			MaxConnsPerHostKey:     "20",
+			ProxyURLKey:            "http://proxy.example.com:3128",
+			ClientCertKey:          cert,
+			ClientKeyKey:           key,
+		}, false},
+		{"proxy can be disabled", map[string]string{ProxyURLKey: "none"}, false},
+		{"invalid timeout", map[string]string{TimeoutKey: "a while"}, true},
+		{"invalid pool size", map[string]string{MaxConnsPerHostKey: "lots"}, true},
+		{"invalid proxy", map[string]string{ProxyURLKey: "not a proxy"}, true},
+		{"invalid proxy with credentials", map[string]string{ProxyURLKey: "http://user:s3cr3t@"}, true},
+		{"missing ca file", map[string]string{CAFileKey: filepath.Join(dir, "nonsuch.pem")}, true},
+		{"ca file without certificates", map[string]string{CAFileKey: notPEM}, true},
+		{"certificate without key", map[string]string{ClientCertKey: cert}, true},
+		{"key without certificate", map[string]string{ClientKeyKey: key}, true},
+		{"mismatched certificate and key", map[string]string{ClientCertKey: cert, ClientKeyKey: notPEM}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if err == nil && test.expectError {
+				t.Errorf("expected error, received none")
+			} else if err != nil && !test.expectError {
+				t.Errorf("unexpected error %#v", err)
+			}
+
+			if err != nil && test.expectError {
+				_ = err.Error() // does nothing but increase codecoverage /shrug
+
+				if !errors.As(err, new(InvalidConfigErr)) {
+					t.Errorf("expected error of type %T, received %T", InvalidConfigErr{}, err)
+				}
+
+				if strings.Contains(err.Error(), "s3cr3t") {
+					t.Errorf("expected credentials to be redacted, received %q", err)
+				}
+			}
+		})
+	}
+}
+
+func TestProcess_Run_TLS(t *testing.T) {
+	dir := t.TempDir()
+	cert, key, clientPool := clientCertificate(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientPool,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	ca := writePEM(t, dir, "ca.pem", "CERTIFICATE", srv.Certificate().Raw)
+
+	for _, test := range []struct {
+		name        string
+		ec          map[string]string
+		expectError bool
+	}{
+		{"untrusted server", map[string]string{ClientCertKey: cert, ClientKeyKey: key}, true},
+		{"missing client certificate", map[string]string{CAFileKey: ca}, true},
+		{"trusted server with client certificate", map[string]string{CAFileKey: ca, ClientCertKey: cert, ClientKeyKey: key}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = srv.URL
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.Run(context.Background(), orchestrator.Event{})
+			if err == nil && test.expectError {
+				t.Errorf("expected error, received none")
+			} else if err != nil && !test.expectError {
+				t.Errorf("unexpected error %#v", err)
+			}
+		})
+	}
+}
+
+func TestProcess_Run_Proxy(t *testing.T) {
+	var proxied atomic.Value
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.URL.String())
+	}))
+	defer proxy.Close()
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey: "http://webhooks.test/webhook",
+			ProxyURLKey:  proxy.URL,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Run(context.Background(), orchestrator.Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proxied.Load() != "http://webhooks.test/webhook" {
+		t.Errorf("expected request to be proxied, received %v", proxied.Load())
+	}
+}
+
+func TestProcess_Run_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Millisecond * 100)
+	}))
+	defer srv.Close()
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey: srv.URL,
+			TimeoutKey:   "10ms",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Run(context.Background(), orchestrator.Event{})
+
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("expected timeout, received %#v", err)
+	}
+}
+
+func TestProcess_Run_ReusesConnections(t *testing.T) {
+	var conns atomic.Int64
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(strings.Repeat("some response body ", 100)))
+	}))
+	srv.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		p.Run(context.Background(), orchestrator.Event{})
+	}
+
+	if conns.Load() != 1 {
+		t.Errorf("expected a single connection to be reused, %d were opened", conns.Load())
+	}
+}
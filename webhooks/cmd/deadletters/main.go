@@ -0,0 +1,170 @@
+// Command deadletters lists, inspects, discards, and redrives the dead
+// letters held by a webhooks.DeadLetterAdmin handler.
+//
+// Usage:
+//
+//	deadletters [flags] list
+//	deadletters [flags] show ID
+//	deadletters [flags] delete ID
+//	deadletters [flags] redrive ID [ID...]
+//
+// Credentials can be passed via flags, or via the environment variables
+// DEADLETTERS_TOKEN, DEADLETTERS_USERNAME, and DEADLETTERS_PASSWORD
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dapper-data/dapper-orchestrator-contrib/webhooks"
+)
+
+var (
+	addr     = flag.String("addr", envOrDefault("DEADLETTERS_ADDR", "http://localhost:8888/"), "base URL the dead letter admin handler is mounted at")
+	token    = flag.String("token", os.Getenv("DEADLETTERS_TOKEN"), "bearer token to authenticate with")
+	username = flag.String("username", os.Getenv("DEADLETTERS_USERNAME"), "username to authenticate with, via basic auth")
+	password = flag.String("password", os.Getenv("DEADLETTERS_PASSWORD"), "password to authenticate with, via basic auth")
+	timeout  = flag.Duration("timeout", time.Minute, "timeout for each call")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] list|show ID|delete ID|redrive ID [ID...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	err := run(flag.Args(), os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		flag.Usage()
+
+		return fmt.Errorf("missing command")
+	}
+
+	switch cmd, ids := args[0], args[1:]; {
+	case cmd == "list" && len(ids) == 0:
+		var dls []webhooks.DeadLetter
+
+		err = call(http.MethodGet, "dead-letters", nil, &dls)
+		if err != nil {
+			return
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tFAILED AT\tPROCESS\tSTATUS\tERROR")
+
+		for _, dl := range dls {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", dl.ID, dl.FailedAt.Format(time.RFC3339), dl.Process, dl.Status, dl.Error)
+		}
+
+		return w.Flush()
+
+	case cmd == "show" && len(ids) == 1:
+		var dl webhooks.DeadLetter
+
+		err = call(http.MethodGet, "dead-letters/"+ids[0], nil, &dl)
+		if err != nil {
+			return
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(dl)
+
+	case cmd == "delete" && len(ids) == 1:
+		return call(http.MethodDelete, "dead-letters/"+ids[0], nil, nil)
+
+	case cmd == "redrive" && len(ids) > 0:
+		err = call(http.MethodPost, "redrive", map[string][]string{"ids": ids}, nil)
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(out, "redrove %d dead letter(s)\n", len(ids))
+
+		return
+	}
+
+	flag.Usage()
+
+	return fmt.Errorf("invalid command %q", strings.Join(args, " "))
+}
+
+// call makes a request to the admin handler, encoding body and decoding
+// the response into v, where either is set
+func call(method, path string, body, v any) (err error) {
+	b := new(bytes.Buffer)
+	if body != nil {
+		err = json.NewEncoder(b).Encode(body)
+		if err != nil {
+			return
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimSuffix(*addr, "/")+"/"+path, b)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	switch {
+	case *token != "":
+		req.Header.Set("Authorization", "Bearer "+*token)
+
+	case *username != "":
+		req.SetBasicAuth(*username, *password)
+	}
+
+	resp, err := (&http.Client{Timeout: *timeout}).Do(req)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg := new(struct {
+			Error string `json:"error"`
+		})
+
+		json.NewDecoder(resp.Body).Decode(msg)
+		if msg.Error == "" {
+			msg.Error = resp.Status
+		}
+
+		return fmt.Errorf("%s %s: %s", method, path, msg.Error)
+	}
+
+	if v != nil {
+		err = json.NewDecoder(resp.Body).Decode(v)
+	}
+
+	return
+}
+
+func envOrDefault(v, d string) string {
+	s := os.Getenv(v)
+	if s != "" {
+		return s
+	}
+
+	return d
+}
@@ -0,0 +1,315 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// ExecutionContext keys used to configure the credentials a Process sends
+// with each request; all are optional, and any combination may be set
+const (
+	// HeaderKeyPrefix prefixes ExecutionContext keys which set static
+	// headers on each request, such that:
+	//
+	//	webhooks.HeaderKeyPrefix + "X-Api-Key": "some-key"
+	//
+	// sets the header `X-Api-Key: some-key`.
+	//
+	// The values of headers which carry credentials, being those whose
+	// names contain any of secretHeaderWords (such as Authorization or
+	// X-Api-Key), are redacted from logs
+	HeaderKeyPrefix = "header."
+
+	// BasicUsernameKey and BasicPasswordKey set credentials sent via
+	// HTTP basic auth
+	BasicUsernameKey = "basic_username"
+	BasicPasswordKey = "basic_password"
+
+	// BearerTokenFileKey points to a file containing a token sent in an
+	// `Authorization: Bearer` header.
+	//
+	// The file is read on every request, so that tokens rotated on disk
+	// (such as kubernetes projected service account tokens) are picked up
+	// without restarting
+	BearerTokenFileKey = "bearer_token_file"
+
+	// OAuth2TokenURLKey, OAuth2ClientIDKey, and OAuth2ClientSecretKey
+	// configure the OAuth2 client credentials flow; tokens are fetched
+	// from the token URL, cached, and refreshed shortly before they expire
+	OAuth2TokenURLKey     = "oauth2_token_url"
+	OAuth2ClientIDKey     = "oauth2_client_id"
+	OAuth2ClientSecretKey = "oauth2_client_secret"
+
+	// OAuth2ScopesKey optionally sets a comma separated list of scopes to
+	// request alongside an OAuth2 token
+	OAuth2ScopesKey = "oauth2_scopes"
+)
+
+// secretHeaderWords mark the static headers whose values are credentials,
+// where they appear anywhere in a header's name, regardless of case
+var secretHeaderWords = []string{"auth", "cookie", "key", "password", "secret", "session", "signature", "token"}
+
+// Credentials add authentication to the outbound requests made by a
+// Process.
+//
+// Implementations are responsible for never returning errors which
+// contain the secrets they hold
+type Credentials interface {
+	Apply(*http.Request) error
+}
+
+// WithCredentials adds Credentials to a Process, alongside any configured
+// via the ExecutionContext. Credentials are applied in order, so later
+// Credentials take precedence where they set the same header.
+//
+// The secrets held by BasicCredentials, and by those StaticHeaders which
+// carry credentials, are redacted from logs, as with those configured via
+// the ExecutionContext
+func WithCredentials(c ...Credentials) ProcessOption {
+	return func(p *Process) {
+		p.credentials = append(p.credentials, c...)
+		p.secrets = append(p.secrets, credentialSecrets(c)...)
+	}
+}
+
+// StaticHeaders are Credentials which set fixed headers on each request,
+// such as API keys
+type StaticHeaders map[string]string
+
+// Apply implements the Credentials interface
+func (h StaticHeaders) Apply(r *http.Request) error {
+	for k, v := range h {
+		r.Header.Set(k, v)
+	}
+
+	return nil
+}
+
+// secrets returns the values of those headers in h which carry
+// credentials, as named by secretHeaderWords
+func (h StaticHeaders) secrets() (secrets []string) {
+	for k, v := range h {
+		name := strings.ToLower(k)
+
+		for _, word := range secretHeaderWords {
+			if strings.Contains(name, word) {
+				secrets = append(secrets, v)
+
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// BasicCredentials are Credentials which send a username and password via
+// HTTP basic auth
+type BasicCredentials struct {
+	Username string
+	Password string
+}
+
+// Apply implements the Credentials interface
+func (c BasicCredentials) Apply(r *http.Request) error {
+	r.SetBasicAuth(c.Username, c.Password)
+
+	return nil
+}
+
+// BearerTokenFile are Credentials which send the contents of a file as a
+// bearer token, reading it afresh on each request
+type BearerTokenFile struct {
+	Path string
+}
+
+// Apply implements the Credentials interface
+func (c BearerTokenFile) Apply(r *http.Request) error {
+	b, err := os.ReadFile(c.Path)
+	if err != nil {
+		// os.PathError only ever contains the path and the cause, and
+		// so is safe to return
+		return err
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return fmt.Errorf("bearer token file %s is empty", c.Path)
+	}
+
+	r.Header.Set("Authorization", "Bearer "+token)
+
+	return nil
+}
+
+// OAuth2Credentials are Credentials which send a token obtained from
+// an oauth2.TokenSource.
+//
+// The TokenSource is expected to cache tokens itself; those created
+// by NewOAuth2ClientCredentials do
+type OAuth2Credentials struct {
+	Source oauth2.TokenSource
+}
+
+// NewOAuth2ClientCredentials returns OAuth2Credentials which fetch tokens
+// via the client credentials flow, using client c to talk to the token
+// endpoint. Tokens are cached and refreshed shortly before they expire,
+// and are fetched under the context of the request they're needed for
+func NewOAuth2ClientCredentials(c *http.Client, cc clientcredentials.Config) OAuth2Credentials {
+	return OAuth2Credentials{Source: &clientCredentialsSource{config: cc, client: c}}
+}
+
+// Apply implements the Credentials interface
+func (c OAuth2Credentials) Apply(r *http.Request) (err error) {
+	var t *oauth2.Token
+
+	if s, ok := c.Source.(*clientCredentialsSource); ok {
+		t, err = s.tokenContext(r.Context())
+	} else {
+		t, err = c.Source.Token()
+	}
+
+	if err != nil {
+		return fmt.Errorf("fetching oauth2 token: %w", err)
+	}
+
+	t.SetAuthHeader(r)
+
+	return nil
+}
+
+// clientCredentialsSource is an oauth2.TokenSource which caches tokens
+// fetched via the client credentials flow.
+//
+// Unlike the TokenSource returned by clientcredentials.Config, which fetches
+// tokens under the context it was created with, tokens can be fetched under
+// the context of the request which needs them, so that fetching gives up
+// along with the request
+type clientCredentialsSource struct {
+	config clientcredentials.Config
+	client *http.Client
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// Token implements the oauth2.TokenSource interface
+func (s *clientCredentialsSource) Token() (*oauth2.Token, error) {
+	return s.tokenContext(context.Background())
+}
+
+func (s *clientCredentialsSource) tokenContext(ctx context.Context) (t *oauth2.Token, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Valid allows for a little clock skew, and so tokens are refreshed
+	// shortly before they expire
+	if s.token.Valid() {
+		return s.token, nil
+	}
+
+	t, err = s.config.Token(context.WithValue(ctx, oauth2.HTTPClient, s.client))
+	if err != nil {
+		return
+	}
+
+	s.token = t
+
+	return
+}
+
+// credentialsFromConfig builds Credentials from an ExecutionContext,
+// returning them alongside any secret values which must never be logged
+func credentialsFromConfig(ec map[string]string, c *http.Client) (creds []Credentials, secrets []string, err error) {
+	headers := make(StaticHeaders)
+	for k, v := range ec {
+		if h, ok := strings.CutPrefix(k, HeaderKeyPrefix); ok && h != "" {
+			headers[h] = v
+		}
+	}
+
+	if len(headers) > 0 {
+		creds = append(creds, headers)
+		secrets = append(secrets, headers.secrets()...)
+	}
+
+	if u, ok := ec[BasicUsernameKey]; ok {
+		p, ok := ec[BasicPasswordKey]
+		if !ok {
+			return nil, nil, InvalidConfigErr{BasicPasswordKey, "", fmt.Errorf("must be set alongside %q", BasicUsernameKey)}
+		}
+
+		creds = append(creds, BasicCredentials{Username: u, Password: p})
+		secrets = append(secrets, p)
+	}
+
+	if f, ok := ec[BearerTokenFileKey]; ok {
+		if _, err = os.Stat(f); err != nil {
+			return nil, nil, InvalidConfigErr{BearerTokenFileKey, f, err}
+		}
+
+		creds = append(creds, BearerTokenFile{Path: f})
+	}
+
+	if u, ok := ec[OAuth2TokenURLKey]; ok {
+		cc := clientcredentials.Config{
+			TokenURL:     u,
+			ClientID:     ec[OAuth2ClientIDKey],
+			ClientSecret: ec[OAuth2ClientSecretKey],
+		}
+
+		if cc.ClientID == "" {
+			return nil, nil, InvalidConfigErr{OAuth2ClientIDKey, "", fmt.Errorf("must be set alongside %q", OAuth2TokenURLKey)}
+		}
+
+		if s, ok := ec[OAuth2ScopesKey]; ok {
+			for _, scope := range strings.Split(s, ",") {
+				cc.Scopes = append(cc.Scopes, strings.TrimSpace(scope))
+			}
+		}
+
+		creds = append(creds, NewOAuth2ClientCredentials(c, cc))
+		secrets = append(secrets, cc.ClientSecret)
+	}
+
+	return
+}
+
+// credentialSecrets returns the secret values held by creds, where they are
+// of a type known to hold any
+func credentialSecrets(creds []Credentials) (secrets []string) {
+	for _, c := range creds {
+		switch c := c.(type) {
+		case StaticHeaders:
+			secrets = append(secrets, c.secrets()...)
+
+		case BasicCredentials:
+			secrets = append(secrets, c.Password)
+		}
+	}
+
+	return
+}
+
+// redact replaces any of the secrets a Process was configured with in s
+func (w Process) redact(s string) string {
+	return redactSecrets(s, w.secrets)
+}
+
+// redactSecrets replaces each of secrets in s
+func redactSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+
+	return s
+}
@@ -0,0 +1,376 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// tokenServer is an OAuth2 token endpoint which hands out numbered tokens,
+// valid for expiresIn seconds
+func tokenServer(t *testing.T, expiresIn int, issued *atomic.Int64) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cr3t" {
+			// echo the request back, as some badly behaved servers
+			// do, to ensure secrets are redacted from logs
+			b, _ := io.ReadAll(r.Body)
+			http.Error(w, "invalid client: "+r.Header.Get("Authorization")+" "+string(b), http.StatusUnauthorized)
+
+			return
+		}
+
+		n := issued.Add(1)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "token-" + string(rune('0'+n)),
+			"token_type":   "Bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// authServer records the Authorization and X-Api-Key headers of the last
+// request it received
+func authServer(t *testing.T, auth, apiKey *atomic.Value) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth.Store(r.Header.Get("Authorization"))
+		apiKey.Store(r.Header.Get("X-Api-Key"))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestProcess_Run_Credentials(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("file-token\n"), 0600)
+
+	var issued atomic.Int64
+	tokens := tokenServer(t, 3600, &issued)
+
+	for _, test := range []struct {
+		name         string
+		ec           map[string]string
+		expectAuth   string
+		expectAPIKey string
+	}{
+		{"no credentials", map[string]string{}, "", ""},
+		{"static headers", map[string]string{HeaderKeyPrefix + "X-Api-Key": "abc123"}, "", "abc123"},
+		{"basic auth", map[string]string{BasicUsernameKey: "user", BasicPasswordKey: "pass"}, "Basic dXNlcjpwYXNz", ""},
+		{"bearer token file", map[string]string{BearerTokenFileKey: tokenFile}, "Bearer file-token", ""},
+		{"oauth2 client credentials", map[string]string{
+			OAuth2TokenURLKey:     tokens.URL,
+			OAuth2ClientIDKey:     "client",
+			OAuth2ClientSecretKey: "s3cr3t",
+			OAuth2ScopesKey:       "read, write",
+		}, "Bearer token-1", ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var auth, apiKey atomic.Value
+
+			srv := authServer(t, &auth, &apiKey)
+			test.ec[TargetURLKey] = srv.URL
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.Run(context.Background(), orchestrator.Event{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if auth.Load() != test.expectAuth {
+				t.Errorf("expected Authorization %q, received %q", test.expectAuth, auth.Load())
+			}
+
+			if apiKey.Load() != test.expectAPIKey {
+				t.Errorf("expected X-Api-Key %q, received %q", test.expectAPIKey, apiKey.Load())
+			}
+		})
+	}
+}
+
+func TestProcess_Run_OAuth2Caching(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		expiresIn    int
+		expectIssued int64
+	}{
+		// oauth2 refreshes tokens 10s before they expire, so a token
+		// valid for a single second is always refreshed
+		{"long lived tokens are cached", 3600, 1},
+		{"expiring tokens are refreshed", 1, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				issued      atomic.Int64
+				auth, dummy atomic.Value
+			)
+
+			tokens := tokenServer(t, test.expiresIn, &issued)
+			srv := authServer(t, &auth, &dummy)
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name: "tests",
+				ExecutionContext: map[string]string{
+					TargetURLKey:          srv.URL,
+					OAuth2TokenURLKey:     tokens.URL,
+					OAuth2ClientIDKey:     "client",
+					OAuth2ClientSecretKey: "s3cr3t",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 3; i++ {
+				_, err = p.Run(context.Background(), orchestrator.Event{})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if issued.Load() != test.expectIssued {
+				t.Errorf("expected %d tokens to be issued, received %d", test.expectIssued, issued.Load())
+			}
+		})
+	}
+}
+
+func TestProcess_Run_SecretsRedacted(t *testing.T) {
+	var issued atomic.Int64
+	tokens := tokenServer(t, 3600, &issued)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		name   string
+		ec     map[string]string
+		secret string
+	}{
+		{"oauth2 errors echoing the client secret", map[string]string{
+			OAuth2TokenURLKey:     tokens.URL,
+			OAuth2ClientIDKey:     "client",
+			OAuth2ClientSecretKey: "wrong-s3cr3t",
+		}, "wrong-s3cr3t"},
+		{"bad status with a static header", map[string]string{HeaderKeyPrefix + "X-Api-Key": "abc123"}, "abc123"},
+		{"bad status with basic auth", map[string]string{BasicUsernameKey: "user", BasicPasswordKey: "pass"}, "pass"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = srv.URL
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, _ := p.Run(context.Background(), orchestrator.Event{})
+			if ps.Status != orchestrator.ProcessFail {
+				t.Errorf("expected failure, received %v", ps.Status)
+			}
+
+			if len(ps.Logs) == 0 {
+				t.Fatal("expected logs, received none")
+			}
+
+			for _, l := range ps.Logs {
+				if strings.Contains(l, test.secret) {
+					t.Errorf("secret %q leaked into logs: %q", test.secret, l)
+				}
+			}
+		})
+	}
+}
+
+func TestProcess_redact_WithCredentials(t *testing.T) {
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: "http://example.com/hook"},
+	}, WithCredentials(
+		StaticHeaders{"X-Api-Key": "opt-abc123"},
+		BasicCredentials{Username: "user", Password: "opt-pass"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := p.redact("key opt-abc123, password opt-pass")
+	for _, secret := range []string{"opt-abc123", "opt-pass"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q was not redacted: %q", secret, out)
+		}
+	}
+}
+
+func TestProcess_Run_WithCredentialsRedacted(t *testing.T) {
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: "http://example.com/hook"},
+	}, WithDryRun(), WithCredentials(
+		StaticHeaders{"X-Api-Key": "opt-abc123"},
+		BasicCredentials{Username: "user", Password: "opt-pass"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, l := range ps.Logs {
+		for _, secret := range []string{"opt-abc123", "opt-pass"} {
+			if strings.Contains(l, secret) {
+				t.Errorf("secret %q leaked into logs: %q", secret, l)
+			}
+		}
+	}
+}
+
+func TestOAuth2Credentials_Apply_RequestContext(t *testing.T) {
+	block := make(chan struct{})
+
+	tokens := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer tokens.Close()
+	defer close(block)
+
+	c := NewOAuth2ClientCredentials(tokens.Client(), clientcredentials.Config{
+		TokenURL:     tokens.URL,
+		ClientID:     "client",
+		ClientSecret: "s3cr3t",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- c.Apply(r) }()
+
+	select {
+	case err = <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, received %v", context.DeadlineExceeded, err)
+		}
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected fetching a token to give up with the request")
+	}
+}
+
+func TestProcess_Run_WithCredentials(t *testing.T) {
+	var auth, apiKey atomic.Value
+	srv := authServer(t, &auth, &apiKey)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey:                     srv.URL,
+			HeaderKeyPrefix + "X-Api-Key":    "from-config",
+			HeaderKeyPrefix + "Content-Type": "application/json",
+		},
+	}, WithCredentials(StaticHeaders{"X-Api-Key": "from-option"}, BasicCredentials{"user", "pass"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Run(context.Background(), orchestrator.Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if apiKey.Load() != "from-option" {
+		t.Errorf("expected option to take precedence, received %q", apiKey.Load())
+	}
+
+	if auth.Load() != "Basic dXNlcjpwYXNz" {
+		t.Errorf("unexpected Authorization %q", auth.Load())
+	}
+}
+
+func TestNewProcess_CredentialsConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"username without password", map[string]string{BasicUsernameKey: "user"}},
+		{"missing token file", map[string]string{BearerTokenFileKey: filepath.Join(t.TempDir(), "nonsuch")}},
+		{"token url without client id", map[string]string{OAuth2TokenURLKey: "https://example.com/token"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
+
+func TestStaticHeaders_secrets(t *testing.T) {
+	for _, test := range []struct {
+		header       string
+		expectSecret bool
+	}{
+		{"Authorization", true},
+		{"Proxy-Authorization", true},
+		{"X-Api-Key", true},
+		{"x-partner-token", true},
+		{"X-Client-Secret", true},
+		{"Cookie", true},
+		{"X-Hub-Signature", true},
+		{"Content-Type", false},
+		{"Accept", false},
+		{"X-Tenant", false},
+	} {
+		t.Run(test.header, func(t *testing.T) {
+			secrets := StaticHeaders{test.header: "value"}.secrets()
+			if (len(secrets) == 1) != test.expectSecret {
+				t.Errorf("expected secret %v, received %#v", test.expectSecret, secrets)
+			}
+		})
+	}
+}
@@ -0,0 +1,553 @@
+package webhooks
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// DefaultDeadLetterTable is the table a PostgresDeadLetterStore uses when
+// created with an empty table name
+const DefaultDeadLetterTable = "webhook_dead_letters"
+
+// UnknownDeadLetterErr is returned when a DeadLetterStore is asked for a
+// dead letter it does not hold
+type UnknownDeadLetterErr struct{ id string }
+
+// Error returns the error text for this error
+func (e UnknownDeadLetterErr) Error() string {
+	return fmt.Sprintf("unknown dead letter %q", e.id)
+}
+
+// UnknownProcessErr is returned when redriving a dead letter whose Process
+// was not passed to NewDeadLetterAdmin
+type UnknownProcessErr struct{ process string }
+
+// Error returns the error text for this error
+func (e UnknownProcessErr) Error() string {
+	return fmt.Sprintf("unknown process %q", e.process)
+}
+
+// DryRunRedriveErr is returned when redriving a dead letter via a Process
+// which is dry running; since nothing would be sent, the dead letter is left
+// in place
+type DryRunRedriveErr struct{ process string }
+
+// Error returns the error text for this error
+func (e DryRunRedriveErr) Error() string {
+	return fmt.Sprintf("process %q is dry running", e.process)
+}
+
+// DeadLetter is a delivery a Process failed to make, as recorded in a
+// DeadLetterStore
+type DeadLetter struct {
+	ID        string             `json:"id"`
+	RequestID string             `json:"request_id"`
+	Process   string             `json:"process"`
+	Method    string             `json:"method"`
+	Target    string             `json:"target"`
+	Event     orchestrator.Event `json:"event"`
+	FailedAt  time.Time          `json:"failed_at"`
+
+	// Status is the HTTP status the target responded with, or zero
+	// where no response was received
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error"`
+}
+
+// DeadLetterStore persists the deliveries a Process failed to make, so
+// that they can be inspected and redriven once the receiver is fixed
+type DeadLetterStore interface {
+	Put(context.Context, DeadLetter) error
+
+	// List returns every dead letter held, newest first
+	List(context.Context) ([]DeadLetter, error)
+
+	// Get and Delete return an UnknownDeadLetterErr for IDs which
+	// aren't held
+	Get(ctx context.Context, id string) (DeadLetter, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// WithDeadLetterStore records every failed delivery a Process makes into
+// DeadLetterStore s
+func WithDeadLetterStore(s DeadLetterStore) ProcessOption {
+	return func(p *Process) {
+		p.deadLetters = s
+	}
+}
+
+// FileDeadLetterStore is a DeadLetterStore which writes dead letters to a
+// local file as newline delimited JSON.
+//
+// It is safe for concurrent use within a single process, but the file
+// should not be shared between several
+type FileDeadLetterStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileDeadLetterStore returns a FileDeadLetterStore writing to path,
+// creating it if it does not already exist
+func NewFileDeadLetterStore(path string) (s *FileDeadLetterStore, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return
+	}
+
+	return &FileDeadLetterStore{path: path}, f.Close()
+}
+
+// Put implements the DeadLetterStore interface
+func (s *FileDeadLetterStore) Put(_ context.Context, d DeadLetter) (err error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(append(b, '\n'))
+
+	return errors.Join(err, f.Close())
+}
+
+// List implements the DeadLetterStore interface
+func (s *FileDeadLetterStore) List(context.Context) (d []DeadLetter, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.read()
+	if err != nil {
+		return
+	}
+
+	d = make([]DeadLetter, len(all))
+	for i := range all {
+		d[len(d)-1-i] = all[i]
+	}
+
+	return
+}
+
+// Get implements the DeadLetterStore interface
+func (s *FileDeadLetterStore) Get(_ context.Context, id string) (d DeadLetter, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.read()
+	if err != nil {
+		return
+	}
+
+	for _, d = range all {
+		if d.ID == id {
+			return
+		}
+	}
+
+	return DeadLetter{}, UnknownDeadLetterErr{id}
+}
+
+// Delete implements the DeadLetterStore interface, rewriting the file
+// without the specified dead letter
+func (s *FileDeadLetterStore) Delete(_ context.Context, id string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, err := s.read()
+	if err != nil {
+		return
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return
+	}
+
+	defer os.Remove(f.Name())
+
+	found := false
+	enc := json.NewEncoder(f)
+	for _, d := range all {
+		if d.ID == id {
+			found = true
+
+			continue
+		}
+
+		err = enc.Encode(d)
+		if err != nil {
+			f.Close()
+
+			return
+		}
+	}
+
+	err = f.Close()
+	if err != nil {
+		return
+	}
+
+	if !found {
+		return UnknownDeadLetterErr{id}
+	}
+
+	return os.Rename(f.Name(), s.path)
+}
+
+// read returns every dead letter in the file, oldest first; callers must
+// hold the lock
+func (s *FileDeadLetterStore) read() (d []DeadLetter, err error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	d = make([]DeadLetter, 0)
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var dl DeadLetter
+
+		err = json.Unmarshal(sc.Bytes(), &dl)
+		if err != nil {
+			return
+		}
+
+		d = append(d, dl)
+	}
+
+	return d, sc.Err()
+}
+
+// PostgresDeadLetterStore is a DeadLetterStore which writes dead letters to
+// a Postgres table.
+//
+// It accepts a *sql.DB so that callers can use whichever driver they
+// already depend on, such as github.com/lib/pq
+type PostgresDeadLetterStore struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresDeadLetterStore returns a PostgresDeadLetterStore writing to
+// table, creating it if it does not already exist.
+//
+// An empty table uses DefaultDeadLetterTable
+func NewPostgresDeadLetterStore(ctx context.Context, db *sql.DB, table string) (s PostgresDeadLetterStore, err error) {
+	if table == "" {
+		table = DefaultDeadLetterTable
+	}
+
+	s.db = db
+	s.table = quoteIdentifier(table)
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    id         text PRIMARY KEY,
+    request_id text NOT NULL,
+    process    text NOT NULL,
+    method     text NOT NULL,
+    target     text NOT NULL,
+    event      jsonb NOT NULL,
+    failed_at  timestamptz NOT NULL,
+    status     integer NOT NULL,
+    error      text NOT NULL
+)`, s.table))
+
+	return
+}
+
+// Put implements the DeadLetterStore interface
+func (s PostgresDeadLetterStore) Put(ctx context.Context, d DeadLetter) (err error) {
+	e, err := json.Marshal(d.Event)
+	if err != nil {
+		return
+	}
+
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, request_id, process, method, target, event, failed_at, status, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`, s.table),
+		d.ID, d.RequestID, d.Process, d.Method, d.Target, e, d.FailedAt, d.Status, d.Error,
+	)
+
+	return
+}
+
+// List implements the DeadLetterStore interface
+func (s PostgresDeadLetterStore) List(ctx context.Context) (d []DeadLetter, err error) {
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`SELECT id, request_id, process, method, target, event, failed_at, status, error FROM %s ORDER BY failed_at DESC`, s.table))
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	d = make([]DeadLetter, 0)
+	for rows.Next() {
+		var dl DeadLetter
+
+		dl, err = scanDeadLetter(rows)
+		if err != nil {
+			return
+		}
+
+		d = append(d, dl)
+	}
+
+	return d, rows.Err()
+}
+
+// Get implements the DeadLetterStore interface
+func (s PostgresDeadLetterStore) Get(ctx context.Context, id string) (d DeadLetter, err error) {
+	d, err = scanDeadLetter(s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT id, request_id, process, method, target, event, failed_at, status, error FROM %s WHERE id = $1`, s.table), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = UnknownDeadLetterErr{id}
+	}
+
+	return
+}
+
+// Delete implements the DeadLetterStore interface
+func (s PostgresDeadLetterStore) Delete(ctx context.Context, id string) (err error) {
+	res, err := s.db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, s.table), id)
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = UnknownDeadLetterErr{id}
+	}
+
+	return
+}
+
+func scanDeadLetter(row interface{ Scan(...any) error }) (d DeadLetter, err error) {
+	var e []byte
+
+	err = row.Scan(&d.ID, &d.RequestID, &d.Process, &d.Method, &d.Target, &e, &d.FailedAt, &d.Status, &d.Error)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(e, &d.Event)
+
+	return
+}
+
+// quoteIdentifier quotes a (possibly schema qualified) table name for
+// use in a query
+func quoteIdentifier(s string) string {
+	parts := strings.Split(s, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// DeadLetterAdmin is an http.Handler which exposes the contents of a
+// DeadLetterStore, allowing dead letters to be listed, inspected, redriven,
+// and discarded.
+//
+// It serves the following routes, relative to wherever it is mounted:
+//
+//	GET    /dead-letters               list dead letters, newest first
+//	GET    /dead-letters/{id}          inspect a single dead letter
+//	DELETE /dead-letters/{id}          discard a single dead letter
+//	POST   /dead-letters/{id}/redrive  redrive a single dead letter
+//	POST   /redrive                    redrive the dead letters in the body {"ids": [...]}
+//
+// As with Admin, it doesn't expose an HTTP server of its own, and so would
+// usually be mounted beneath a prefix, which is stripped before the routes
+// above are matched, with something like:
+//
+//	http.Handle("/dlq/", http.StripPrefix("/dlq", dla))
+//
+// such that dead letters are listed at /dlq/dead-letters, and redriven in
+// bulk at /dlq/redrive; the deadletters command is then pointed at /dlq/
+type DeadLetterAdmin struct {
+	store     DeadLetterStore
+	auth      Authenticator
+	processes map[string]Process
+}
+
+// NewDeadLetterAdmin returns a DeadLetterAdmin handler for DeadLetterStore
+// s, protected by Authenticator a, which redrives dead letters via the
+// Processes which originally failed to deliver them
+func NewDeadLetterAdmin(s DeadLetterStore, a Authenticator, processes ...Process) (admin DeadLetterAdmin, err error) {
+	if a == nil {
+		err = MissingAuthenticatorErr{}
+
+		return
+	}
+
+	admin.store = s
+	admin.auth = a
+	admin.processes = make(map[string]Process)
+
+	for _, p := range processes {
+		admin.processes[p.ID()] = p
+	}
+
+	return
+}
+
+// Redrive re-sends the Events of the specified dead letters via the
+// Processes which originally failed to deliver them, in the order given,
+// and with the same request IDs.
+//
+// Dead letters are removed from the store once redriven, and are refused
+// with a DryRunRedriveErr while their Process is dry running; where a redrive
+// fails, and the Process is itself configured with a DeadLetterStore, the
+// new failure replaces the original
+func (a DeadLetterAdmin) Redrive(ctx context.Context, ids ...string) (err error) {
+	for _, id := range ids {
+		var d DeadLetter
+
+		d, err = a.store.Get(ctx, id)
+		if err != nil {
+			return
+		}
+
+		p, ok := a.processes[d.Process]
+		if !ok {
+			return UnknownProcessErr{d.Process}
+		}
+
+		if p.isDryRun() {
+			return DryRunRedriveErr{d.Process}
+		}
+
+		// Where a Process fans out to several targets, only the one
+		// which failed is redriven
+		p = p.only(d.Target)
+
+		_, runErr := p.Run(ContextWithRequestID(ctx, d.RequestID), d.Event)
+		if runErr != nil && p.deadLetters == nil {
+			return runErr
+		}
+
+		err = a.store.Delete(ctx, id)
+		if err != nil {
+			return
+		}
+
+		if runErr != nil {
+			return runErr
+		}
+	}
+
+	return
+}
+
+// only returns a copy of w which delivers solely to the target with url u,
+// or w itself where it has no such target
+func (w Process) only(u string) Process {
+	for _, t := range w.targets {
+		if t.url == u {
+			w.targets = []target{t}
+
+			break
+		}
+	}
+
+	return w
+}
+
+// ServeHTTP implements the http.Handler interface
+func (a DeadLetterAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requireAuth(a.auth, a.route)(w, r)
+}
+
+func (a DeadLetterAdmin) route(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 1 && parts[0] == "dead-letters":
+		d, err := a.store.List(r.Context())
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, d)
+
+	case r.Method == http.MethodGet && len(parts) == 2 && parts[0] == "dead-letters":
+		d, err := a.store.Get(r.Context(), parts[1])
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, d)
+
+	case r.Method == http.MethodDelete && len(parts) == 2 && parts[0] == "dead-letters":
+		err := a.store.Delete(r.Context(), parts[1])
+		if err != nil {
+			writeError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "dead-letters" && parts[2] == "redrive":
+		a.redrive(w, r, []string{parts[1]})
+
+	case r.Method == http.MethodPost && len(parts) == 1 && parts[0] == "redrive":
+		body := new(struct {
+			IDs []string `json:"ids"`
+		})
+
+		err := json.NewDecoder(r.Body).Decode(body)
+		if err != nil || len(body.IDs) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		a.redrive(w, r, body.IDs)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a DeadLetterAdmin) redrive(w http.ResponseWriter, r *http.Request, ids []string) {
+	err := a.Redrive(r.Context(), ids...)
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]string{"redriven": ids})
+}
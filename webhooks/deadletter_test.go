@@ -0,0 +1,451 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	_ "github.com/lib/pq"
+)
+
+func TestFileDeadLetterStore(t *testing.T) {
+	s, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testDeadLetterStore(t, s)
+
+	t.Run("survives reopening", func(t *testing.T) {
+		s2, err := NewFileDeadLetterStore(s.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, _ := s2.List(context.Background())
+		if len(d) != 2 {
+			t.Errorf("expected 2 dead letters, received %d", len(d))
+		}
+	})
+}
+
+func TestPostgresDeadLetterStore(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	s, err := NewPostgresDeadLetterStore(ctx, db, "test_dead_letters")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Exec("DROP TABLE test_dead_letters") })
+
+	testDeadLetterStore(t, s)
+
+	t.Run("survives reopening", func(t *testing.T) {
+		s2, err := NewPostgresDeadLetterStore(ctx, db, "test_dead_letters")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, _ := s2.List(ctx)
+		if len(d) != 2 {
+			t.Errorf("expected 2 dead letters, received %d", len(d))
+		}
+	})
+}
+
+// testDeadLetterStore runs the tests every DeadLetterStore should pass
+// against s, which must start empty, and is left holding dead letters a
+// and c
+func testDeadLetterStore(t *testing.T, s DeadLetterStore) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	for i, id := range []string{"a", "b", "c"} {
+		err := s.Put(ctx, DeadLetter{ID: id, Event: orchestrator.Event{ID: id, Operation: orchestrator.OperationCreate}, FailedAt: now.Add(time.Duration(i) * time.Millisecond)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("list is newest first", func(t *testing.T) {
+		d, err := s.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(d) != 3 || d[0].ID != "c" || d[2].ID != "a" {
+			t.Errorf("unexpected dead letters %#v", d)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		d, err := s.Get(ctx, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if d.Event.ID != "b" || d.Event.Operation != orchestrator.OperationCreate {
+			t.Errorf("unexpected dead letter %#v", d)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		err := s.Delete(ctx, "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.Get(ctx, "b")
+		if !errors.As(err, new(UnknownDeadLetterErr)) {
+			t.Errorf("expected UnknownDeadLetterErr, received %#v", err)
+		}
+
+		d, _ := s.List(ctx)
+		if len(d) != 2 {
+			t.Errorf("expected 2 dead letters, received %d", len(d))
+		}
+	})
+
+	t.Run("unknown dead letters", func(t *testing.T) {
+		_, err := s.Get(ctx, "nonsuch")
+		if !errors.As(err, new(UnknownDeadLetterErr)) {
+			t.Errorf("expected UnknownDeadLetterErr, received %#v", err)
+		}
+
+		err = s.Delete(ctx, "nonsuch")
+		if !errors.As(err, new(UnknownDeadLetterErr)) {
+			t.Errorf("expected UnknownDeadLetterErr, received %#v", err)
+		}
+	})
+}
+
+// testDB returns a connection to the database at TEST_DB_CONN_STRING,
+// skipping the calling test where it isn't set
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DB_CONN_STRING")
+	if dsn == "" {
+		t.Skip("TEST_DB_CONN_STRING not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// flakyServer fails requests while broken is true
+func flakyServer(t *testing.T, broken *atomic.Bool, received *atomic.Int64) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if broken.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		received.Add(1)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestProcess_Run_DeadLetters(t *testing.T) {
+	s, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		broken   atomic.Bool
+		received atomic.Int64
+	)
+
+	broken.Store(true)
+	srv := flakyServer(t, &broken, &received)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey:     srv.URL,
+			BasicUsernameKey: "user",
+			BasicPasswordKey: "hunter2",
+		},
+	}, WithDeadLetterStore(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ev := orchestrator.Event{ID: "dead-letter-test", Operation: orchestrator.OperationCreate}
+
+	_, err = p.Run(ContextWithRequestID(context.Background(), "request-1"), ev)
+	if !errors.As(err, new(BadStatusErr)) {
+		t.Fatalf("expected BadStatusErr, received %#v", err)
+	}
+
+	d, _ := s.List(context.Background())
+	if len(d) != 1 {
+		t.Fatalf("expected a single dead letter, received %d", len(d))
+	}
+
+	if d[0].Event != ev || d[0].Status != http.StatusServiceUnavailable || d[0].RequestID != "request-1" || d[0].Target != srv.URL || d[0].Process != p.ID() {
+		t.Errorf("unexpected dead letter %#v", d[0])
+	}
+
+	admin, err := NewDeadLetterAdmin(s, BearerAuthenticator{Token: "admin"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("failed redrives replace the dead letter", func(t *testing.T) {
+		err := admin.Redrive(context.Background(), d[0].ID)
+		if !errors.As(err, new(BadStatusErr)) {
+			t.Errorf("expected BadStatusErr, received %#v", err)
+		}
+
+		d, _ = s.List(context.Background())
+		if len(d) != 1 {
+			t.Fatalf("expected a single dead letter, received %d", len(d))
+		}
+	})
+
+	t.Run("successful redrives remove the dead letter", func(t *testing.T) {
+		broken.Store(false)
+
+		err := admin.Redrive(context.Background(), d[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, _ = s.List(context.Background())
+		if len(d) != 0 {
+			t.Errorf("expected no dead letters, received %d", len(d))
+		}
+
+		if received.Load() != 1 {
+			t.Errorf("expected a single delivery, received %d", received.Load())
+		}
+	})
+}
+
+func TestDeadLetterAdmin(t *testing.T) {
+	s, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		broken   atomic.Bool
+		received atomic.Int64
+	)
+
+	srv := flakyServer(t, &broken, &received)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+	}, WithDeadLetterStore(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	for _, id := range []string{"a", "b", "c"} {
+		s.Put(ctx, DeadLetter{ID: id, Process: p.ID(), Event: orchestrator.Event{ID: id, Operation: orchestrator.OperationCreate}, FailedAt: time.Now()})
+	}
+
+	s.Put(ctx, DeadLetter{ID: "orphan", Process: "nonsuch", Event: orchestrator.Event{Operation: orchestrator.OperationCreate}, FailedAt: time.Now()})
+
+	admin, err := NewDeadLetterAdmin(s, BearerAuthenticator{Token: "admin"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		token        string
+		expectStatus int
+		expectBody   string
+	}{
+		{"unauthenticated", http.MethodGet, "/dead-letters", "", "", http.StatusUnauthorized, ""},
+		{"list", http.MethodGet, "/dead-letters", "", "admin", http.StatusOK, `"id":"orphan"`},
+		{"show", http.MethodGet, "/dead-letters/b", "", "admin", http.StatusOK, `"id":"b"`},
+		{"show unknown", http.MethodGet, "/dead-letters/nonsuch", "", "admin", http.StatusNotFound, "unknown dead letter"},
+		{"delete", http.MethodDelete, "/dead-letters/c", "", "admin", http.StatusNoContent, ""},
+		{"redrive", http.MethodPost, "/dead-letters/a/redrive", "", "admin", http.StatusOK, `"redriven":["a"]`},
+		{"redrive many", http.MethodPost, "/redrive", `{"ids":["b"]}`, "admin", http.StatusOK, `"redriven":["b"]`},
+		{"redrive without ids", http.MethodPost, "/redrive", `{}`, "admin", http.StatusBadRequest, ""},
+		{"redrive unknown process", http.MethodPost, "/dead-letters/orphan/redrive", "", "admin", http.StatusServiceUnavailable, "unknown process"},
+		{"unknown route", http.MethodGet, "/nonsuch", "", "admin", http.StatusNotFound, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("expected %d, received %d", test.expectStatus, rec.Code)
+			}
+
+			if !strings.Contains(rec.Body.String(), test.expectBody) {
+				t.Errorf("expected body to contain %q, received %q", test.expectBody, rec.Body.String())
+			}
+		})
+	}
+
+	d, _ := s.List(ctx)
+	if len(d) != 1 || d[0].ID != "orphan" {
+		t.Errorf("expected only the orphan to remain, received %#v", d)
+	}
+
+	if received.Load() != 2 {
+		t.Errorf("expected 2 redriven deliveries, received %d", received.Load())
+	}
+
+	_, err = NewDeadLetterAdmin(s, nil)
+	if !errors.As(err, new(MissingAuthenticatorErr)) {
+		t.Errorf("expected MissingAuthenticatorErr, received %#v", err)
+	}
+}
+
+func TestDeadLetterAdmin_Mounted(t *testing.T) {
+	s, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		broken   atomic.Bool
+		received atomic.Int64
+	)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: flakyServer(t, &broken, &received).URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Put(context.Background(), DeadLetter{ID: "a", Process: p.ID(), Event: orchestrator.Event{ID: "a", Operation: orchestrator.OperationCreate}, FailedAt: time.Now()})
+
+	admin, err := NewDeadLetterAdmin(s, BearerAuthenticator{Token: "admin"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Mounted as documented
+	mux := http.NewServeMux()
+	mux.Handle("/dlq/", http.StripPrefix("/dlq", admin))
+
+	for _, test := range []struct {
+		name         string
+		method       string
+		path         string
+		body         string
+		expectStatus int
+	}{
+		{"list", http.MethodGet, "/dlq/dead-letters", "", http.StatusOK},
+		{"show", http.MethodGet, "/dlq/dead-letters/a", "", http.StatusOK},
+		{"redrive many", http.MethodPost, "/dlq/redrive", `{"ids":["a"]}`, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			req.Header.Set("Authorization", "Bearer admin")
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("expected %d, received %d", test.expectStatus, rec.Code)
+			}
+		})
+	}
+
+	if received.Load() != 1 {
+		t.Errorf("expected 1 redriven delivery, received %d", received.Load())
+	}
+}
+
+func TestDeadLetterAdmin_Redrive_DryRun(t *testing.T) {
+	s, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		broken   atomic.Bool
+		received atomic.Int64
+	)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: flakyServer(t, &broken, &received).URL},
+	}, WithDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	s.Put(ctx, DeadLetter{ID: "a", Process: p.ID(), Event: orchestrator.Event{ID: "a", Operation: orchestrator.OperationCreate}, FailedAt: time.Now()})
+
+	admin, err := NewDeadLetterAdmin(s, BearerAuthenticator{Token: "admin"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = admin.Redrive(ctx, "a")
+	if !errors.As(err, new(DryRunRedriveErr)) {
+		t.Errorf("expected DryRunRedriveErr, received %#v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/dead-letters/a/redrive", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+
+	rec := httptest.NewRecorder()
+	admin.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected %d, received %d", http.StatusConflict, rec.Code)
+	}
+
+	if _, err = s.Get(ctx, "a"); err != nil {
+		t.Errorf("expected dead letter to remain, received %#v", err)
+	}
+
+	if received.Load() != 0 {
+		t.Errorf("expected no deliveries, received %d", received.Load())
+	}
+}
@@ -0,0 +1,91 @@
+package webhooks
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// DryRunKey, when "true", makes a Process render each request it would
+// send into ProcessStatus.Logs, and succeed, without sending anything.
+// See SetDryRun to dry run every Process at once
+const DryRunKey = "dry_run"
+
+// DryRunEnv is an environment variable which, when "true" at startup, dry
+// runs every Process, as with SetDryRun(true)
+const DryRunEnv = "WEBHOOKS_DRY_RUN"
+
+// dryRunLogPrefix prefixes the lines of a rendered request in
+// ProcessStatus.Logs
+const dryRunLogPrefix = "dry run: "
+
+// dryRunAll dry runs every Process, regardless of configuration
+var dryRunAll atomic.Bool
+
+func init() {
+	on, _ := strconv.ParseBool(os.Getenv(DryRunEnv))
+	dryRunAll.Store(on)
+}
+
+// SetDryRun sets whether every Process dry runs, regardless of DryRunKey
+func SetDryRun(on bool) {
+	dryRunAll.Store(on)
+}
+
+// WithDryRun makes a Process dry run, as with DryRunKey
+func WithDryRun() ProcessOption {
+	return func(p *Process) {
+		p.dryRun = true
+	}
+}
+
+func dryRunFromConfig(ec map[string]string) (on bool, err error) {
+	v, ok := ec[DryRunKey]
+	if !ok {
+		return
+	}
+
+	on, err = strconv.ParseBool(v)
+	if err != nil {
+		err = InvalidConfigErr{DryRunKey, v, err}
+	}
+
+	return
+}
+
+// isDryRun returns whether this Process should dry run
+func (w Process) isDryRun() bool {
+	return w.dryRun || dryRunAll.Load()
+}
+
+// renderRequest appends the method, URL, headers, and body of req to the
+// logs of d, masking secrets and any header which usually holds one
+func (w Process) renderRequest(d *delivery, req *http.Request, body []byte) {
+	d.logs = append(d.logs, dryRunLogPrefix+req.Method+" "+w.redact(redactURL(req.URL.String())))
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	sensitive := make(map[string]bool)
+	for _, h := range DefaultRedactedHeaders {
+		sensitive[h] = true
+	}
+
+	for _, k := range keys {
+		v := strings.Join(req.Header[k], ", ")
+		if sensitive[k] {
+			v = redacted
+		}
+
+		d.logs = append(d.logs, dryRunLogPrefix+k+": "+w.redact(v))
+	}
+
+	d.logs = append(d.logs, dryRunLogPrefix+w.redact(string(body)))
+}
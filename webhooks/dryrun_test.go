@@ -0,0 +1,139 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestProcess_Run_DryRun(t *testing.T) {
+	calls := new(atomic.Int64)
+	issued := new(atomic.Int64)
+
+	srv := statusServer(t, http.StatusInternalServerError, calls)
+	tokens := tokenServer(t, 3600, issued)
+
+	for _, test := range []struct {
+		name   string
+		ec     map[string]string
+		opts   []ProcessOption
+		global bool
+	}{
+		{"via config", map[string]string{DryRunKey: "true"}, nil, false},
+		{"via option", map[string]string{}, []ProcessOption{WithDryRun()}, false},
+		{"globally", map[string]string{}, nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if test.global {
+				SetDryRun(true)
+				t.Cleanup(func() { SetDryRun(false) })
+			}
+
+			test.ec[TargetURLKey] = srv.URL + "/hook"
+			test.ec[MethodKey] = http.MethodPut
+			test.ec[HeaderKeyPrefix+"X-Token"] = "t0ken"
+			test.ec[OAuth2TokenURLKey] = tokens.URL
+			test.ec[OAuth2ClientIDKey] = "client"
+			test.ec[OAuth2ClientSecretKey] = "s3cr3t"
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			}, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := p.Run(context.Background(), orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate, ID: "t0ken-1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ps.Status != orchestrator.ProcessSuccess {
+				t.Errorf("expected success, received %v", ps.Status)
+			}
+
+			if calls.Load() != 0 || issued.Load() != 0 {
+				t.Errorf("expected no calls, received %d to the target and %d to the token endpoint", calls.Load(), issued.Load())
+			}
+
+			logs := strings.Join(ps.Logs, "\n")
+			for _, expect := range []string{
+				"dry run: PUT " + srv.URL + "/hook",
+				"dry run: Authorization: [REDACTED]",
+				"dry run: X-Token: [REDACTED]",
+				"dry run: Content-Type: application/json",
+				"dry run: X-Request-Id: ",
+				`"location":"orders"`,
+			} {
+				if !strings.Contains(logs, expect) {
+					t.Errorf("expected logs to contain %q, received\n%s", expect, logs)
+				}
+			}
+
+			if strings.Contains(logs, "t0ken") || strings.Contains(logs, "s3cr3t") {
+				t.Errorf("expected secrets to be masked, received\n%s", logs)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		p, err := NewProcess(orchestrator.ProcessConfig{
+			Name:             "tests",
+			ExecutionContext: map[string]string{TargetURLKey: srv.URL, DryRunKey: "false"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate})
+		if err == nil || calls.Load() != 1 {
+			t.Errorf("expected a real call, received %d calls and error %v", calls.Load(), err)
+		}
+	})
+}
+
+func TestProcess_Run_DryRunOutbox(t *testing.T) {
+	o := newBoltOutbox(t)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLsKey: "https://a.example.com,https://b.example.com", DryRunKey: "true"},
+	}, WithOutbox(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(strings.Join(ps.Logs, "\n"), "https://b.example.com: dry run") {
+		t.Errorf("expected each target to be dry run, received %#v", ps.Logs)
+	}
+
+	pending, err := o.Pending(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 0 {
+		t.Errorf("expected nothing to be queued, received %d entries", len(pending))
+	}
+}
+
+func TestNewProcess_DryRunConfig(t *testing.T) {
+	_, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: "https://example.com", DryRunKey: "maybe"},
+	})
+	if !errors.As(err, new(InvalidConfigErr)) {
+		t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+	}
+}
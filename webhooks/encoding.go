@@ -0,0 +1,184 @@
+package webhooks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"sync"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ExecutionContext keys used to configure how a Process encodes the
+// requests it sends
+const (
+	// ContentEncodingKey compresses request bodies with either "gzip" or
+	// "zstd", setting the Content-Encoding header accordingly. By default
+	// bodies are sent uncompressed
+	ContentEncodingKey = "content_encoding"
+
+	// MaxPayloadBytesKey sets the largest body, after any multipart
+	// wrapping and compression, a Process will send. Larger bodies fail
+	// with a webhooks.PayloadTooLargeErr, without being sent. By default
+	// bodies of any size are sent
+	MaxPayloadBytesKey = "max_payload_bytes"
+
+	// MultipartThresholdKey sends payloads larger than this many bytes as
+	// a multipart/form-data upload, for receivers which accept large
+	// payloads that way. By default payloads are never sent as multipart
+	MultipartThresholdKey = "multipart_threshold"
+
+	// MultipartFieldKey sets the name of the form field holding the
+	// payload in a multipart upload. The default is DefaultMultipartField
+	MultipartFieldKey = "multipart_field"
+)
+
+// DefaultMultipartField is the form field holding the payload of a
+// multipart upload where no MultipartFieldKey is set
+const DefaultMultipartField = "payload"
+
+// PayloadTooLargeErr is returned when a body is larger than
+// MaxPayloadBytesKey allows
+type PayloadTooLargeErr struct{ size, max int }
+
+// Error returns the error text for this error
+func (e PayloadTooLargeErr) Error() string {
+	return fmt.Sprintf("payload of %d bytes exceeds maximum of %d bytes", e.size, e.max)
+}
+
+// outgoing is an encoded body, ready to send
+type outgoing struct {
+	// data is sent as the body, while raw is the same body before
+	// compression, for rendering where data isn't readable, and payload
+	// is the body before either multipart wrapping or compression, which
+	// cassettes record and match on
+	data    []byte
+	raw     []byte
+	payload []byte
+
+	contentType     string
+	contentEncoding string
+}
+
+// encoding configures how a Process encodes the requests it sends
+type encoding struct {
+	contentEncoding    string
+	maxBytes           int
+	multipartThreshold int
+	multipartField     string
+}
+
+func encodingFromConfig(ec map[string]string) (enc encoding, err error) {
+	switch v := ec[ContentEncodingKey]; v {
+	case "", "identity":
+	case "gzip", "zstd":
+		enc.contentEncoding = v
+	default:
+		return enc, InvalidConfigErr{ContentEncodingKey, v, fmt.Errorf("must be one of gzip or zstd")}
+	}
+
+	enc.maxBytes, err = intValue(ec, MaxPayloadBytesKey, 0)
+	if err != nil {
+		return
+	}
+
+	enc.multipartThreshold, err = intValue(ec, MultipartThresholdKey, 0)
+	if err != nil {
+		return
+	}
+
+	enc.multipartField = DefaultMultipartField
+	if v, ok := ec[MultipartFieldKey]; ok && v != "" {
+		enc.multipartField = v
+	}
+
+	return
+}
+
+// zstdEncoder is shared by every Process, since EncodeAll is safe for
+// concurrent use
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil)
+})
+
+// encode renders the payload for e, handing the PayloadFunc a context
+// carrying request ID id, and wraps and compresses it as configured
+func (w Process) encode(ctx context.Context, e orchestrator.Event, id string) (out outgoing, err error) {
+	out.data, err = w.payload(ContextWithRequestID(ctx, id), e)
+	if err != nil {
+		return
+	}
+
+	out.payload = out.data
+	out.contentType = "application/json"
+
+	if w.encoding.multipartThreshold > 0 && len(out.data) > w.encoding.multipartThreshold {
+		out.data, out.contentType, err = w.encoding.multipart(out.data)
+		if err != nil {
+			return
+		}
+	}
+
+	out.raw = out.data
+
+	switch w.encoding.contentEncoding {
+	case "gzip":
+		buf := new(bytes.Buffer)
+
+		gw := gzip.NewWriter(buf)
+		_, err = gw.Write(out.data)
+		if err == nil {
+			err = gw.Close()
+		}
+
+		out.data = buf.Bytes()
+
+	case "zstd":
+		var enc *zstd.Encoder
+
+		enc, err = zstdEncoder()
+		if err == nil {
+			out.data = enc.EncodeAll(out.data, nil)
+		}
+	}
+
+	if err != nil {
+		return
+	}
+
+	out.contentEncoding = w.encoding.contentEncoding
+
+	if w.encoding.maxBytes > 0 && len(out.data) > w.encoding.maxBytes {
+		err = PayloadTooLargeErr{len(out.data), w.encoding.maxBytes}
+	}
+
+	return
+}
+
+// multipart wraps b as the single file of a multipart/form-data body
+func (enc encoding) multipart(b []byte) (body []byte, contentType string, err error) {
+	buf := new(bytes.Buffer)
+	mw := multipart.NewWriter(buf)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename="%s.json"`, enc.multipartField, enc.multipartField))
+	h.Set("Content-Type", "application/json")
+
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return
+	}
+
+	_, err = part.Write(b)
+	if err != nil {
+		return
+	}
+
+	err = mw.Close()
+
+	return buf.Bytes(), mw.FormDataContentType(), err
+}
@@ -0,0 +1,255 @@
+package webhooks
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decodingServer decodes each request body according to its
+// Content-Encoding and multipart Content-Type, sending the results to
+// received
+func decodingServer(t *testing.T, received chan<- map[string]string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			body io.Reader = r.Body
+			err  error
+		)
+
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			body, err = gzip.NewReader(r.Body)
+		case "zstd":
+			var d *zstd.Decoder
+
+			d, err = zstd.NewReader(r.Body)
+			if err == nil {
+				defer d.Close()
+				body = d
+			}
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		r.Body = io.NopCloser(body)
+
+		got := map[string]string{
+			"encoding": r.Header.Get("Content-Encoding"),
+		}
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			err = r.ParseMultipartForm(1 << 20)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+
+			for name, files := range r.MultipartForm.File {
+				f, err := files[0].Open()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+
+					return
+				}
+
+				b, _ := io.ReadAll(f)
+				f.Close()
+
+				got["field"] = name
+				got["filename"] = files[0].Filename
+				got["body"] = string(b)
+			}
+		} else {
+			b, _ := io.ReadAll(r.Body)
+			got["body"] = string(b)
+		}
+
+		received <- got
+	}))
+
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestProcess_Run_Encoding(t *testing.T) {
+	received := make(chan map[string]string, 1)
+	srv := decodingServer(t, received)
+
+	e := orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate, ID: "1"}
+
+	want, err := encodeEvent(context.Background(), e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		ec     map[string]string
+		expect map[string]string
+	}{
+		{"uncompressed", map[string]string{}, map[string]string{"encoding": "", "body": string(want)}},
+		{"gzip", map[string]string{ContentEncodingKey: "gzip"}, map[string]string{"encoding": "gzip", "body": string(want)}},
+		{"zstd", map[string]string{ContentEncodingKey: "zstd"}, map[string]string{"encoding": "zstd", "body": string(want)}},
+		{"below multipart threshold", map[string]string{MultipartThresholdKey: "100000"}, map[string]string{"body": string(want)}},
+		{"multipart", map[string]string{MultipartThresholdKey: "10"}, map[string]string{"field": "payload", "filename": "payload.json", "body": string(want)}},
+		{"compressed multipart", map[string]string{MultipartThresholdKey: "10", MultipartFieldKey: "event", ContentEncodingKey: "gzip"}, map[string]string{"encoding": "gzip", "field": "event", "filename": "event.json", "body": string(want)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = srv.URL
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.Run(context.Background(), e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := <-received
+			for k, v := range test.expect {
+				if got[k] != v {
+					t.Errorf("%s: expected %q, received %q", k, v, got[k])
+				}
+			}
+		})
+	}
+}
+
+func TestProcess_Run_MaxPayloadBytes(t *testing.T) {
+	received := make(chan map[string]string, 1)
+	srv := decodingServer(t, received)
+
+	dl, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate, ID: strings.Repeat("a", 1000)}
+
+	for _, test := range []struct {
+		name      string
+		ec        map[string]string
+		expectErr bool
+	}{
+		{"within limit", map[string]string{MaxPayloadBytesKey: "2000"}, false},
+		{"exceeds limit", map[string]string{MaxPayloadBytesKey: "500"}, true},
+		{"within limit once compressed", map[string]string{MaxPayloadBytesKey: "500", ContentEncodingKey: "zstd"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = srv.URL
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			}, WithDeadLetterStore(dl))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := p.Run(context.Background(), e)
+			if !test.expectErr {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				<-received
+
+				return
+			}
+
+			if !errors.As(err, new(PayloadTooLargeErr)) {
+				t.Fatalf("expected error of type %T, received %#v", PayloadTooLargeErr{}, err)
+			}
+
+			if ps.Status != orchestrator.ProcessFail {
+				t.Errorf("expected %v, received %v", orchestrator.ProcessFail, ps.Status)
+			}
+
+			select {
+			case <-received:
+				t.Error("expected nothing to be sent")
+			default:
+			}
+
+			letters, err := dl.List(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(letters) != 1 || letters[0].Target != srv.URL {
+				t.Errorf("expected a dead letter for %s, received %#v", srv.URL, letters)
+			}
+		})
+	}
+}
+
+func TestProcess_Run_EncodingDryRun(t *testing.T) {
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLKey:       "https://example.com",
+			ContentEncodingKey: "gzip",
+			DryRunKey:          "true",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := strings.Join(ps.Logs, "\n")
+	for _, expect := range []string{"dry run: Content-Encoding: gzip", `"location":"orders"`} {
+		if !strings.Contains(logs, expect) {
+			t.Errorf("expected logs to contain %q, received\n%s", expect, logs)
+		}
+	}
+}
+
+func TestNewProcess_EncodingConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"unknown encoding", map[string]string{ContentEncodingKey: "brotli"}},
+		{"invalid max payload", map[string]string{MaxPayloadBytesKey: "lots"}},
+		{"invalid multipart threshold", map[string]string{MultipartThresholdKey: "1MB"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
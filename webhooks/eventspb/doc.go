@@ -0,0 +1,6 @@
+// Package eventspb holds the protocol buffer definitions, and generated
+// code, for the gRPC interface of webhooks.GRPCInput. Producers may use
+// this package directly, or generate their own clients from events.proto
+package eventspb
+
+//go:generate protoc -I .. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative ../eventspb/events.proto
@@ -56,6 +56,14 @@ func main() {
 		panic(err)
 	}
 
+	// Describe our webhook input, for the benefit of callers, at
+	// http://127.0.1.1:8888/openapi.json
+	webhooks.ServeOpenAPI("/openapi.json", webhooks.Info{Title: "webhooks-example", Version: "1.0.0"})
+
+	// Expose liveness and readiness checks for load balancers and the like
+	http.Handle("/healthz", webhooks.LivenessHandler(in))
+	http.Handle("/readyz", webhooks.ReadinessHandler(in))
+
 	go func() {
 		// This will expose our webhook input on
 		// http://127.0.1.1:8888/webhooks/webhooks-input-example
@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// ExecutionContext keys used to configure how a Process with several
+// targets (see TargetURLsKey) decides whether it has succeeded
+const (
+	// FanOutPolicyKey sets the FanOutPolicy of a Process; one of "all",
+	// "any", or "quorum". The default is "all"
+	FanOutPolicyKey = "policy"
+
+	// QuorumKey sets the number of targets which must succeed under the
+	// "quorum" FanOutPolicy. The default is a simple majority
+	QuorumKey = "quorum"
+)
+
+// FanOutPolicy decides how many of a Process' targets must succeed for a
+// Run to be considered successful.
+//
+// Whatever the policy, every target is sent every Event; the policy only
+// decides the outcome
+type FanOutPolicy string
+
+const (
+	// FanOutAll requires every target to succeed
+	FanOutAll FanOutPolicy = "all"
+
+	// FanOutAny requires at least one target to succeed
+	FanOutAny FanOutPolicy = "any"
+
+	// FanOutQuorum requires some number of targets to succeed, as set
+	// by QuorumKey
+	FanOutQuorum FanOutPolicy = "quorum"
+)
+
+// FanOutErr is returned by a Process with several targets when too few
+// targets succeed to satisfy its FanOutPolicy.
+//
+// It wraps the error of each failed target, and so can be inspected with
+// errors.As and errors.Is
+type FanOutErr struct {
+	policy    FanOutPolicy
+	required  int
+	succeeded int
+	failures  map[string]error
+}
+
+// Error returns the error text for this error
+func (e FanOutErr) Error() string {
+	return fmt.Sprintf("error calling webhooks: %d of %d targets succeeded, %q policy requires %d", e.succeeded, e.succeeded+len(e.failures), e.policy, e.required)
+}
+
+// Unwrap returns the errors of each failed target
+func (e FanOutErr) Unwrap() (errs []error) {
+	errs = make([]error, 0, len(e.failures))
+	for _, err := range e.failures {
+		errs = append(errs, err)
+	}
+
+	return
+}
+
+// Failures returns the error of each failed target, keyed by URL
+func (e FanOutErr) Failures() map[string]error {
+	return e.failures
+}
+
+// fanOutFromConfig returns the FanOutPolicy of a Process, and the number of
+// its n targets which must succeed
+func fanOutFromConfig(ec map[string]string, n int) (policy FanOutPolicy, required int, err error) {
+	policy = FanOutPolicy(ec[FanOutPolicyKey])
+
+	switch policy {
+	case "", FanOutAll:
+		return FanOutAll, n, nil
+
+	case FanOutAny:
+		return policy, 1, nil
+
+	case FanOutQuorum:
+		required, err = intValue(ec, QuorumKey, n/2+1)
+		if err == nil && (required < 1 || required > n) {
+			err = InvalidConfigErr{QuorumKey, ec[QuorumKey], fmt.Errorf("must be between 1 and %d", n)}
+		}
+
+		return
+	}
+
+	return "", 0, InvalidConfigErr{FanOutPolicyKey, string(policy), fmt.Errorf("must be one of %q, %q, or %q", FanOutAll, FanOutAny, FanOutQuorum)}
+}
+
+// fanOut delivers an encoded Event to every target concurrently, combining
+// the outcome of each into ps.
+//
+// Each target gets a line in ps.Logs describing its outcome, followed by
+// any further logs of its own, each prefixed with the target URL
+func (w Process) fanOut(ctx context.Context, ps orchestrator.ProcessStatus, e orchestrator.Event, id string, body outgoing) (orchestrator.ProcessStatus, error) {
+	deliveries := make([]delivery, len(w.targets))
+
+	var wg sync.WaitGroup
+	for i, t := range w.targets {
+		wg.Add(1)
+
+		go func(i int, t target) {
+			defer wg.Done()
+
+			deliveries[i] = w.deliver(ctx, t, e, id, body)
+		}(i, t)
+	}
+
+	wg.Wait()
+
+	var failed int
+
+	failures := make(map[string]error)
+	for _, d := range deliveries {
+		var msg string
+
+		name := redactURL(d.target)
+
+		switch d.err {
+		case nil:
+			if w.isDryRun() {
+				ps.Logs = append(ps.Logs, fmt.Sprintf("%s: dry run", name))
+
+				break
+			}
+
+			ps.Logs = append(ps.Logs, fmt.Sprintf("%s: delivered (%d)", name, d.code))
+
+		default:
+			failed++
+			failures[d.target] = d.err
+			msg = w.redact(d.err.Error())
+			ps.Logs = append(ps.Logs, fmt.Sprintf("%s: failed: %s", name, msg))
+		}
+
+		for _, l := range d.logs {
+			switch {
+			case l == msg:
+			case strings.HasPrefix(l, responseLogPrefix), strings.HasPrefix(l, graphQLLogPrefix):
+				// Captured responses and GraphQL results name
+				// their target already, and must stay parseable
+				ps.Logs = append(ps.Logs, l)
+
+			default:
+				ps.Logs = append(ps.Logs, name+": "+l)
+			}
+		}
+	}
+
+	succeeded := len(deliveries) - failed
+	if succeeded >= w.quorum {
+		ps.Status = orchestrator.ProcessSuccess
+
+		return ps, nil
+	}
+
+	ps.Status = orchestrator.ProcessFail
+
+	return ps, FanOutErr{
+		policy:    w.fanOutPolicy,
+		required:  w.quorum,
+		succeeded: succeeded,
+		failures:  failures,
+	}
+}
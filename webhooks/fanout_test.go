@@ -0,0 +1,203 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// statusServer always responds with status
+func statusServer(t *testing.T, status int, received *atomic.Int64) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestProcess_Run_FanOut(t *testing.T) {
+	var received atomic.Int64
+
+	ok1 := statusServer(t, http.StatusOK, &received)
+	ok2 := statusServer(t, http.StatusAccepted, &received)
+	bad := statusServer(t, http.StatusInternalServerError, &received)
+
+	for _, test := range []struct {
+		name         string
+		url          string
+		urls         []string
+		policy       string
+		quorum       string
+		expectStatus orchestrator.ProcessExitStatus
+		expectError  bool
+	}{
+		{"all succeed", ok1.URL, []string{ok2.URL}, "", "", orchestrator.ProcessSuccess, false},
+		{"all, with one failure", ok1.URL, []string{ok2.URL, bad.URL}, "all", "", orchestrator.ProcessFail, true},
+		{"any, with one success", "", []string{bad.URL, ok1.URL}, "any", "", orchestrator.ProcessSuccess, false},
+		{"any, with every failure", "", []string{bad.URL, bad.URL + "/again"}, "any", "", orchestrator.ProcessFail, true},
+		{"majority quorum", "", []string{ok1.URL, ok2.URL, bad.URL}, "quorum", "", orchestrator.ProcessSuccess, false},
+		{"explicit quorum", "", []string{ok1.URL, ok2.URL, bad.URL}, "quorum", "3", orchestrator.ProcessFail, true},
+		{"duplicated targets count once", bad.URL, []string{bad.URL, ok1.URL, bad.URL}, "quorum", "2", orchestrator.ProcessFail, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			received.Store(0)
+
+			ec := map[string]string{TargetURLsKey: strings.Join(test.urls, ", ")}
+			if test.url != "" {
+				ec[TargetURLKey] = test.url
+			}
+
+			if test.policy != "" {
+				ec[FanOutPolicyKey] = test.policy
+			}
+
+			if test.quorum != "" {
+				ec[QuorumKey] = test.quorum
+			}
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := p.Run(context.Background(), orchestrator.Event{})
+			if err == nil && test.expectError {
+				t.Errorf("expected error, received none")
+			} else if err != nil && !test.expectError {
+				t.Errorf("unexpected error %#v", err)
+			}
+
+			if err != nil {
+				if !errors.As(err, new(FanOutErr)) {
+					t.Errorf("expected FanOutErr, received %T", err)
+				}
+
+				if !errors.As(err, new(BadStatusErr)) {
+					t.Errorf("expected FanOutErr to wrap BadStatusErr")
+				}
+			}
+
+			if ps.Status != test.expectStatus {
+				t.Errorf("expected %v, received %v", test.expectStatus, ps.Status)
+			}
+
+			// Every target is called once, whatever the policy
+			targets := make(map[string]bool)
+			for _, u := range append(test.urls, test.url) {
+				if u != "" {
+					targets[u] = true
+				}
+			}
+
+			expectCalls := int64(len(targets))
+
+			if received.Load() != expectCalls {
+				t.Errorf("expected %d calls, received %d", expectCalls, received.Load())
+			}
+
+			if int64(len(ps.Logs)) != expectCalls {
+				t.Errorf("expected a log line per target, received %#v", ps.Logs)
+			}
+		})
+	}
+}
+
+func TestProcess_Run_FanOutRedrive(t *testing.T) {
+	var (
+		received atomic.Int64
+		broken   atomic.Bool
+		redriven atomic.Int64
+	)
+
+	broken.Store(true)
+
+	good := statusServer(t, http.StatusOK, &received)
+	flaky := flakyServer(t, &broken, &redriven)
+
+	s, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters.ndjson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLsKey: good.URL + "," + flaky.URL,
+		},
+	}, WithDeadLetterStore(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate})
+	if !errors.As(err, new(FanOutErr)) {
+		t.Fatalf("expected FanOutErr, received %#v", err)
+	}
+
+	d, _ := s.List(context.Background())
+	if len(d) != 1 || d[0].Target != flaky.URL {
+		t.Fatalf("expected a single dead letter for %s, received %#v", flaky.URL, d)
+	}
+
+	admin, err := NewDeadLetterAdmin(s, BearerAuthenticator{Token: "admin"}, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broken.Store(false)
+
+	err = admin.Redrive(context.Background(), d[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Load() != 1 || redriven.Load() != 1 {
+		t.Errorf("expected only the failed target to be redriven, received %d and %d calls", received.Load(), redriven.Load())
+	}
+}
+
+func TestNewProcess_FanOutConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"unknown policy", map[string]string{FanOutPolicyKey: "most"}},
+		{"invalid quorum", map[string]string{FanOutPolicyKey: "quorum", QuorumKey: "many"}},
+		{"quorum too large", map[string]string{FanOutPolicyKey: "quorum", QuorumKey: "3"}},
+		{"quorum too small", map[string]string{FanOutPolicyKey: "quorum", QuorumKey: "0"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLsKey] = "https://a.example.com,https://b.example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+
+	_, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLsKey: " , "},
+	})
+	if !errors.As(err, new(MissingWebhookURLErr)) {
+		t.Errorf("expected MissingWebhookURLErr, received %#v", err)
+	}
+}
@@ -1,12 +1,26 @@
 module github.com/dapper-data/dapper-orchestrator-contrib/webhooks
 
-go 1.21
+go 1.22
 
-require github.com/dapper-data/dapper-orchestrator v0.1.2
+require (
+	github.com/coder/websocket v1.8.12
+	github.com/dapper-data/dapper-orchestrator v0.1.2
+	github.com/google/uuid v1.6.0
+	github.com/klauspost/compress v1.18.0
+	github.com/lib/pq v1.10.9
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/oauth2 v0.24.0
+	golang.org/x/time v0.8.0
+)
 
 require (
 	github.com/emirpasic/gods v1.18.1 // indirect
-	github.com/google/uuid v1.4.0 // indirect
 	github.com/heimdalr/dag v1.3.1 // indirect
-	golang.org/x/sync v0.5.0 // indirect
+	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.34.2
 )
@@ -0,0 +1,244 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// ExecutionContext keys used to configure a Process created with
+// NewGraphQLProcess
+const (
+	// GraphQLQueryKey sets the GraphQL document to send, such as:
+	//
+	//	"mutation Sync($id: ID!, $table: String!) { sync(id: $id, table: $table) { ok } }"
+	GraphQLQueryKey = "query"
+
+	// GraphQLVariablesKey sets the variables sent with the query, as a
+	// JSON object. Strings anywhere within the object are text/templates
+	// executed against a MessageData, such as:
+	//
+	//	`{"id": "{{.ID}}", "table": "{{.Location}}", "source": {"trigger": "{{.Trigger}}"}}`
+	//
+	// Values are not escaped, and are always sent as strings
+	GraphQLVariablesKey = "variables"
+
+	// GraphQLOperationNameKey sets the name of the operation to run, where
+	// the query holds several
+	GraphQLOperationNameKey = "operation_name"
+)
+
+// graphQLLogPrefix prefixes GraphQL results in ProcessStatus.Logs
+const graphQLLogPrefix = "graphql: "
+
+// MissingGraphQLQueryErr is returned when an ExecutionContext passed to
+// NewGraphQLProcess does not contain a query to send
+type MissingGraphQLQueryErr struct{}
+
+// Error returns the error text for this error
+func (e MissingGraphQLQueryErr) Error() string {
+	return fmt.Sprintf("error creating webhook: missing %q config value", GraphQLQueryKey)
+}
+
+// GraphQLError is a single entry of the errors array of a GraphQL response
+type GraphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// GraphQLResult is the data and errors returned to a Process created with
+// NewGraphQLProcess
+type GraphQLResult struct {
+	Target string          `json:"target"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []GraphQLError  `json:"errors,omitempty"`
+}
+
+// GraphQLResults returns the results recorded into ps, in the order they
+// were received
+func GraphQLResults(ps orchestrator.ProcessStatus) (r []GraphQLResult) {
+	r = make([]GraphQLResult, 0)
+
+	for _, l := range ps.Logs {
+		s, ok := strings.CutPrefix(l, graphQLLogPrefix)
+		if !ok {
+			continue
+		}
+
+		var gr GraphQLResult
+		if json.Unmarshal([]byte(s), &gr) == nil {
+			r = append(r, gr)
+		}
+	}
+
+	return
+}
+
+// NewGraphQLProcess is an orchestrator.NewProcessFunc which configures a
+// Process sending the GraphQL operation set via GraphQLQueryKey, with
+// variables rendered from the Event via GraphQLVariablesKey, to the
+// endpoint set via TargetURLKey.
+//
+// A response with a non-empty errors array is a failure, even where its
+// status is a success, returning a webhooks.TerminalStatusErr listing
+// those errors. The data and errors of each response are recorded into
+// ProcessStatus.Logs, from where they can be read back with GraphQLResults.
+//
+// Responses are read up to MaxResponseBytesKey; larger responses can't be
+// checked for errors, and so fail
+func NewGraphQLProcess(pc orchestrator.ProcessConfig, opts ...ProcessOption) (p Process, err error) {
+	query, ok := pc.ExecutionContext[GraphQLQueryKey]
+	if !ok || strings.TrimSpace(query) == "" {
+		return p, MissingGraphQLQueryErr{}
+	}
+
+	vars := make(map[string]any)
+	if v, ok := pc.ExecutionContext[GraphQLVariablesKey]; ok {
+		err = json.Unmarshal([]byte(v), &vars)
+		if err != nil {
+			return p, InvalidConfigErr{GraphQLVariablesKey, v, err}
+		}
+	}
+
+	tmpl, err := parseVariables(vars)
+	if err != nil {
+		return p, InvalidConfigErr{GraphQLVariablesKey, pc.ExecutionContext[GraphQLVariablesKey], err}
+	}
+
+	payload := graphQLPayload(pc.Name, query, pc.ExecutionContext[GraphQLOperationNameKey], tmpl.(map[string]any))
+
+	p, err = NewProcess(pc, append(opts, WithPayload(payload))...)
+	if err != nil {
+		return
+	}
+
+	p.classifier.graphQL = true
+
+	return
+}
+
+// parseVariables replaces every string within v with the template it
+// holds
+func parseVariables(v any) (out any, err error) {
+	switch v := v.(type) {
+	case string:
+		return template.New("").Option("missingkey=error").Parse(v)
+
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k], err = parseVariables(e)
+			if err != nil {
+				return
+			}
+		}
+
+		return m, nil
+
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i], err = parseVariables(e)
+			if err != nil {
+				return
+			}
+		}
+
+		return s, nil
+	}
+
+	return v, nil
+}
+
+// renderVariables executes every template within v against data
+func renderVariables(v any, data MessageData) (out any, err error) {
+	switch v := v.(type) {
+	case *template.Template:
+		sb := new(strings.Builder)
+		err = v.Execute(sb, data)
+
+		return sb.String(), err
+
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, e := range v {
+			m[k], err = renderVariables(e, data)
+			if err != nil {
+				return
+			}
+		}
+
+		return m, nil
+
+	case []any:
+		s := make([]any, len(v))
+		for i, e := range v {
+			s[i], err = renderVariables(e, data)
+			if err != nil {
+				return
+			}
+		}
+
+		return s, nil
+	}
+
+	return v, nil
+}
+
+func graphQLPayload(process, query, operation string, vars map[string]any) PayloadFunc {
+	return func(ctx context.Context, e orchestrator.Event) ([]byte, error) {
+		id, _ := RequestIDFromContext(ctx)
+
+		v, err := renderVariables(vars, MessageData{
+			Process:   process,
+			Location:  e.Location,
+			Operation: e.Operation.String(),
+			ID:        e.ID,
+			Trigger:   e.Trigger,
+			RequestID: id,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("rendering variables: %w", err)
+		}
+
+		return json.Marshal(struct {
+			Query         string `json:"query"`
+			OperationName string `json:"operationName,omitempty"`
+			Variables     any    `json:"variables"`
+		}{query, operation, v})
+	}
+}
+
+// graphQLResponse decodes a GraphQL response body, returning false where
+// body isn't one
+func graphQLResponse(body []byte) (r GraphQLResult, ok bool) {
+	ok = json.Unmarshal(body, &r) == nil
+
+	return
+}
+
+// recordGraphQL appends the data and errors of a GraphQL response to the
+// logs of d
+func (w Process) recordGraphQL(d *delivery, body []byte, truncated bool) {
+	if truncated {
+		d.logs = append(d.logs, fmt.Sprintf("graphql response exceeds %d bytes", w.capture.maxBytes))
+
+		return
+	}
+
+	r, ok := graphQLResponse(body)
+	if !ok {
+		d.logs = append(d.logs, "response is not a graphql response")
+
+		return
+	}
+
+	r.Target = redactURL(d.target)
+
+	out, _ := json.Marshal(r)
+	d.logs = append(d.logs, graphQLLogPrefix+w.redact(string(out)))
+}
@@ -0,0 +1,173 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// graphQLServer records the request it receives, and responds with body
+func graphQLServer(t *testing.T, status int, body string) (*httptest.Server, chan map[string]any) {
+	t.Helper()
+
+	c := make(chan map[string]any, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			t.Errorf("invalid request: %v", err)
+		}
+
+		c <- v
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, c
+}
+
+func TestGraphQLProcess_Request(t *testing.T) {
+	srv, c := graphQLServer(t, http.StatusOK, `{"data":{"sync":{"ok":true}}}`)
+
+	p, err := NewGraphQLProcess(orchestrator.ProcessConfig{
+		Name: "graphql",
+		ExecutionContext: map[string]string{
+			TargetURLKey:            srv.URL,
+			GraphQLQueryKey:         "mutation Sync($id: ID!) { sync(id: $id) { ok } }",
+			GraphQLOperationNameKey: "Sync",
+			GraphQLVariablesKey:     `{"id": "{{.ID}}", "source": {"table": "{{.Location}}", "ops": ["{{.Operation}}", 1]}, "dry": false}`,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{
+		Location:  `public."orders"`,
+		Operation: orchestrator.OperationCreate,
+		ID:        "42",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-c
+
+	if req["operationName"] != "Sync" || !strings.HasPrefix(req["query"].(string), "mutation Sync") {
+		t.Errorf("unexpected request %#v", req)
+	}
+
+	vars, _ := json.Marshal(req["variables"])
+	expect := `{"dry":false,"id":"42","source":{"ops":["create",1],"table":"public.\"orders\""}}`
+
+	if string(vars) != expect {
+		t.Errorf("expected variables\n%s\nreceived\n%s", expect, vars)
+	}
+
+	r := GraphQLResults(ps)
+	if len(r) != 1 || string(r[0].Data) != `{"sync":{"ok":true}}` || r[0].Target != srv.URL {
+		t.Errorf("expected data to be recorded, received %#v", r)
+	}
+}
+
+func TestGraphQLProcess_Responses(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		status      int
+		body        string
+		expectError error
+		expectLog   string
+	}{
+		{"data", http.StatusOK, `{"data":{"ok":true}}`, nil, ""},
+		{"errors", http.StatusOK, `{"data":null,"errors":[{"message":"nope","path":["sync"]},{"message":"never"}]}`, TerminalStatusErr{}, "graphql errors: nope; never"},
+		{"empty errors", http.StatusOK, `{"data":{"ok":true},"errors":[]}`, nil, ""},
+		{"not graphql", http.StatusOK, `<html></html>`, TerminalStatusErr{}, "not a graphql response"},
+		{"server errors are retryable", http.StatusServiceUnavailable, `{"errors":[{"message":"down"}]}`, RetryableStatusErr{}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv, _ := graphQLServer(t, test.status, test.body)
+
+			p, err := NewGraphQLProcess(orchestrator.ProcessConfig{
+				Name: "graphql",
+				ExecutionContext: map[string]string{
+					TargetURLKey:    srv.URL,
+					GraphQLQueryKey: "{ ok }",
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := p.Run(context.Background(), orchestrator.Event{})
+			if err == nil && test.expectError != nil {
+				t.Fatalf("expected error, received none")
+			} else if err != nil && test.expectError == nil {
+				t.Fatalf("unexpected error %#v", err)
+			}
+
+			if err != nil && fmt.Sprintf("%T", err) != fmt.Sprintf("%T", test.expectError) {
+				t.Errorf("expected error of type %T, received %T", test.expectError, err)
+			}
+
+			if test.expectLog != "" && !strings.Contains(strings.Join(ps.Logs, "\n"), test.expectLog) {
+				t.Errorf("expected logs to contain %q, received %#v", test.expectLog, ps.Logs)
+			}
+		})
+	}
+}
+
+func TestGraphQLProcess_ErrorsAreRecorded(t *testing.T) {
+	srv, _ := graphQLServer(t, http.StatusOK, `{"data":null,"errors":[{"message":"nope","path":["sync",0]}]}`)
+
+	p, err := NewGraphQLProcess(orchestrator.ProcessConfig{
+		Name: "graphql",
+		ExecutionContext: map[string]string{
+			TargetURLKey:    srv.URL,
+			GraphQLQueryKey: "{ ok }",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, _ := p.Run(context.Background(), orchestrator.Event{})
+
+	r := GraphQLResults(ps)
+	if len(r) != 1 || len(r[0].Errors) != 1 || r[0].Errors[0].Message != "nope" || len(r[0].Errors[0].Path) != 2 {
+		t.Errorf("expected errors to be recorded, received %#v", r)
+	}
+}
+
+func TestNewGraphQLProcess_Config(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		ec          map[string]string
+		expectError error
+	}{
+		{"missing query", map[string]string{}, MissingGraphQLQueryErr{}},
+		{"blank query", map[string]string{GraphQLQueryKey: "  "}, MissingGraphQLQueryErr{}},
+		{"invalid variables", map[string]string{GraphQLQueryKey: "{ ok }", GraphQLVariablesKey: "[1]"}, InvalidConfigErr{}},
+		{"invalid variable template", map[string]string{GraphQLQueryKey: "{ ok }", GraphQLVariablesKey: `{"id": "{{.ID"}`}, InvalidConfigErr{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewGraphQLProcess(orchestrator.ProcessConfig{
+				Name:             "graphql",
+				ExecutionContext: test.ec,
+			})
+			if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", test.expectError) {
+				t.Errorf("expected error of type %T, received %#v", test.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/dapper-data/dapper-orchestrator-contrib/webhooks/eventspb"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// InvalidEventErr is returned when an Event published to a GRPCInput can't
+// be passed to the orchestrator
+type InvalidEventErr struct{ reason string }
+
+// Error returns the error text for this error
+func (e InvalidEventErr) Error() string {
+	return "invalid event: " + e.reason
+}
+
+var operationsFromProto = map[eventspb.Operation]orchestrator.Operation{
+	eventspb.Operation_OPERATION_CREATE: orchestrator.OperationCreate,
+	eventspb.Operation_OPERATION_READ:   orchestrator.OperationRead,
+	eventspb.Operation_OPERATION_UPDATE: orchestrator.OperationUpdate,
+	eventspb.Operation_OPERATION_DELETE: orchestrator.OperationDelete,
+}
+
+// EventToProto converts an orchestrator.Event into its protocol buffer
+// form, as published to a GRPCInput
+func EventToProto(e orchestrator.Event) *eventspb.Event {
+	pe := &eventspb.Event{
+		Location: e.Location,
+		Id:       e.ID,
+		Trigger:  e.Trigger,
+	}
+
+	for op, o := range operationsFromProto {
+		if o == e.Operation {
+			pe.Operation = op
+		}
+	}
+
+	return pe
+}
+
+// EventFromProto converts an Event published to a GRPCInput into an
+// orchestrator.Event, returning an InvalidEventErr where pe is missing, or
+// has no known operation
+func EventFromProto(pe *eventspb.Event) (e orchestrator.Event, err error) {
+	if pe == nil {
+		return e, InvalidEventErr{"missing event"}
+	}
+
+	op, ok := operationsFromProto[pe.GetOperation()]
+	if !ok {
+		return e, InvalidEventErr{fmt.Sprintf("unknown operation %s", pe.GetOperation())}
+	}
+
+	return orchestrator.Event{
+		Location:  pe.GetLocation(),
+		Operation: op,
+		ID:        pe.GetId(),
+		Trigger:   pe.GetTrigger(),
+	}, nil
+}
+
+// GRPCInputOption configures optional behaviour of a GRPCInput
+type GRPCInputOption func(*grpcInputOptions)
+
+type grpcInputOptions struct {
+	inputOptions
+
+	serverOptions []grpc.ServerOption
+}
+
+func defaultGRPCInputOptions(opts []GRPCInputOption) (o grpcInputOptions) {
+	o = grpcInputOptions{
+		inputOptions: defaultInputOptions(nil),
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return
+}
+
+// WithInputOptions applies InputOptions shared with the other Inputs in
+// this package, such as WithAuthenticator, to a GRPCInput
+func WithInputOptions(opts ...InputOption) GRPCInputOption {
+	return func(o *grpcInputOptions) {
+		for _, opt := range opts {
+			opt(&o.inputOptions)
+		}
+	}
+}
+
+// WithServerOptions sets options used to create the gRPC server a
+// GRPCInput listens with, such as grpc.Creds to serve over TLS
+func WithServerOptions(opts ...grpc.ServerOption) GRPCInputOption {
+	return func(o *grpcInputOptions) {
+		o.serverOptions = append(o.serverOptions, opts...)
+	}
+}
+
+// GRPCInput implements the orchestrator.Input interface, exposing the
+// Events service described in eventspb/events.proto, through which
+// producers publish Events either one at a time, via Publish, or over a
+// stream, via PublishStream.
+//
+// Each Event is acknowledged once it has been passed to the orchestrator,
+// and not before; streams are read no faster than the orchestrator accepts
+// Events, so publishers which get too far ahead are held back by gRPC flow
+// control rather than queued in memory.
+//
+// Callers are authenticated, where an Authenticator is set via
+// WithInputOptions(WithAuthenticator(...)), from the metadata sent with
+// each call, exactly as though the metadata were the headers of a request
+// to an Input
+type GRPCInput struct {
+	eventspb.UnimplementedEventsServer
+
+	ic     orchestrator.InputConfig
+	opts   grpcInputOptions
+	health *inputHealth
+
+	c    chan orchestrator.Event
+	done <-chan struct{}
+}
+
+// NewGRPCInput is an orchestrator.NewInputFunc which configures a new
+// GRPCInput, listening on the address specified in the ConnectionString
+// field of the InputConfig passed to this function, such as ":9090".
+//
+// Nothing is listened on until Handle is called
+func NewGRPCInput(ic orchestrator.InputConfig, opts ...GRPCInputOption) (g *GRPCInput, err error) {
+	g = new(GRPCInput)
+	g.ic = ic
+	g.opts = defaultGRPCInputOptions(opts)
+	g.health = new(inputHealth)
+
+	return
+}
+
+// Handle implements the Handle function of the orchestrator.Input interface
+//
+// It serves the Events service, passing each Event published down chan
+// `c`, until ctx is cancelled, at which point any open calls are ended
+// with UNAVAILABLE
+func (g *GRPCInput) Handle(ctx context.Context, c chan orchestrator.Event) (err error) {
+	l, err := net.Listen("tcp", g.ic.ConnectionString)
+	if err != nil {
+		return
+	}
+
+	return g.serve(ctx, l, c)
+}
+
+func (g *GRPCInput) serve(ctx context.Context, l net.Listener, c chan orchestrator.Event) (err error) {
+	g.c = c
+	g.done = ctx.Done()
+
+	opts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(g.unaryInterceptor),
+		grpc.ChainStreamInterceptor(g.streamInterceptor),
+	}, g.opts.serverOptions...)
+
+	s := grpc.NewServer(opts...)
+	eventspb.RegisterEventsServer(s, g)
+
+	g.health.state.Store(stateRunning)
+	defer g.health.state.Store(stateStopped)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(l)
+	}()
+
+	select {
+	case <-ctx.Done():
+		// Streams may be idle indefinitely, and so would hold up a
+		// graceful stop
+		s.Stop()
+		<-errs
+
+		return ctx.Err()
+
+	case err = <-errs:
+		return
+	}
+}
+
+// ID returns an ID for this input
+func (g *GRPCInput) ID() string {
+	return g.ic.ID()
+}
+
+// Health implements the HealthChecker interface.
+//
+// A GRPCInput is live until its Handle function returns, and ready while
+// Handle is running and fewer Events than the queue limit are waiting on
+// the orchestrator
+func (g *GRPCInput) Health() (live, ready bool, detail map[string]any) {
+	state := g.health.state.Load()
+	pending := g.health.pending.Load()
+	saturated := pending >= int64(g.opts.queueLimit)
+
+	return state != stateStopped, state == stateRunning && !saturated, map[string]any{
+		"state":       stateNames[state],
+		"queue_depth": pending,
+		"queue_limit": g.opts.queueLimit,
+		"saturated":   saturated,
+	}
+}
+
+// Publish implements the eventspb.EventsServer interface
+func (g *GRPCInput) Publish(ctx context.Context, req *eventspb.PublishRequest) (*eventspb.Ack, error) {
+	id, _ := RequestIDFromContext(ctx)
+
+	e, err := EventFromProto(req.GetEvent())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = g.emit(ctx, e, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &eventspb.Ack{Sequence: req.GetSequence(), Accepted: true, RequestId: id}, nil
+}
+
+// PublishStream implements the eventspb.EventsServer interface
+func (g *GRPCInput) PublishStream(stream eventspb.Events_PublishStreamServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// Each Event on a stream is its own request, as far as
+		// logging and any Process it reaches are concerned
+		ack := &eventspb.Ack{Sequence: req.GetSequence(), RequestId: uuid.NewString()}
+
+		e, err := EventFromProto(req.GetEvent())
+		if err != nil {
+			ack.Error = err.Error()
+		} else {
+			err = g.emit(stream.Context(), e, ack.RequestId)
+			if err != nil {
+				return err
+			}
+
+			ack.Accepted = true
+		}
+
+		err = stream.Send(ack)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// emit passes e to the orchestrator, blocking until it is accepted, or
+// the call or input is done
+func (g *GRPCInput) emit(ctx context.Context, e orchestrator.Event, id string) error {
+	e.Trigger = g.ID()
+	rememberRequestID(e, id)
+
+	g.health.pending.Add(1)
+	defer g.health.pending.Add(-1)
+
+	select {
+	case g.c <- e:
+		return nil
+
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+
+	case <-g.done:
+		return status.Error(codes.Unavailable, "input is shutting down")
+	}
+}
+
+func (g *GRPCInput) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	start := time.Now()
+	id := incomingRequestID(ctx)
+
+	ctx = ContextWithRequestID(ctx, id)
+
+	header := metadata.Pairs(strings.ToLower(RequestIDHeader), id)
+
+	err = g.authenticate(ctx, header)
+	grpc.SetHeader(ctx, header)
+
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+
+	g.logCall(ctx, info.FullMethod, id, start, err)
+
+	return
+}
+
+func (g *GRPCInput) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	id := incomingRequestID(ss.Context())
+
+	header := metadata.Pairs(strings.ToLower(RequestIDHeader), id)
+
+	err = g.authenticate(ss.Context(), header)
+	ss.SetHeader(header)
+
+	if err == nil {
+		err = handler(srv, ss)
+	}
+
+	g.logCall(ss.Context(), info.FullMethod, id, start, err)
+
+	return
+}
+
+// authenticate checks the metadata of a call with the Authenticator this
+// GRPCInput is configured with, if any, adding a challenge to header where
+// authentication fails
+func (g *GRPCInput) authenticate(ctx context.Context, header metadata.MD) error {
+	if g.opts.auth == nil {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	r := &http.Request{Header: make(http.Header)}
+	for k, v := range md {
+		// Skip pseudo-headers, such as :authority
+		if !strings.HasPrefix(k, ":") {
+			r.Header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	if g.opts.auth.Authenticate(r.WithContext(ctx)) != nil {
+		header.Set("www-authenticate", g.opts.auth.Challenge())
+
+		return status.Error(codes.Unauthenticated, UnauthorizedErr{}.Error())
+	}
+
+	return nil
+}
+
+func (g *GRPCInput) logCall(ctx context.Context, method, id string, start time.Time, err error) {
+	code := status.Code(err)
+
+	attrs := []slog.Attr{
+		slog.String("request_id", id),
+		slog.String("input", g.ID()),
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("latency", time.Since(start)),
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("remote_addr", p.Addr.String()))
+	}
+
+	level := slog.LevelInfo
+
+	switch code {
+	case codes.OK, codes.Canceled:
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+
+	g.opts.logger.LogAttrs(ctx, level, "grpc received", attrs...)
+}
+
+// incomingRequestID returns the request ID sent with a call, or a new one
+// where the caller sent none
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if v := md.Get(RequestIDHeader); len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+
+	return uuid.NewString()
+}
@@ -0,0 +1,336 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/dapper-data/dapper-orchestrator-contrib/webhooks/eventspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// startGRPCInput serves a GRPCInput on a random port, returning a client
+// for it and the channel it passes Events down. The input is stopped, and
+// any error it returns checked, when the test ends
+func startGRPCInput(t *testing.T, opts ...GRPCInputOption) (*GRPCInput, eventspb.EventsClient, chan orchestrator.Event) {
+	t.Helper()
+
+	g, err := NewGRPCInput(orchestrator.InputConfig{Name: "tests"}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan orchestrator.Event)
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- g.serve(ctx, l, c)
+	}()
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		cancel()
+
+		if err := <-errs; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, received %v", context.Canceled, err)
+		}
+	})
+
+	return g, eventspb.NewEventsClient(conn), c
+}
+
+// receive returns the next Event passed down c, failing the test if none
+// arrives promptly
+func receive(t *testing.T, c chan orchestrator.Event) orchestrator.Event {
+	t.Helper()
+
+	select {
+	case e := <-c:
+		return e
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	return orchestrator.Event{}
+}
+
+func TestGRPCInput_Publish(t *testing.T) {
+	_, client, c := startGRPCInput(t)
+
+	sent := orchestrator.Event{Location: "orders", Operation: orchestrator.OperationUpdate, ID: "42", Trigger: "ignored"}
+
+	type result struct {
+		ack    *eventspb.Ack
+		header metadata.MD
+		err    error
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		var r result
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "req-1")
+		r.ack, r.err = client.Publish(ctx, &eventspb.PublishRequest{Sequence: 7, Event: EventToProto(sent)}, grpc.Header(&r.header))
+
+		results <- r
+	}()
+
+	e := receive(t, c)
+	if e.Location != "orders" || e.Operation != orchestrator.OperationUpdate || e.ID != "42" || e.Trigger != "tests" {
+		t.Errorf("unexpected event %#v", e)
+	}
+
+	r := <-results
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+
+	if r.ack.GetSequence() != 7 || !r.ack.GetAccepted() || r.ack.GetRequestId() != "req-1" {
+		t.Errorf("unexpected ack %v", r.ack)
+	}
+
+	if id := r.header.Get("x-request-id"); len(id) != 1 || id[0] != "req-1" {
+		t.Errorf("expected request id to be echoed, received %v", id)
+	}
+
+	if id := eventRequestID(context.Background(), e); id != "req-1" {
+		t.Errorf("expected event to carry request id req-1, received %q", id)
+	}
+
+	t.Run("invalid event", func(t *testing.T) {
+		for _, req := range []*eventspb.PublishRequest{
+			{},
+			{Event: &eventspb.Event{Location: "orders"}},
+		} {
+			_, err := client.Publish(context.Background(), req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("expected %v, received %v", codes.InvalidArgument, err)
+			}
+		}
+	})
+}
+
+func TestGRPCInput_PublishStream(t *testing.T) {
+	g, client, c := startGRPCInput(t)
+
+	stream, err := client.PublishStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, op := range []orchestrator.Operation{orchestrator.OperationCreate, orchestrator.OperationUnknown, orchestrator.OperationDelete} {
+		err = stream.Send(&eventspb.PublishRequest{
+			Sequence: uint64(i + 1),
+			Event:    EventToProto(orchestrator.Event{Location: "orders", Operation: op, ID: "1"}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = stream.CloseSend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is acknowledged until the orchestrator takes the first
+	// Event, and the rest are held back in the meantime
+	deadline := time.Now().Add(5 * time.Second)
+	for g.health.pending.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if _, ready, detail := g.Health(); !ready || detail["queue_depth"] != int64(1) {
+		t.Errorf("expected a single waiting event, received %v", detail)
+	}
+
+	e := receive(t, c)
+	if e.Operation != orchestrator.OperationCreate {
+		t.Errorf("expected create, received %v", e.Operation)
+	}
+
+	ack, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ack.GetSequence() != 1 || !ack.GetAccepted() || ack.GetRequestId() == "" {
+		t.Errorf("unexpected ack %v", ack)
+	}
+
+	ack, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ack.GetSequence() != 2 || ack.GetAccepted() || ack.GetError() == "" {
+		t.Errorf("expected invalid event to be refused, received %v", ack)
+	}
+
+	e = receive(t, c)
+	if e.Operation != orchestrator.OperationDelete {
+		t.Errorf("expected delete, received %v", e.Operation)
+	}
+
+	ack, err = stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ack.GetSequence() != 3 || !ack.GetAccepted() {
+		t.Errorf("unexpected ack %v", ack)
+	}
+
+	_, err = stream.Recv()
+	if err == nil {
+		t.Error("expected stream to end")
+	}
+}
+
+func TestGRPCInput_Auth(t *testing.T) {
+	_, client, c := startGRPCInput(t, WithInputOptions(WithAuthenticator(BearerAuthenticator{Token: "t0ken"})))
+
+	go func() {
+		for range c {
+		}
+	}()
+
+	req := &eventspb.PublishRequest{Event: EventToProto(orchestrator.Event{Operation: orchestrator.OperationCreate})}
+
+	for _, test := range []struct {
+		name   string
+		md     []string
+		expect codes.Code
+	}{
+		{"missing token", nil, codes.Unauthenticated},
+		{"wrong token", []string{"authorization", "Bearer nope"}, codes.Unauthenticated},
+		{"valid token", []string{"authorization", "Bearer t0ken"}, codes.OK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := metadata.AppendToOutgoingContext(context.Background(), test.md...)
+
+			var header metadata.MD
+
+			_, err := client.Publish(ctx, req, grpc.Header(&header))
+			if status.Code(err) != test.expect {
+				t.Errorf("unary: expected %v, received %v", test.expect, err)
+			}
+
+			if test.expect == codes.Unauthenticated && len(header.Get("www-authenticate")) == 0 {
+				t.Error("expected a challenge")
+			}
+
+			stream, err := client.PublishStream(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = stream.Send(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = stream.Recv()
+			if status.Code(err) != test.expect {
+				t.Errorf("stream: expected %v, received %v", test.expect, err)
+			}
+
+			stream.CloseSend()
+		})
+	}
+}
+
+func TestGRPCInput_Shutdown(t *testing.T) {
+	g, err := NewGRPCInput(orchestrator.InputConfig{Name: "tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+
+	go func() {
+		// Nothing ever reads from this channel
+		errs <- g.serve(ctx, l, make(chan orchestrator.Event))
+	}()
+
+	conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	published := make(chan error, 1)
+	go func() {
+		_, err := eventspb.NewEventsClient(conn).Publish(context.Background(), &eventspb.PublishRequest{
+			Event: EventToProto(orchestrator.Event{Operation: orchestrator.OperationCreate}),
+		})
+
+		published <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-published; status.Code(err) != codes.Unavailable {
+		t.Errorf("expected %v, received %v", codes.Unavailable, err)
+	}
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, received %v", context.Canceled, err)
+	}
+
+	if live, _, _ := g.Health(); live {
+		t.Error("expected input to no longer be live")
+	}
+}
+
+func TestEventProto(t *testing.T) {
+	for _, e := range []orchestrator.Event{
+		{Location: "orders", Operation: orchestrator.OperationCreate, ID: "1", Trigger: "t"},
+		{Operation: orchestrator.OperationRead},
+		{Operation: orchestrator.OperationUpdate},
+		{Operation: orchestrator.OperationDelete},
+	} {
+		received, err := EventFromProto(EventToProto(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if received != e {
+			t.Errorf("expected %#v, received %#v", e, received)
+		}
+	}
+
+	_, err := EventFromProto(EventToProto(orchestrator.Event{}))
+	if !errors.As(err, new(InvalidEventErr)) {
+		t.Errorf("expected error of type %T, received %#v", InvalidEventErr{}, err)
+	}
+}
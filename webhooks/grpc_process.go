@@ -0,0 +1,958 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpccredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ExecutionContext keys used to configure a GRPCProcess. TimeoutKey,
+// CAFileKey, ClientCertKey, ClientKeyKey, and the credentials keys, such as
+// HeaderKeyPrefix and BearerTokenFileKey, apply too
+const (
+	// GRPCTargetKey sets the server to call, as a gRPC target such as
+	// "orders.internal:8443" or "dns:///orders.internal:8443"
+	GRPCTargetKey = "grpc_target"
+
+	// GRPCMethodKey sets the unary method to call, fully qualified, such
+	// as "orders.v1.Orders/Sync"
+	GRPCMethodKey = "grpc_method"
+
+	// GRPCDescriptorSetKey points to a binary FileDescriptorSet, as
+	// written by `protoc --include_imports --descriptor_set_out`, holding
+	// the method. Where unset, the method is looked up via server
+	// reflection on first use
+	GRPCDescriptorSetKey = "descriptor_set"
+
+	// GRPCFieldsKey maps the fields of the request message, as a JSON
+	// object. Strings anywhere within the object are text/templates
+	// executed against a MessageData, and are converted to the type of
+	// the field they set; objects set nested messages, and arrays set
+	// repeated fields, such as:
+	//
+	//	`{"order_id": "{{.ID}}", "source": {"table": "{{.Location}}"}, "tags": ["{{.Operation}}"]}`
+	//
+	// Enum fields are set by name, ignoring case and any prefix. By
+	// default, whichever of the fields location, operation, id, and
+	// trigger the request message has are set from the Event
+	GRPCFieldsKey = "fields"
+
+	// GRPCTLSKey, when "true", calls the server over TLS. TLS is also used
+	// whenever CAFileKey or ClientCertKey are set; otherwise calls are
+	// made in plaintext
+	GRPCTLSKey = "tls"
+
+	// GRPCMaxAttemptsKey sets the most times a call is attempted, including
+	// the first, where it fails with one of GRPCRetryableCodesKey. gRPC
+	// allows at most 5. By default calls are not retried
+	GRPCMaxAttemptsKey = "max_attempts"
+
+	// GRPCRetryBackoffKey sets the backoff before the first retry, which
+	// doubles with each further retry, as a duration string such as
+	// "200ms". The default is DefaultGRPCRetryBackoff
+	GRPCRetryBackoffKey = "retry_backoff"
+
+	// GRPCRetryableCodesKey lists, comma separated, the status codes which
+	// are retried, such as "UNAVAILABLE,RESOURCE_EXHAUSTED". The default
+	// is "UNAVAILABLE"
+	GRPCRetryableCodesKey = "retryable_codes"
+)
+
+// DefaultGRPCRetryBackoff is the backoff before the first retry where no
+// GRPCRetryBackoffKey is set
+const DefaultGRPCRetryBackoff = 100 * time.Millisecond
+
+// grpcLogPrefix prefixes gRPC results in ProcessStatus.Logs
+const grpcLogPrefix = "grpc: "
+
+// defaultGRPCFields are set on request messages where no GRPCFieldsKey is
+// configured, skipping any the message lacks
+var defaultGRPCFields = map[string]any{
+	"location":  "{{.Location}}",
+	"operation": "{{.Operation}}",
+	"id":        "{{.ID}}",
+	"trigger":   "{{.Trigger}}",
+}
+
+// MissingGRPCConfigErr is returned when an ExecutionContext passed to
+// NewGRPCProcess does not contain a required key
+type MissingGRPCConfigErr struct{ key string }
+
+// Error returns the error text for this error
+func (e MissingGRPCConfigErr) Error() string {
+	return fmt.Sprintf("error creating grpc process: missing %q config value", e.key)
+}
+
+// UnknownGRPCMethodErr is returned when the configured method can't be
+// found, or isn't unary
+type UnknownGRPCMethodErr struct {
+	method string
+	reason string
+}
+
+// Error returns the error text for this error
+func (e UnknownGRPCMethodErr) Error() string {
+	return fmt.Sprintf("grpc method %s: %s", e.method, e.reason)
+}
+
+// FieldMappingErr is returned when a value from GRPCFieldsKey can't be set
+// on the request message
+type FieldMappingErr struct {
+	field string
+	err   error
+}
+
+// Error returns the error text for this error
+func (e FieldMappingErr) Error() string {
+	return fmt.Sprintf("setting field %s: %v", e.field, e.err)
+}
+
+// Unwrap returns the underlying error
+func (e FieldMappingErr) Unwrap() error {
+	return e.err
+}
+
+// GRPCStatusErr is returned when a call completes with a status other than
+// OK. It can be passed to status.FromError and status.Code
+type GRPCStatusErr struct {
+	method string
+	status *status.Status
+}
+
+// Error returns the error text for this error
+func (e GRPCStatusErr) Error() string {
+	return fmt.Sprintf("grpc method %s returned %s: %s", e.method, e.status.Code(), e.status.Message())
+}
+
+// GRPCStatus returns the status the call completed with
+func (e GRPCStatusErr) GRPCStatus() *status.Status {
+	return e.status
+}
+
+// GRPCResult is the outcome of a call made by a GRPCProcess
+type GRPCResult struct {
+	Method   string          `json:"method"`
+	Code     string          `json:"code"`
+	Message  string          `json:"message,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+}
+
+// GRPCResults returns the results recorded into ps, in the order they
+// were received
+func GRPCResults(ps orchestrator.ProcessStatus) (r []GRPCResult) {
+	r = make([]GRPCResult, 0)
+
+	for _, l := range ps.Logs {
+		s, ok := strings.CutPrefix(l, grpcLogPrefix)
+		if !ok {
+			continue
+		}
+
+		var gr GRPCResult
+		if json.Unmarshal([]byte(s), &gr) == nil {
+			r = append(r, gr)
+		}
+	}
+
+	return
+}
+
+// GRPCOption configures optional behaviour of a GRPCProcess
+type GRPCOption func(*GRPCProcess)
+
+// WithDialOptions adds to the options used to create the connection a
+// GRPCProcess calls its server over, following those built from the
+// ExecutionContext
+func WithDialOptions(opts ...grpc.DialOption) GRPCOption {
+	return func(p *GRPCProcess) {
+		p.dialOptions = append(p.dialOptions, opts...)
+	}
+}
+
+// WithGRPCLogger sets the logger a GRPCProcess logs each call to, in
+// place of slog.Default()
+func WithGRPCLogger(l *slog.Logger) GRPCOption {
+	return func(p *GRPCProcess) {
+		p.logger = l
+	}
+}
+
+// GRPCProcess implements the orchestrator.Process interface, calling a
+// unary gRPC method with a request message built from each Event.
+//
+// Request messages are built dynamically, from descriptors read either
+// from a descriptor set or via server reflection, and so no generated code
+// is needed to call a service
+type GRPCProcess struct {
+	pc      orchestrator.ProcessConfig
+	method  string
+	timeout time.Duration
+	fields  map[string]any
+	strict  bool
+	logger  *slog.Logger
+
+	conn        *grpc.ClientConn
+	dialOptions []grpc.DialOption
+
+	credentials []Credentials
+	secrets     []string
+
+	mu   sync.Mutex
+	desc protoreflect.MethodDescriptor
+}
+
+// NewGRPCProcess returns a GRPCProcess calling the method set via
+// GRPCMethodKey on the server set via GRPCTargetKey.
+//
+// Where GRPCDescriptorSetKey is set, the method is resolved, and the
+// field mapping checked, immediately; otherwise this happens via server
+// reflection on the first call, and is retried until it succeeds.
+//
+// Calls time out after TimeoutKey, across every attempt, and are retried
+// as configured with GRPCMaxAttemptsKey. The status and response of each
+// call are recorded into ProcessStatus.Logs, from where they can be read
+// back with GRPCResults
+func NewGRPCProcess(pc orchestrator.ProcessConfig, opts ...GRPCOption) (p *GRPCProcess, err error) {
+	ec := pc.ExecutionContext
+
+	p = &GRPCProcess{
+		pc:     pc,
+		logger: slog.Default(),
+	}
+
+	target := ec[GRPCTargetKey]
+	if target == "" {
+		return nil, MissingGRPCConfigErr{GRPCTargetKey}
+	}
+
+	p.method, err = grpcMethodName(ec[GRPCMethodKey])
+	if err != nil {
+		return nil, err
+	}
+
+	p.timeout, err = durationValue(ec, TimeoutKey, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.fields, p.strict, err = grpcFieldsFromConfig(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := grpcTransport(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceConfig, err := grpcRetryPolicy(ec, p.method)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token requests, where OAuth2TokenURLKey is set, are made with the
+	// same HTTP client configuration a Process would use
+	client, err := newHTTPClient(ec)
+	if err != nil {
+		return nil, err
+	}
+
+	p.credentials, p.secrets, err = credentialsFromConfig(ec, client)
+	if err != nil {
+		return nil, err
+	}
+
+	p.dialOptions = []grpc.DialOption{
+		grpc.WithTransportCredentials(transport),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if f, ok := ec[GRPCDescriptorSetKey]; ok {
+		p.desc, err = methodFromDescriptorSet(f, p.method)
+		if err != nil {
+			return nil, InvalidConfigErr{GRPCDescriptorSetKey, f, err}
+		}
+
+		// Build a request from empty values, which leave fields unset,
+		// to catch fields which don't exist, or can never be converted
+		_, err = p.message(p.desc, MessageData{})
+		if errors.As(err, new(FieldMappingErr)) {
+			return nil, InvalidConfigErr{GRPCFieldsKey, ec[GRPCFieldsKey], err}
+		}
+	}
+
+	p.conn, err = grpc.NewClient(target, p.dialOptions...)
+	if err != nil {
+		return nil, InvalidConfigErr{GRPCTargetKey, target, err}
+	}
+
+	return p, nil
+}
+
+// Run calls the configured method with a request built from e.
+//
+// Any error is also recorded into the logs field of the returned
+// orchestrator.ProcessStatus, alongside the status and response of
+// the call
+func (p *GRPCProcess) Run(ctx context.Context, e orchestrator.Event) (ps orchestrator.ProcessStatus, err error) {
+	ps.Name = p.ID()
+	ps.Status = orchestrator.ProcessUnstarted
+	ps.Logs = make([]string, 0)
+
+	id := eventRequestID(ctx, e)
+
+	defer func() {
+		if err != nil {
+			ps.Logs = append(ps.Logs, p.redact(err.Error()))
+		}
+	}()
+
+	md, err := p.descriptor(ctx)
+	if err != nil {
+		return
+	}
+
+	req, err := p.request(md, e, id)
+	if err != nil {
+		return
+	}
+
+	ctx, err = p.outgoingContext(ctx, id)
+	if err != nil {
+		return
+	}
+
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	resp := dynamicpb.NewMessage(md.Output())
+
+	start := time.Now()
+	err = p.conn.Invoke(ctx, p.method, req, resp)
+
+	s := status.Convert(err)
+	p.logCall(ctx, id, start, s)
+
+	result := GRPCResult{
+		Method:  p.method,
+		Code:    s.Code().String(),
+		Message: s.Message(),
+	}
+
+	if err != nil {
+		p.recordResult(&ps, result)
+
+		ps.Status = orchestrator.ProcessFail
+		err = GRPCStatusErr{p.method, s}
+
+		return
+	}
+
+	result.Response, err = protojson.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	p.recordResult(&ps, result)
+	ps.Status = orchestrator.ProcessSuccess
+
+	return
+}
+
+func (p *GRPCProcess) recordResult(ps *orchestrator.ProcessStatus, r GRPCResult) {
+	b, err := json.Marshal(r)
+	if err == nil {
+		ps.Logs = append(ps.Logs, grpcLogPrefix+p.redact(string(b)))
+	}
+}
+
+// ID returns an ID for this process
+func (p *GRPCProcess) ID() string {
+	return p.pc.ID()
+}
+
+// Close closes the connection this GRPCProcess calls its server over
+func (p *GRPCProcess) Close() error {
+	return p.conn.Close()
+}
+
+// descriptor returns the descriptor of the configured method, looking it
+// up via server reflection if it isn't yet known
+func (p *GRPCProcess) descriptor(ctx context.Context) (md protoreflect.MethodDescriptor, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.desc != nil {
+		return p.desc, nil
+	}
+
+	p.desc, err = methodFromReflection(ctx, p.conn, p.method)
+
+	return p.desc, err
+}
+
+// request builds the request message of md for e
+func (p *GRPCProcess) request(md protoreflect.MethodDescriptor, e orchestrator.Event, id string) (*dynamicpb.Message, error) {
+	return p.message(md, MessageData{
+		Process:   p.pc.Name,
+		Location:  e.Location,
+		Operation: e.Operation.String(),
+		ID:        e.ID,
+		Trigger:   e.Trigger,
+		RequestID: id,
+	})
+}
+
+// message builds the request message of md from data
+func (p *GRPCProcess) message(md protoreflect.MethodDescriptor, data MessageData) (m *dynamicpb.Message, err error) {
+	v, err := renderVariables(p.fields, data)
+	if err != nil {
+		return nil, fmt.Errorf("rendering fields: %w", err)
+	}
+
+	m = dynamicpb.NewMessage(md.Input())
+	err = setFields(m, "", v.(map[string]any), p.strict)
+
+	return
+}
+
+// outgoingContext adds the request ID, and any credentials, to the
+// metadata sent with a call
+func (p *GRPCProcess) outgoingContext(ctx context.Context, id string) (context.Context, error) {
+	// Credentials set HTTP headers, which are carried across as metadata
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	if err != nil {
+		return ctx, err
+	}
+
+	for _, c := range p.credentials {
+		err = c.Apply(r)
+		if err != nil {
+			return ctx, err
+		}
+	}
+
+	md := metadata.Pairs(strings.ToLower(RequestIDHeader), id)
+	for k, v := range r.Header {
+		md.Append(strings.ToLower(k), v...)
+	}
+
+	return metadata.NewOutgoingContext(ctx, md), nil
+}
+
+func (p *GRPCProcess) logCall(ctx context.Context, id string, start time.Time, s *status.Status) {
+	attrs := []slog.Attr{
+		slog.String("request_id", id),
+		slog.String("process", p.ID()),
+		slog.String("method", p.method),
+		slog.String("code", s.Code().String()),
+		slog.Duration("latency", time.Since(start)),
+	}
+
+	level := slog.LevelInfo
+	if s.Code() != codes.OK {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", p.redact(s.Message())))
+	}
+
+	p.logger.LogAttrs(ctx, level, "grpc call", attrs...)
+}
+
+// redact replaces any of the secrets a GRPCProcess was configured with
+// in s
+func (p *GRPCProcess) redact(s string) string {
+	return redactSecrets(s, p.secrets)
+}
+
+// grpcMethodName validates a method set via GRPCMethodKey, returning it in
+// the form "/package.Service/Method" used on the wire
+func grpcMethodName(v string) (string, error) {
+	if v == "" {
+		return "", MissingGRPCConfigErr{GRPCMethodKey}
+	}
+
+	service, method, ok := strings.Cut(strings.TrimPrefix(v, "/"), "/")
+	if !ok || service == "" || method == "" || strings.Contains(method, "/") {
+		return "", InvalidConfigErr{GRPCMethodKey, v, fmt.Errorf("must be of the form package.Service/Method")}
+	}
+
+	return "/" + service + "/" + method, nil
+}
+
+func grpcFieldsFromConfig(ec map[string]string) (fields map[string]any, strict bool, err error) {
+	vars := defaultGRPCFields
+
+	v, strict := ec[GRPCFieldsKey]
+	if strict {
+		vars = make(map[string]any)
+
+		err = json.Unmarshal([]byte(v), &vars)
+		if err != nil {
+			return nil, false, InvalidConfigErr{GRPCFieldsKey, v, err}
+		}
+	}
+
+	tmpl, err := parseVariables(vars)
+	if err != nil {
+		return nil, false, InvalidConfigErr{GRPCFieldsKey, v, err}
+	}
+
+	return tmpl.(map[string]any), strict, nil
+}
+
+// grpcTransport returns the transport credentials calls are made with
+func grpcTransport(ec map[string]string) (tc grpccredentials.TransportCredentials, err error) {
+	on := false
+	if v, ok := ec[GRPCTLSKey]; ok {
+		on, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, InvalidConfigErr{GRPCTLSKey, v, err}
+		}
+	}
+
+	_, ca := ec[CAFileKey]
+	_, cert := ec[ClientCertKey]
+
+	if !on && !ca && !cert {
+		return insecure.NewCredentials(), nil
+	}
+
+	c, err := tlsConfig(ec)
+	if err != nil {
+		return
+	}
+
+	return grpccredentials.NewTLS(c), nil
+}
+
+// grpcRetryPolicy returns a service config retrying calls to method as
+// configured
+func grpcRetryPolicy(ec map[string]string, method string) (sc string, err error) {
+	attempts, err := intValue(ec, GRPCMaxAttemptsKey, 1)
+	if err != nil {
+		return
+	}
+
+	if attempts < 2 {
+		return "{}", nil
+	}
+
+	backoff, err := durationValue(ec, GRPCRetryBackoffKey, DefaultGRPCRetryBackoff)
+	if err != nil {
+		return
+	}
+
+	if backoff <= 0 {
+		return "", InvalidConfigErr{GRPCRetryBackoffKey, ec[GRPCRetryBackoffKey], fmt.Errorf("must be positive")}
+	}
+
+	retryable := []string{"UNAVAILABLE"}
+	if v, ok := ec[GRPCRetryableCodesKey]; ok {
+		retryable = retryable[:0]
+
+		for _, name := range strings.Split(v, ",") {
+			var c codes.Code
+
+			name = strings.ToUpper(strings.TrimSpace(name))
+			if c.UnmarshalJSON([]byte(strconv.Quote(name))) != nil || c == codes.OK {
+				return "", InvalidConfigErr{GRPCRetryableCodesKey, v, fmt.Errorf("unknown status code %q", name)}
+			}
+
+			retryable = append(retryable, name)
+		}
+	}
+
+	service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+
+	b, err := json.Marshal(map[string]any{
+		"methodConfig": []map[string]any{{
+			"name": []map[string]string{{"service": service, "method": name}},
+			"retryPolicy": retryPolicy{
+				MaxAttempts:          attempts,
+				InitialBackoff:       fmt.Sprintf("%gs", backoff.Seconds()),
+				MaxBackoff:           fmt.Sprintf("%gs", (backoff << (attempts - 1)).Seconds()),
+				BackoffMultiplier:    2,
+				RetryableStatusCodes: retryable,
+			},
+		}},
+	})
+
+	return string(b), err
+}
+
+// methodFromDescriptorSet reads the descriptor of method from the
+// FileDescriptorSet at path f
+func methodFromDescriptorSet(f, method string) (md protoreflect.MethodDescriptor, err error) {
+	b, err := os.ReadFile(f)
+	if err != nil {
+		return
+	}
+
+	fds := new(descriptorpb.FileDescriptorSet)
+
+	err = proto.Unmarshal(b, fds)
+	if err != nil {
+		return
+	}
+
+	return findMethod(fds, method)
+}
+
+// methodFromReflection looks up the descriptor of method from the server
+// conn connects to, via server reflection
+func methodFromReflection(ctx context.Context, conn *grpc.ClientConn, method string) (md protoreflect.MethodDescriptor, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("starting server reflection: %w", err)
+	}
+
+	service, _, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+
+	fds := new(descriptorpb.FileDescriptorSet)
+	seen := make(map[string]bool)
+
+	// Ask for the file holding the service, then for any of its imports
+	// the server didn't send alongside it
+	reqs := []*reflectionpb.ServerReflectionRequest{{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}}
+
+	for len(reqs) > 0 {
+		err = stream.Send(reqs[0])
+		if err != nil {
+			return nil, fmt.Errorf("querying server reflection: %w", err)
+		}
+
+		reqs = reqs[1:]
+
+		var resp *reflectionpb.ServerReflectionResponse
+
+		resp, err = stream.Recv()
+		if err != nil {
+			return nil, fmt.Errorf("querying server reflection: %w", err)
+		}
+
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, UnknownGRPCMethodErr{method, fmt.Sprintf("server reflection: %s", e.GetErrorMessage())}
+		}
+
+		for _, b := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := new(descriptorpb.FileDescriptorProto)
+
+			err = proto.Unmarshal(b, fd)
+			if err != nil {
+				return
+			}
+
+			if seen[fd.GetName()] {
+				continue
+			}
+
+			seen[fd.GetName()] = true
+			fds.File = append(fds.File, fd)
+		}
+
+		if len(reqs) == 0 {
+			for _, fd := range fds.File {
+				for _, dep := range fd.GetDependency() {
+					if !seen[dep] {
+						seen[dep] = true
+						reqs = append(reqs, &reflectionpb.ServerReflectionRequest{
+							MessageRequest: &reflectionpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+						})
+					}
+				}
+			}
+		}
+	}
+
+	err = stream.CloseSend()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return
+	}
+
+	return findMethod(fds, method)
+}
+
+// findMethod returns the descriptor of method from fds, which must be
+// unary
+func findMethod(fds *descriptorpb.FileDescriptorSet, method string) (md protoreflect.MethodDescriptor, err error) {
+	files, err := protodesc.NewFiles(fds)
+	if err != nil {
+		return
+	}
+
+	service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, UnknownGRPCMethodErr{method, "service not found"}
+	}
+
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, UnknownGRPCMethodErr{method, fmt.Sprintf("%s is not a service", service)}
+	}
+
+	md = sd.Methods().ByName(protoreflect.Name(name))
+	switch {
+	case md == nil:
+		return nil, UnknownGRPCMethodErr{method, "method not found"}
+
+	case md.IsStreamingClient() || md.IsStreamingServer():
+		return nil, UnknownGRPCMethodErr{method, "only unary methods can be called"}
+	}
+
+	return
+}
+
+// setFields sets the fields of m from v, as rendered from GRPCFieldsKey.
+// Where strict is false, fields m lacks are skipped
+func setFields(m protoreflect.Message, prefix string, v map[string]any, strict bool) error {
+	fields := m.Descriptor().Fields()
+
+	for name, value := range v {
+		path := prefix + name
+
+		fd := fields.ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = fields.ByJSONName(name)
+		}
+
+		if fd == nil {
+			if strict {
+				return FieldMappingErr{path, fmt.Errorf("no such field in %s", m.Descriptor().FullName())}
+			}
+
+			continue
+		}
+
+		err := setField(m, fd, path, value, strict)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setField(m protoreflect.Message, fd protoreflect.FieldDescriptor, path string, v any, strict bool) error {
+	switch {
+	case fd.IsMap():
+		return FieldMappingErr{path, fmt.Errorf("map fields can't be mapped")}
+
+	case fd.IsList():
+		items, ok := v.([]any)
+		if !ok {
+			return FieldMappingErr{path, fmt.Errorf("repeated fields must be set from an array")}
+		}
+
+		l := m.Mutable(fd).List()
+		for i, item := range items {
+			if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+				e := l.NewElement()
+
+				err := setMessage(e.Message(), fd, fmt.Sprintf("%s[%d]", path, i), item, strict)
+				if err != nil {
+					return err
+				}
+
+				l.Append(e)
+
+				continue
+			}
+
+			s, ok := item.(string)
+			if !ok {
+				return FieldMappingErr{fmt.Sprintf("%s[%d]", path, i), fmt.Errorf("must be a string")}
+			}
+
+			pv, err := scalarValue(fd, s)
+			if err != nil {
+				return FieldMappingErr{fmt.Sprintf("%s[%d]", path, i), err}
+			}
+
+			l.Append(pv)
+		}
+
+		return nil
+
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		return setMessage(m.Mutable(fd).Message(), fd, path, v, strict)
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return FieldMappingErr{path, fmt.Errorf("must be a string")}
+	}
+
+	pv, err := scalarValue(fd, s)
+	if err != nil {
+		return FieldMappingErr{path, err}
+	}
+
+	m.Set(fd, pv)
+
+	return nil
+}
+
+// setMessage sets the message field m from either an object, setting its
+// fields, or a string, holding the JSON form of the message
+func setMessage(m protoreflect.Message, fd protoreflect.FieldDescriptor, path string, v any, strict bool) error {
+	switch v := v.(type) {
+	case map[string]any:
+		return setFields(m, path+".", v, strict)
+
+	case string:
+		if v == "" {
+			return nil
+		}
+
+		err := protojson.Unmarshal([]byte(v), m.Interface())
+		if err != nil {
+			return FieldMappingErr{path, err}
+		}
+
+		return nil
+	}
+
+	return FieldMappingErr{path, fmt.Errorf("%s must be set from an object", fd.Message().FullName())}
+}
+
+// scalarValue converts s to the type of fd. Empty strings leave numeric and
+// boolean fields unset, at their zero value
+func scalarValue(fd protoreflect.FieldDescriptor, s string) (v protoreflect.Value, err error) {
+	if s == "" && fd.Kind() != protoreflect.StringKind && fd.Kind() != protoreflect.BytesKind {
+		return fd.Default(), nil
+	}
+
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(s)), nil
+
+	case protoreflect.BoolKind:
+		var b bool
+
+		b, err = strconv.ParseBool(s)
+
+		return protoreflect.ValueOfBool(b), err
+
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var i int64
+
+		i, err = strconv.ParseInt(s, 10, 32)
+
+		return protoreflect.ValueOfInt32(int32(i)), err
+
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var i int64
+
+		i, err = strconv.ParseInt(s, 10, 64)
+
+		return protoreflect.ValueOfInt64(i), err
+
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var u uint64
+
+		u, err = strconv.ParseUint(s, 10, 32)
+
+		return protoreflect.ValueOfUint32(uint32(u)), err
+
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var u uint64
+
+		u, err = strconv.ParseUint(s, 10, 64)
+
+		return protoreflect.ValueOfUint64(u), err
+
+	case protoreflect.FloatKind:
+		var f float64
+
+		f, err = strconv.ParseFloat(s, 32)
+
+		return protoreflect.ValueOfFloat32(float32(f)), err
+
+	case protoreflect.DoubleKind:
+		var f float64
+
+		f, err = strconv.ParseFloat(s, 64)
+
+		return protoreflect.ValueOfFloat64(f), err
+
+	case protoreflect.EnumKind:
+		return enumValue(fd.Enum(), s)
+	}
+
+	return v, fmt.Errorf("unsupported field kind %s", fd.Kind())
+}
+
+// enumValue returns the value of ed named s, ignoring case and any prefix
+// such as "OPERATION_", or numbered s
+func enumValue(ed protoreflect.EnumDescriptor, s string) (v protoreflect.Value, err error) {
+	values := ed.Values()
+
+	if ev := values.ByName(protoreflect.Name(s)); ev != nil {
+		return protoreflect.ValueOfEnum(ev.Number()), nil
+	}
+
+	for i := 0; i < values.Len(); i++ {
+		name := string(values.Get(i).Name())
+
+		if strings.EqualFold(name, s) || strings.HasSuffix(strings.ToUpper(name), "_"+strings.ToUpper(s)) {
+			return protoreflect.ValueOfEnum(values.Get(i).Number()), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return v, fmt.Errorf("no value %q in enum %s", s, ed.FullName())
+	}
+
+	return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+}
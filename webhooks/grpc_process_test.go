@@ -0,0 +1,484 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// syncerFile describes the service called in these tests, as if compiled
+// from:
+//
+//	syntax = "proto3";
+//	package tests.v1;
+//
+//	enum Operation { OPERATION_UNKNOWN = 0; OPERATION_CREATE = 1; OPERATION_UPDATE = 2; }
+//	message Source { string trigger = 1; }
+//	message SyncRequest {
+//	  string location = 1; Operation operation = 2; string id = 3; int64 attempt = 4;
+//	  bool urgent = 5; Source source = 6; repeated string tags = 7;
+//	}
+//	message SyncResponse { bool ok = 1; string note = 2; }
+//
+//	service Syncer {
+//	  rpc Sync(SyncRequest) returns (SyncResponse);
+//	  rpc Watch(SyncRequest) returns (stream SyncResponse);
+//	}
+func syncerFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, n int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(n),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+
+		return f
+	}
+
+	tags := field("tags", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")
+	tags.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("tests/v1/syncer.proto"),
+		Package: proto.String("tests.v1"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Operation"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("OPERATION_UNKNOWN"), Number: proto.Int32(0)},
+				{Name: proto.String("OPERATION_CREATE"), Number: proto.Int32(1)},
+				{Name: proto.String("OPERATION_UPDATE"), Number: proto.Int32(2)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name:  proto.String("Source"),
+				Field: []*descriptorpb.FieldDescriptorProto{field("trigger", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "")},
+			},
+			{
+				Name: proto.String("SyncRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("location", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("operation", 2, descriptorpb.FieldDescriptorProto_TYPE_ENUM, ".tests.v1.Operation"),
+					field("id", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+					field("attempt", 4, descriptorpb.FieldDescriptorProto_TYPE_INT64, ""),
+					field("urgent", 5, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+					field("source", 6, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, ".tests.v1.Source"),
+					tags,
+				},
+			},
+			{
+				Name: proto.String("SyncResponse"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("ok", 1, descriptorpb.FieldDescriptorProto_TYPE_BOOL, ""),
+					field("note", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, ""),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Syncer"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				{Name: proto.String("Sync"), InputType: proto.String(".tests.v1.SyncRequest"), OutputType: proto.String(".tests.v1.SyncResponse")},
+				{Name: proto.String("Watch"), InputType: proto.String(".tests.v1.SyncRequest"), OutputType: proto.String(".tests.v1.SyncResponse"), ServerStreaming: proto.Bool(true)},
+			},
+		}},
+	}
+}
+
+// syncHandler handles a call to Sync, returning the note to respond with
+type syncHandler func(ctx context.Context, req *dynamicpb.Message) (note string, err error)
+
+// grpcServer starts an in-process server implementing tests.v1.Syncer,
+// along with server reflection, returning its address and the path to a
+// descriptor set describing it
+func grpcServer(t *testing.T, h syncHandler, opts ...grpc.ServerOption) (addr, descriptorSet string) {
+	t.Helper()
+
+	fdp := syncerFile()
+
+	fd, err := protodesc.NewFile(fdp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := new(protoregistry.Files)
+
+	err = files.RegisterFile(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	descriptorSet = filepath.Join(t.TempDir(), "syncer.pb")
+
+	err = os.WriteFile(descriptorSet, b, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := fd.Services().ByName("Syncer")
+	method := service.Methods().ByName("Sync")
+
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: string(service.FullName()),
+		HandlerType: (*any)(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Sync",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				req := dynamicpb.NewMessage(method.Input())
+
+				err := dec(req)
+				if err != nil {
+					return nil, err
+				}
+
+				note, err := h(ctx, req)
+				if err != nil {
+					return nil, err
+				}
+
+				resp := dynamicpb.NewMessage(method.Output())
+				resp.Set(method.Output().Fields().ByName("ok"), protoreflect.ValueOfBool(true))
+				resp.Set(method.Output().Fields().ByName("note"), protoreflect.ValueOfString(note))
+
+				return resp, nil
+			},
+		}},
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Watch",
+			ServerStreams: true,
+			Handler:       func(any, grpc.ServerStream) error { return nil },
+		}},
+	}, struct{}{})
+
+	reflectionpb.RegisterServerReflectionServer(s, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           s,
+		DescriptorResolver: files,
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+
+	return l.Addr().String(), descriptorSet
+}
+
+func newGRPCProcess(t *testing.T, ec map[string]string) *GRPCProcess {
+	t.Helper()
+
+	p, err := NewGRPCProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: ec,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { p.Close() })
+
+	return p
+}
+
+func TestGRPCProcess_Run(t *testing.T) {
+	var (
+		received *dynamicpb.Message
+		md       metadata.MD
+	)
+
+	addr, descriptorSet := grpcServer(t, func(ctx context.Context, req *dynamicpb.Message) (string, error) {
+		received = req
+		md, _ = metadata.FromIncomingContext(ctx)
+
+		return "synced", nil
+	})
+
+	e := orchestrator.Event{Location: "orders", Operation: orchestrator.OperationCreate, ID: "42", Trigger: "orders_trigger"}
+
+	for _, test := range []struct {
+		name   string
+		ec     map[string]string
+		expect map[string]string
+	}{
+		{"default fields via reflection", map[string]string{}, map[string]string{
+			"location": "orders", "operation": "OPERATION_CREATE", "id": "42", "attempt": "0", "urgent": "false",
+		}},
+		{"default fields via descriptor set", map[string]string{GRPCDescriptorSetKey: descriptorSet}, map[string]string{
+			"location": "orders", "operation": "OPERATION_CREATE", "id": "42",
+		}},
+		{"mapped fields", map[string]string{
+			GRPCFieldsKey: `{"id": "order-{{.ID}}", "attempt": "{{.ID}}", "urgent": "true", "operation": "update", "source": {"trigger": "{{.Trigger}}"}, "tags": ["{{.Location}}", "{{.Process}}"]}`,
+		}, map[string]string{
+			"location": "", "id": "order-42", "attempt": "42", "urgent": "true", "operation": "OPERATION_UPDATE",
+			"source.trigger": "orders_trigger", "tags": "[orders tests]",
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[GRPCTargetKey] = addr
+			test.ec[GRPCMethodKey] = "tests.v1.Syncer/Sync"
+			test.ec[HeaderKeyPrefix+"X-Api-Key"] = "sekrit"
+
+			ps, err := newGRPCProcess(t, test.ec).Run(ContextWithRequestID(context.Background(), "req-1"), e)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ps.Status != orchestrator.ProcessSuccess {
+				t.Errorf("expected %v, received %v", orchestrator.ProcessSuccess, ps.Status)
+			}
+
+			for field, v := range test.expect {
+				if received := fieldString(received, field); received != v {
+					t.Errorf("%s: expected %q, received %q", field, v, received)
+				}
+			}
+
+			if id := md.Get("x-request-id"); len(id) != 1 || id[0] != "req-1" {
+				t.Errorf("expected request id req-1, received %v", id)
+			}
+
+			if key := md.Get("x-api-key"); len(key) != 1 || key[0] != "sekrit" {
+				t.Errorf("expected api key header, received %v", key)
+			}
+
+			results := GRPCResults(ps)
+			if len(results) != 1 || results[0].Code != "OK" || string(results[0].Response) == "" {
+				t.Errorf("expected a single OK result with a response, received %#v", results)
+			}
+		})
+	}
+}
+
+// fieldString returns the value of a, possibly nested, field of m
+func fieldString(m protoreflect.Message, field string) string {
+	if parent, child, ok := strings.Cut(field, "."); ok {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(parent))
+
+		return fieldString(m.Get(fd).Message(), child)
+	}
+
+	fd := m.Descriptor().Fields().ByName(protoreflect.Name(field))
+	v := m.Get(fd)
+
+	switch {
+	case fd.IsList():
+		s := make([]string, v.List().Len())
+		for i := range s {
+			s[i] = v.List().Get(i).String()
+		}
+
+		return fmt.Sprint(s)
+
+	case fd.Kind() == protoreflect.EnumKind:
+		return string(fd.Enum().Values().ByNumber(v.Enum()).Name())
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+func TestGRPCProcess_Run_Errors(t *testing.T) {
+	var calls atomic.Int64
+
+	addr, _ := grpcServer(t, func(ctx context.Context, req *dynamicpb.Message) (string, error) {
+		n := calls.Add(1)
+
+		switch req.Get(req.Descriptor().Fields().ByName("id")).String() {
+		case "missing":
+			return "", status.Error(codes.NotFound, "no such order")
+
+		case "flaky":
+			if n%3 != 0 {
+				return "", status.Error(codes.Unavailable, "try again")
+			}
+
+		case "slow":
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+
+		return "ok", nil
+	})
+
+	for _, test := range []struct {
+		name        string
+		id          string
+		ec          map[string]string
+		expectCode  codes.Code
+		expectCalls int64
+	}{
+		{"error status", "missing", map[string]string{}, codes.NotFound, 1},
+		{"not retried by default", "flaky", map[string]string{}, codes.Unavailable, 1},
+		{"retried", "flaky", map[string]string{GRPCMaxAttemptsKey: "3", GRPCRetryBackoffKey: "10ms"}, codes.OK, 3},
+		{"non-retryable code", "missing", map[string]string{GRPCMaxAttemptsKey: "3", GRPCRetryBackoffKey: "10ms"}, codes.NotFound, 1},
+		{"deadline", "slow", map[string]string{TimeoutKey: "50ms"}, codes.DeadlineExceeded, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			calls.Store(0)
+
+			test.ec[GRPCTargetKey] = addr
+			test.ec[GRPCMethodKey] = "/tests.v1.Syncer/Sync"
+
+			ps, err := newGRPCProcess(t, test.ec).Run(context.Background(), orchestrator.Event{ID: test.id})
+			if status.Code(err) != test.expectCode {
+				t.Errorf("expected %v, received %v", test.expectCode, err)
+			}
+
+			if test.expectCode != codes.OK {
+				if !errors.As(err, new(GRPCStatusErr)) {
+					t.Errorf("expected error of type %T, received %#v", GRPCStatusErr{}, err)
+				}
+
+				if ps.Status != orchestrator.ProcessFail {
+					t.Errorf("expected %v, received %v", orchestrator.ProcessFail, ps.Status)
+				}
+			}
+
+			if calls.Load() != test.expectCalls {
+				t.Errorf("expected %d calls, received %d", test.expectCalls, calls.Load())
+			}
+		})
+	}
+}
+
+func TestGRPCProcess_Run_TLS(t *testing.T) {
+	// Borrow the certificate httptest generates, which is valid for
+	// 127.0.0.1
+	hs := httptest.NewUnstartedServer(http.NotFoundHandler())
+	hs.StartTLS()
+	hs.Close()
+
+	dir := t.TempDir()
+	ca := writePEM(t, dir, "ca.pem", "CERTIFICATE", hs.Certificate().Raw)
+
+	addr, _ := grpcServer(t, func(context.Context, *dynamicpb.Message) (string, error) {
+		return "ok", nil
+	}, grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: hs.TLS.Certificates})))
+
+	for _, test := range []struct {
+		name        string
+		ec          map[string]string
+		expectError bool
+	}{
+		{"plaintext", map[string]string{}, true},
+		{"untrusted server", map[string]string{GRPCTLSKey: "true"}, true},
+		{"trusted server", map[string]string{CAFileKey: ca}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[GRPCTargetKey] = addr
+			test.ec[GRPCMethodKey] = "tests.v1.Syncer/Sync"
+			test.ec[TimeoutKey] = "5s"
+
+			_, err := newGRPCProcess(t, test.ec).Run(context.Background(), orchestrator.Event{})
+			if err == nil && test.expectError {
+				t.Errorf("expected error, received none")
+			} else if err != nil && !test.expectError {
+				t.Errorf("unexpected error %#v", err)
+			}
+		})
+	}
+}
+
+func TestGRPCProcess_Run_UnknownMethod(t *testing.T) {
+	addr, _ := grpcServer(t, func(context.Context, *dynamicpb.Message) (string, error) {
+		return "ok", nil
+	})
+
+	for _, method := range []string{"tests.v1.Missing/Sync", "tests.v1.Syncer/Missing", "tests.v1.Syncer/Watch"} {
+		t.Run(method, func(t *testing.T) {
+			p := newGRPCProcess(t, map[string]string{GRPCTargetKey: addr, GRPCMethodKey: method})
+
+			ps, err := p.Run(context.Background(), orchestrator.Event{})
+			if !errors.As(err, new(UnknownGRPCMethodErr)) {
+				t.Errorf("expected error of type %T, received %#v", UnknownGRPCMethodErr{}, err)
+			}
+
+			if ps.Status != orchestrator.ProcessUnstarted {
+				t.Errorf("expected %v, received %v", orchestrator.ProcessUnstarted, ps.Status)
+			}
+		})
+	}
+}
+
+func TestNewGRPCProcess_Config(t *testing.T) {
+	_, descriptorSet := grpcServer(t, func(context.Context, *dynamicpb.Message) (string, error) {
+		return "ok", nil
+	})
+
+	for _, test := range []struct {
+		name      string
+		ec        map[string]string
+		expectErr error
+	}{
+		{"missing target", map[string]string{GRPCTargetKey: ""}, MissingGRPCConfigErr{}},
+		{"missing method", map[string]string{GRPCMethodKey: ""}, MissingGRPCConfigErr{}},
+		{"malformed method", map[string]string{GRPCMethodKey: "Sync"}, InvalidConfigErr{}},
+		{"malformed fields", map[string]string{GRPCFieldsKey: `["id"]`}, InvalidConfigErr{}},
+		{"invalid tls", map[string]string{GRPCTLSKey: "sometimes"}, InvalidConfigErr{}},
+		{"invalid attempts", map[string]string{GRPCMaxAttemptsKey: "many"}, InvalidConfigErr{}},
+		{"unknown retryable code", map[string]string{GRPCMaxAttemptsKey: "2", GRPCRetryableCodesKey: "UNAVAILABLE,FLAKY"}, InvalidConfigErr{}},
+		{"missing descriptor set", map[string]string{GRPCDescriptorSetKey: filepath.Join(t.TempDir(), "missing.pb")}, InvalidConfigErr{}},
+		{"unknown method in descriptor set", map[string]string{GRPCDescriptorSetKey: descriptorSet, GRPCMethodKey: "tests.v1.Syncer/Missing"}, InvalidConfigErr{}},
+		{"streaming method", map[string]string{GRPCDescriptorSetKey: descriptorSet, GRPCMethodKey: "tests.v1.Syncer/Watch"}, InvalidConfigErr{}},
+		{"unknown field", map[string]string{GRPCDescriptorSetKey: descriptorSet, GRPCFieldsKey: `{"order": "{{.ID}}"}`}, InvalidConfigErr{}},
+		{"unconvertible field", map[string]string{GRPCDescriptorSetKey: descriptorSet, GRPCFieldsKey: `{"attempt": "first"}`}, InvalidConfigErr{}},
+		{"scalar set from object", map[string]string{GRPCDescriptorSetKey: descriptorSet, GRPCFieldsKey: `{"id": {"value": "1"}}`}, InvalidConfigErr{}},
+		{"valid", map[string]string{GRPCDescriptorSetKey: descriptorSet, GRPCFieldsKey: `{"id": "{{.ID}}", "source": {"trigger": "x"}}`}, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ec := map[string]string{
+				GRPCTargetKey: "127.0.0.1:1",
+				GRPCMethodKey: "tests.v1.Syncer/Sync",
+			}
+
+			for k, v := range test.ec {
+				ec[k] = v
+			}
+
+			_, err := NewGRPCProcess(orchestrator.ProcessConfig{Name: "tests", ExecutionContext: ec})
+			if fmt.Sprintf("%T", err) != fmt.Sprintf("%T", test.expectErr) {
+				t.Errorf("expected error of type %T, received %#v", test.expectErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package webhooks
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// DefaultQueueLimit is the number of deliveries which may be waiting on
+// the orchestrator before an Input reports itself as saturated
+const DefaultQueueLimit = 64
+
+// Handle loop states, as reported by health checks
+const (
+	stateUnstarted int32 = iota
+	stateRunning
+	stateStopped
+)
+
+var stateNames = map[int32]string{
+	stateUnstarted: "unstarted",
+	stateRunning:   "running",
+	stateStopped:   "stopped",
+}
+
+// HealthChecker is implemented by anything which can report on its own
+// health, such as an Input or StreamInput.
+//
+// Its signature deliberately uses only builtin types, so that inputs
+// elsewhere (such as the locking-postgres input) can implement it without
+// depending on this package
+type HealthChecker interface {
+	ID() string
+
+	// Health returns whether the checker is alive (which is to say it
+	// hasn't died and ought to be restarted), whether it is ready to
+	// do work, and any detail worth reporting
+	Health() (live, ready bool, detail map[string]any)
+}
+
+// HealthCheck is the outcome of a single HealthChecker
+type HealthCheck struct {
+	ID     string         `json:"id"`
+	Live   bool           `json:"live"`
+	Ready  bool           `json:"ready"`
+	Detail map[string]any `json:"detail,omitempty"`
+}
+
+// HealthReport is the body returned by LivenessHandler and ReadinessHandler
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// WithQueueLimit sets the number of deliveries which may be waiting on
+// the orchestrator before an Input reports itself as saturated, and thus
+// not ready. The default is DefaultQueueLimit
+func WithQueueLimit(n int) InputOption {
+	return func(o *inputOptions) {
+		o.queueLimit = n
+	}
+}
+
+// inputHealth tracks the state of an Input's Handle loop, and the number of
+// deliveries waiting to be passed to the orchestrator
+type inputHealth struct {
+	state   atomic.Int32
+	pending atomic.Int64
+}
+
+// Health implements the HealthChecker interface.
+//
+// An Input is live until its Handle function returns, and ready while
+// Handle is running and fewer deliveries than the queue limit are waiting
+// on the orchestrator
+func (w *Input) Health() (live, ready bool, detail map[string]any) {
+	state := w.health.state.Load()
+	pending := w.health.pending.Load()
+	saturated := pending >= int64(w.opts.queueLimit)
+
+	return state != stateStopped, state == stateRunning && !saturated, map[string]any{
+		"state":       stateNames[state],
+		"queue_depth": pending,
+		"queue_limit": w.opts.queueLimit,
+		"saturated":   saturated,
+	}
+}
+
+// Health implements the HealthChecker interface.
+//
+// A StreamInput is live until its Handle function returns, and ready while
+// connected to its feed
+func (s *StreamInput) Health() (live, ready bool, detail map[string]any) {
+	state := s.health.state.Load()
+	connected := s.connected.Load()
+
+	return state != stateStopped, state == stateRunning && connected, map[string]any{
+		"state":     stateNames[state],
+		"connected": connected,
+	}
+}
+
+// LivenessHandler returns an http.Handler which responds 200 OK when every
+// checker is live, and 503 Service Unavailable otherwise, along with a
+// HealthReport.
+//
+// Where no checkers are specified, every Input created via NewInput is
+// checked
+func LivenessHandler(checks ...HealthChecker) http.Handler {
+	return healthHandler(checks, func(c HealthCheck) bool { return c.Live })
+}
+
+// ReadinessHandler returns an http.Handler which responds 200 OK when every
+// checker is ready, and 503 Service Unavailable otherwise, along with a
+// HealthReport.
+//
+// Where no checkers are specified, every Input created via NewInput is
+// checked
+func ReadinessHandler(checks ...HealthChecker) http.Handler {
+	return healthHandler(checks, func(c HealthCheck) bool { return c.Ready })
+}
+
+func healthHandler(checks []HealthChecker, ok func(HealthCheck) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checks := checks
+		if len(checks) == 0 {
+			for _, in := range registeredInputs() {
+				checks = append(checks, in)
+			}
+		}
+
+		report := HealthReport{
+			Status: "ok",
+			Checks: make([]HealthCheck, len(checks)),
+		}
+
+		status := http.StatusOK
+		for i, c := range checks {
+			report.Checks[i].ID = c.ID()
+			report.Checks[i].Live, report.Checks[i].Ready, report.Checks[i].Detail = c.Health()
+
+			if !ok(report.Checks[i]) {
+				report.Status = "unavailable"
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		writeJSON(w, status, report)
+	})
+}
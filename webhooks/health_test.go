@@ -0,0 +1,150 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// staticHealth is a HealthChecker with a fixed outcome
+type staticHealth struct {
+	id          string
+	live, ready bool
+}
+
+func (s staticHealth) ID() string { return s.id }
+
+func (s staticHealth) Health() (bool, bool, map[string]any) {
+	return s.live, s.ready, map[string]any{"leader": true}
+}
+
+func TestInput_Health(t *testing.T) {
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "health-webhook-input",
+		ConnectionString: "/webhooks/health-webhook-input/events",
+	}, WithQueueLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	live, ready, detail := wh.Health()
+	if !live || ready {
+		t.Errorf("unstarted input should be live but not ready, received live: %v, ready: %v", live, ready)
+	}
+
+	wh.health.state.Store(stateRunning)
+
+	live, ready, _ = wh.Health()
+	if !live || !ready {
+		t.Errorf("running input should be live and ready, received live: %v, ready: %v", live, ready)
+	}
+
+	wh.health.pending.Add(1)
+
+	live, ready, detail = wh.Health()
+	if !live || ready || detail["saturated"] != true {
+		t.Errorf("saturated input should be live but not ready, received live: %v, ready: %v, detail: %#v", live, ready, detail)
+	}
+
+	wh.health.state.Store(stateStopped)
+
+	live, _, _ = wh.Health()
+	if live {
+		t.Errorf("stopped input should not be live")
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		handler      func(...HealthChecker) http.Handler
+		checks       []HealthChecker
+		expectStatus int
+	}{
+		{"all live", LivenessHandler, []HealthChecker{staticHealth{"a", true, false}, staticHealth{"b", true, true}}, http.StatusOK},
+		{"one dead", LivenessHandler, []HealthChecker{staticHealth{"a", true, true}, staticHealth{"b", false, false}}, http.StatusServiceUnavailable},
+		{"all ready", ReadinessHandler, []HealthChecker{staticHealth{"a", true, true}, staticHealth{"b", true, true}}, http.StatusOK},
+		{"one not ready", ReadinessHandler, []HealthChecker{staticHealth{"a", true, true}, staticHealth{"b", true, false}}, http.StatusServiceUnavailable},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			test.handler(test.checks...).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			if test.expectStatus != recorder.Code {
+				t.Errorf("expected %d, received %d", test.expectStatus, recorder.Code)
+			}
+
+			report := new(HealthReport)
+			err := json.NewDecoder(recorder.Body).Decode(report)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(report.Checks) != len(test.checks) {
+				t.Errorf("expected %d checks, received %d", len(test.checks), len(report.Checks))
+			}
+
+			if report.Checks[0].Detail["leader"] != true {
+				t.Errorf("expected detail to be reported, received %#v", report.Checks[0].Detail)
+			}
+		})
+	}
+}
+
+func TestHealthHandlers_DefaultsToRegisteredInputs(t *testing.T) {
+	_, err := NewInput(orchestrator.InputConfig{
+		Name:             "registered-health-input",
+		ConnectionString: "/webhooks/registered-health-input/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := ReadinessHandler()
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		h.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		report := new(HealthReport)
+		err = json.NewDecoder(recorder.Body).Decode(report)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(report.Checks) != len(registeredInputs()) {
+			t.Errorf("expected every registered input to be checked, received %d checks", len(report.Checks))
+		}
+
+		// registered-health-input has never been started
+		if recorder.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected %d, received %d", http.StatusServiceUnavailable, recorder.Code)
+		}
+	}
+}
+
+func TestStreamInput_Health(t *testing.T) {
+	s, err := NewStreamInput(orchestrator.InputConfig{
+		Name:             "health-stream-input",
+		ConnectionString: "https://example.com/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.health.state.Store(stateRunning)
+
+	_, ready, _ := s.Health()
+	if ready {
+		t.Errorf("disconnected stream should not be ready")
+	}
+
+	s.connected.Store(true)
+
+	_, ready, _ = s.Health()
+	if !ready {
+		t.Errorf("connected stream should be ready")
+	}
+}
@@ -0,0 +1,215 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader is the header used to propagate correlation IDs, both
+// from callers of an Input, and onward to the receivers of a Process
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDTTL is how long the request ID of an Event emitted by an Input
+// is remembered for, and maxRequestIDs how many are remembered at once
+const (
+	requestIDTTL  = 10 * time.Minute
+	maxRequestIDs = 100_000
+)
+
+// requestIDKey holds the request ID in a context
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID id.
+//
+// Processes in this package send the Events they're run with under the
+// request ID carried by their context, where there is one, such as when
+// redriving a dead letter. The context is also handed to PayloadFuncs
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by ctx, if any, as
+// set by ContextWithRequestID
+func RequestIDFromContext(ctx context.Context) (id string, ok bool) {
+	id, ok = ctx.Value(requestIDKey{}).(string)
+
+	return
+}
+
+// requestIDs remembers the request IDs of the Events emitted by Inputs in
+// this package, by Event.
+//
+// The orchestrator runs Processes with the Event alone, and a fresh
+// context, and orchestrator.Event has no room for metadata of its own, so
+// this is how a request ID travels from an Input to the Processes its
+// Events are routed to without changing the Events themselves. Entries are
+// dropped oldest first, once they expire or the table is full
+var requestIDs = struct {
+	sync.Mutex
+	m     map[orchestrator.Event]rememberedRequestID
+	order []rememberedEvent
+}{m: make(map[orchestrator.Event]rememberedRequestID)}
+
+type rememberedRequestID struct {
+	id string
+	at time.Time
+}
+
+type rememberedEvent struct {
+	e  orchestrator.Event
+	at time.Time
+}
+
+// rememberRequestID records id as the request ID of e, for Processes to
+// pick up via eventRequestID. Identical Events emitted while e is still
+// remembered share the most recent request ID
+func rememberRequestID(e orchestrator.Event, id string) {
+	requestIDs.Lock()
+	defer requestIDs.Unlock()
+
+	now := time.Now()
+
+	// Events are remembered in the order they were emitted, so those
+	// to expire are at the front
+	for len(requestIDs.order) > 0 {
+		oldest := requestIDs.order[0]
+		if len(requestIDs.order) < maxRequestIDs && now.Sub(oldest.at) < requestIDTTL {
+			break
+		}
+
+		// Unless it has since been emitted again
+		if requestIDs.m[oldest.e].at.Equal(oldest.at) {
+			delete(requestIDs.m, oldest.e)
+		}
+
+		requestIDs.order = requestIDs.order[1:]
+	}
+
+	requestIDs.m[e] = rememberedRequestID{id, now}
+	requestIDs.order = append(requestIDs.order, rememberedEvent{e, now})
+}
+
+// eventRequestID returns the request ID to send e under: that carried by
+// ctx, else that remembered for e, else a new one
+func eventRequestID(ctx context.Context, e orchestrator.Event) string {
+	if id, ok := RequestIDFromContext(ctx); ok {
+		return id
+	}
+
+	requestIDs.Lock()
+	r, ok := requestIDs.m[e]
+	requestIDs.Unlock()
+
+	if ok && time.Since(r.at) < requestIDTTL {
+		return r.id
+	}
+
+	return uuid.NewString()
+}
+
+// requestID returns the request ID of an inbound request, generating one
+// where the caller didn't provide one
+func requestID(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+	}
+
+	return id
+}
+
+// statusWriter records the status code written to a ResponseWriter
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// accessLog wraps a handler, ensuring each request has a request ID (which
+// is echoed back to the caller) and emitting an access log entry once the
+// request has been handled
+func accessLog(logger *slog.Logger, input string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := requestID(r)
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next(sw, r)
+
+		logger.LogAttrs(r.Context(), levelForStatus(sw.status), "webhook received",
+			slog.String("request_id", id),
+			slog.String("input", input),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.Int("status", sw.status),
+			slog.Duration("latency", time.Since(start)),
+		)
+	}
+}
+
+func levelForStatus(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+
+	case status >= 400:
+		return slog.LevelWarn
+	}
+
+	return slog.LevelInfo
+}
+
+// redacted replaces secrets in anything a Process logs
+const redacted = "[REDACTED]"
+
+// redactURL masks the password and query parameter values of a URL, either
+// of which may hold credentials, so that it can be logged
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+
+	if u.RawQuery != "" {
+		q := u.Query()
+
+		params := make([]string, 0, len(q))
+		for k := range q {
+			params = append(params, url.QueryEscape(k)+"="+redacted)
+		}
+
+		slices.Sort(params)
+		u.RawQuery = strings.Join(params, "&")
+	}
+
+	return u.Redacted()
+}
+
+// redactURLErr masks the URL held by err, where err is a *url.Error, as
+// returned by http.Client
+func redactURLErr(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = redactURL(ue.URL)
+	}
+
+	return err
+}
@@ -0,0 +1,233 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestAccessLog(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		requestID    string
+		status       int
+		expectLevel  string
+		expectCustom bool
+	}{
+		{"generates a request id", "", http.StatusAccepted, "INFO", false},
+		{"propagates a request id", "some-request-id", http.StatusAccepted, "INFO", true},
+		{"logs bad requests as warnings", "", http.StatusBadRequest, "WARN", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			logs := new(bytes.Buffer)
+			logger := slog.New(slog.NewJSONHandler(logs, nil))
+
+			var seen string
+			h := accessLog(logger, "test-webhook-input", func(w http.ResponseWriter, r *http.Request) {
+				seen = r.Header.Get(RequestIDHeader)
+				w.WriteHeader(test.status)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/test-webhook-input/events", nil)
+			if test.requestID != "" {
+				req.Header.Set(RequestIDHeader, test.requestID)
+			}
+
+			recorder := httptest.NewRecorder()
+			h(recorder, req)
+
+			if seen == "" {
+				t.Fatal("expected handler to receive a request id")
+			}
+
+			if test.expectCustom && seen != test.requestID {
+				t.Errorf("expected request id %q, received %q", test.requestID, seen)
+			}
+
+			if recorder.Header().Get(RequestIDHeader) != seen {
+				t.Errorf("expected response to echo request id %q, received %q", seen, recorder.Header().Get(RequestIDHeader))
+			}
+
+			entry := make(map[string]any)
+			err := json.Unmarshal(logs.Bytes(), &entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for k, v := range map[string]any{
+				"level":      test.expectLevel,
+				"request_id": seen,
+				"input":      "test-webhook-input",
+				"status":     float64(test.status),
+			} {
+				if entry[k] != v {
+					t.Errorf("expected %s to be %v, received %v", k, v, entry[k])
+				}
+			}
+
+			if _, ok := entry["latency"]; !ok {
+				t.Errorf("expected latency to be logged")
+			}
+		})
+	}
+}
+
+func TestRequestID_Propagation(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(RequestIDHeader)
+	}))
+	defer srv.Close()
+
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "test-webhook-input",
+		ConnectionString: "/webhooks/test-webhook-input/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logs := new(bytes.Buffer)
+	wp, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "test-webhook-process",
+		ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+	}, WithProcessLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wh.c = make(chan orchestrator.Event, 1)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/test-webhook-input/events", bytes.NewBufferString(`{"location":"propagation","operation":"create","id":"1"}`))
+	req.Header.Set(RequestIDHeader, "propagated-request-id")
+	wh.handler(httptest.NewRecorder(), req)
+
+	_, err = wp.Run(context.Background(), <-wh.c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received != "propagated-request-id" {
+		t.Errorf("expected %q, received %q", "propagated-request-id", received)
+	}
+
+	if !bytes.Contains(logs.Bytes(), []byte(`"request_id":"propagated-request-id"`)) {
+		t.Errorf("expected delivery to be logged with request id, received %s", logs.String())
+	}
+
+	// Events which didn't arrive via an Input get a fresh request id
+	_, err = wp.Run(context.Background(), orchestrator.Event{Location: "elsewhere"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received == "" || received == "propagated-request-id" {
+		t.Errorf("expected a newly generated request id, received %q", received)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	e := orchestrator.Event{Location: "orders", ID: "request-id-test", Trigger: "test-input"}
+	ctx := context.Background()
+
+	generated := eventRequestID(ctx, e)
+	if generated == "" || eventRequestID(ctx, e) == generated {
+		t.Errorf("expected a new request id for each unremembered event, received %q", generated)
+	}
+
+	rememberRequestID(e, "first")
+	rememberRequestID(e, "second")
+
+	// Read by every Process the Event is routed to
+	for i := 0; i < 2; i++ {
+		if id := eventRequestID(ctx, e); id != "second" {
+			t.Errorf("expected %q, received %q", "second", id)
+		}
+	}
+
+	if id := eventRequestID(ContextWithRequestID(ctx, "from-context"), e); id != "from-context" {
+		t.Errorf("expected the context's request id to win, received %q", id)
+	}
+
+	t.Run("expiry", func(t *testing.T) {
+		// As though requestIDTTL had passed
+		requestIDs.Lock()
+		for k, r := range requestIDs.m {
+			r.at = r.at.Add(-requestIDTTL)
+			requestIDs.m[k] = r
+		}
+
+		for i := range requestIDs.order {
+			requestIDs.order[i].at = requestIDs.order[i].at.Add(-requestIDTTL)
+		}
+		requestIDs.Unlock()
+
+		if id := eventRequestID(ctx, e); id == "second" {
+			t.Error("expected expired request ids to be forgotten")
+		}
+
+		rememberRequestID(orchestrator.Event{ID: "request-id-test-other"}, "other")
+
+		requestIDs.Lock()
+		_, ok := requestIDs.m[e]
+		requestIDs.Unlock()
+
+		if ok {
+			t.Error("expected expired request ids to be dropped")
+		}
+	})
+}
+
+func TestProcess_Run_TargetURLRedacted(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	for _, test := range []struct {
+		name string
+		url  string
+	}{
+		{"bad status", srv.URL},
+		{"connection refused", down.URL},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			u := strings.Replace(test.url, "http://", "http://user:url-pa55@", 1) + "/hook?token=url-t0ken"
+			logs := new(bytes.Buffer)
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: map[string]string{TargetURLKey: u},
+			}, WithProcessLogger(slog.New(slog.NewJSONHandler(logs, nil))))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, err := p.Run(context.Background(), orchestrator.Event{})
+			if err == nil {
+				t.Fatal("expected error")
+			}
+
+			out := strings.Join(append(ps.Logs, err.Error(), logs.String()), "\n")
+			for _, secret := range []string{"url-pa55", "url-t0ken"} {
+				if strings.Contains(out, secret) {
+					t.Errorf("secret %q leaked into logs: %s", secret, out)
+				}
+			}
+
+			if !strings.Contains(logs.String(), "/hook?token=") {
+				t.Errorf("expected redacted url to be logged, received %s", logs.String())
+			}
+		})
+	}
+}
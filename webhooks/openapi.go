@@ -0,0 +1,214 @@
+package webhooks
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OpenAPIVersion is the version of the OpenAPI specification documents
+// generated by this package conform to
+const OpenAPIVersion = "3.1.0"
+
+// Schema is a JSON Schema, as used by OpenAPI 3.1
+type Schema map[string]any
+
+// EventSchema is the JSON Schema of an orchestrator.Event, which is what
+// an Input expects by default
+var EventSchema = Schema{
+	"type": "object",
+	"properties": map[string]Schema{
+		"location": {
+			"type":        "string",
+			"description": "The table, topic, or other location the event relates to",
+		},
+		"operation": {
+			"type": "string",
+			"enum": []string{"create", "insert", "read", "update", "delete", "remove"},
+		},
+		"id": {
+			"type":        "string",
+			"description": "The ID of the record the event relates to",
+		},
+		"trigger": {
+			"type":        "string",
+			"description": "Ignored; set by the receiving input",
+		},
+	},
+}
+
+// OpenAPI is an OpenAPI 3.1 document, containing the subset of the
+// specification needed to describe webhook inputs
+type OpenAPI struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info contains metadata about the API an OpenAPI document describes
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// PathItem describes the operations available on a single path
+type PathItem struct {
+	Post *OpenAPIOperation `json:"post,omitempty"`
+}
+
+// OpenAPIOperation describes a single API operation on a path
+type OpenAPIOperation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	RequestBody RequestBody           `json:"requestBody"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// RequestBody describes the payloads an OpenAPIOperation accepts, keyed by
+// media type
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// MediaType describes the schema of a payload of a specific media type
+type MediaType struct {
+	Schema Schema `json:"schema"`
+}
+
+// Response describes a single response from an OpenAPIOperation
+type Response struct {
+	Description string `json:"description"`
+}
+
+// Components holds reusable objects referenced elsewhere in a document
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how an OpenAPIOperation is authenticated
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+}
+
+// SecuritySchemer may be implemented by an Authenticator to describe
+// itself in generated OpenAPI documents; Authenticators which don't are
+// omitted from documents entirely
+type SecuritySchemer interface {
+	// SecurityScheme returns a name, unique to the scheme, and the
+	// SecurityScheme itself
+	SecurityScheme() (string, SecurityScheme)
+}
+
+// GenerateOpenAPI returns an OpenAPI document, with the info object info,
+// describing the paths exposed by the specified inputs or, where none are
+// specified, by every Input created via NewInput and not yet closed
+func GenerateOpenAPI(info Info, in ...*Input) (doc OpenAPI) {
+	if len(in) == 0 {
+		in = registeredInputs()
+	}
+
+	doc = OpenAPI{
+		OpenAPI: OpenAPIVersion,
+		Info:    info,
+		Paths:   make(map[string]PathItem),
+		Components: Components{
+			Schemas: map[string]Schema{
+				"Event": EventSchema,
+			},
+		},
+	}
+
+	for _, i := range in {
+		op := &OpenAPIOperation{
+			OperationID: i.ID(),
+			Summary:     "Send an event to input " + i.ID(),
+			RequestBody: RequestBody{
+				Required: true,
+				Content:  make(map[string]MediaType),
+			},
+			Responses: map[string]Response{
+				"202": {Description: "The event was accepted for processing"},
+				"400": {Description: "The payload could not be turned into an event"},
+				"503": {Description: "The input is not running, and so can't accept events"},
+			},
+		}
+
+		contentType, schema := requestBody(i)
+		op.RequestBody.Content[contentType] = MediaType{Schema: schema}
+
+		if i.opts.schema != nil {
+			doc.Components.Schemas[schemaName(i.ID())] = i.opts.schema
+		}
+
+		if ss, ok := i.opts.auth.(SecuritySchemer); ok {
+			name, scheme := ss.SecurityScheme()
+
+			if doc.Components.SecuritySchemes == nil {
+				doc.Components.SecuritySchemes = make(map[string]SecurityScheme)
+			}
+
+			doc.Components.SecuritySchemes[name] = scheme
+			op.Security = []map[string][]string{{name: {}}}
+			op.Responses["401"] = Response{Description: "The caller failed to authenticate"}
+		}
+
+		doc.Paths[i.ic.ConnectionString] = PathItem{Post: op}
+	}
+
+	return
+}
+
+// OpenAPIHandler returns an http.Handler which serves the document
+// returned by GenerateOpenAPI(info, in...) as JSON.
+//
+// The document is generated on each request, so that Inputs created after
+// the handler are included
+func OpenAPIHandler(info Info, in ...*Input) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, GenerateOpenAPI(info, in...))
+	})
+}
+
+// ServeOpenAPI registers an OpenAPIHandler, describing every Input, against
+// the default server provided by the net/http package at the specified path
+func ServeOpenAPI(path string, info Info) {
+	http.Handle(path, OpenAPIHandler(info))
+}
+
+// requestBody returns the media type and schema of the payloads accepted by
+// in: those of its configured Schema, where it has one, otherwise events
+// as JSON for the JSONEventMapper, or anything at all for a custom
+// EventMapper, which may accept any format
+func requestBody(in *Input) (contentType string, schema Schema) {
+	switch {
+	case in.opts.schema != nil:
+		contentType = "application/json"
+		if ct, ok := in.opts.schema["contentMediaType"].(string); ok && ct != "" {
+			contentType = ct
+		}
+
+		return contentType, Schema{"$ref": "#/components/schemas/" + schemaName(in.ID())}
+
+	case in.opts.mapped:
+		return "*/*", Schema{}
+
+	default:
+		return "application/json", Schema{"$ref": "#/components/schemas/Event"}
+	}
+}
+
+// schemaName turns an Input ID into a valid component name
+func schemaName(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+
+		return '_'
+	}, id) + "Payload"
+}
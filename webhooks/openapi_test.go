@@ -0,0 +1,201 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestGenerateOpenAPI(t *testing.T) {
+	plain, err := NewInput(orchestrator.InputConfig{
+		Name:             "openapi-plain-input",
+		ConnectionString: "/webhooks/openapi-plain-input/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	custom, err := NewInput(orchestrator.InputConfig{
+		Name:             "openapi-custom-input",
+		ConnectionString: "/webhooks/openapi-custom-input/events",
+	},
+		WithSchema(Schema{"type": "object", "required": []string{"uuid"}}),
+		WithAuthenticator(BearerAuthenticator{Token: "s3cr3t"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := Info{Title: "partners", Version: "2.0.0"}
+
+	doc := GenerateOpenAPI(info)
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("expected openapi 3.1.0, received %q", doc.OpenAPI)
+	}
+
+	if doc.Info != info {
+		t.Errorf("expected info %#v, received %#v", info, doc.Info)
+	}
+
+	for _, in := range []*Input{plain, custom} {
+		if _, ok := doc.Paths[in.ic.ConnectionString]; !ok {
+			t.Errorf("expected registered input %q to be documented", in.ID())
+		}
+	}
+
+	op := doc.Paths[plain.ic.ConnectionString].Post
+	if op.RequestBody.Content["application/json"].Schema["$ref"] != "#/components/schemas/Event" {
+		t.Errorf("expected default input to accept events, received %#v", op.RequestBody.Content)
+	}
+
+	if len(op.Security) != 0 {
+		t.Errorf("expected default input to be unauthenticated, received %#v", op.Security)
+	}
+
+	op = doc.Paths[custom.ic.ConnectionString].Post
+	ref := op.RequestBody.Content["application/json"].Schema["$ref"]
+	if ref != "#/components/schemas/openapi-custom-inputPayload" {
+		t.Errorf("expected custom schema, received %v", ref)
+	}
+
+	if _, ok := doc.Components.Schemas["openapi-custom-inputPayload"]; !ok {
+		t.Errorf("expected custom schema to be included in components")
+	}
+
+	if len(op.Security) != 1 || doc.Components.SecuritySchemes["bearerAuth"].Scheme != "bearer" {
+		t.Errorf("expected bearer auth, received %#v / %#v", op.Security, doc.Components.SecuritySchemes)
+	}
+
+	for _, status := range []string{"202", "400", "401", "503"} {
+		if _, ok := op.Responses[status]; !ok {
+			t.Errorf("expected a %s response to be documented", status)
+		}
+	}
+
+	// Specifying inputs limits the document to just those
+	doc = GenerateOpenAPI(info, plain)
+	if len(doc.Paths) != 1 {
+		t.Errorf("expected 1 path, received %d", len(doc.Paths))
+	}
+
+	// Closed inputs are no longer documented
+	custom.Close()
+
+	doc = GenerateOpenAPI(info)
+	if _, ok := doc.Paths[custom.ic.ConnectionString]; ok {
+		t.Errorf("expected closed input %q not to be documented", custom.ID())
+	}
+
+	if _, ok := doc.Paths[plain.ic.ConnectionString]; !ok {
+		t.Errorf("expected input %q to still be documented", plain.ID())
+	}
+}
+
+func TestGenerateOpenAPI_ContentType(t *testing.T) {
+	mapper := func([]byte) (orchestrator.Event, error) { return orchestrator.Event{}, nil }
+
+	for _, test := range []struct {
+		name              string
+		opts              []InputOption
+		expectContentType string
+		expectRef         any
+	}{
+		{"default", nil, "application/json", "#/components/schemas/Event"},
+		{"custom schema", []InputOption{WithSchema(Schema{"type": "object"})}, "application/json", "#/components/schemas/openapi-content-type-inputPayload"},
+		{"custom media type", []InputOption{WithEventMapper(mapper), WithSchema(Schema{"type": "string", "contentMediaType": "application/xml"})}, "application/xml", "#/components/schemas/openapi-content-type-inputPayload"},
+		{"custom mapper", []InputOption{WithEventMapper(mapper)}, "*/*", nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			in, err := NewInput(orchestrator.InputConfig{
+				Name:             "openapi-content-type-input",
+				ConnectionString: "/webhooks/openapi-content-type-input/events",
+			}, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer in.Close()
+
+			content := GenerateOpenAPI(Info{}, in).Paths[in.ic.ConnectionString].Post.RequestBody.Content
+			if len(content) != 1 {
+				t.Fatalf("expected a single media type, received %#v", content)
+			}
+
+			mt, ok := content[test.expectContentType]
+			if !ok {
+				t.Fatalf("expected %s, received %#v", test.expectContentType, content)
+			}
+
+			if mt.Schema["$ref"] != test.expectRef {
+				t.Errorf("expected schema %v, received %v", test.expectRef, mt.Schema["$ref"])
+			}
+		})
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	in, err := NewInput(orchestrator.InputConfig{
+		Name:             "openapi-handler-input",
+		ConnectionString: "/webhooks/openapi-handler-input/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	OpenAPIHandler(Info{Title: "tests", Version: "1.0.0"}, in).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	doc := make(map[string]any)
+	err = json.NewDecoder(recorder.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("unexpected document %#v", doc)
+	}
+}
+
+func TestInput_handlerChain(t *testing.T) {
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "chained-webhook-input",
+		ConnectionString: "/webhooks/chained-webhook-input/events",
+	},
+		WithAuthenticator(BasicAuthenticator{"user", "pass"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wh.c = make(chan orchestrator.Event, 10)
+	h := wh.handlerChain()
+
+	for _, test := range []struct {
+		name         string
+		contentType  string
+		user         string
+		expectStatus int
+	}{
+		{"valid request", "application/json; charset=utf-8", "user", http.StatusAccepted},
+		{"unauthenticated", "application/json", "", http.StatusUnauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/chained-webhook-input/events", bytes.NewBufferString(`{"location":"a-table","operation":"create","id":"1"}`))
+			req.Header.Set("Content-Type", test.contentType)
+			if test.user != "" {
+				req.SetBasicAuth(test.user, "pass")
+			}
+
+			recorder := httptest.NewRecorder()
+			h(recorder, req)
+
+			if test.expectStatus != recorder.Code {
+				t.Errorf("expected %d, received %d", test.expectStatus, recorder.Code)
+			}
+		})
+	}
+}
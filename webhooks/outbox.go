@@ -0,0 +1,446 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/google/uuid"
+)
+
+// Defaults used by an OutboxWorker where no option says otherwise
+const (
+	DefaultOutboxWorkers      = 4
+	DefaultOutboxPollInterval = 250 * time.Millisecond
+	DefaultOutboxMaxAttempts  = 10
+	DefaultOutboxBackoff      = time.Second
+	DefaultOutboxMaxBackoff   = 5 * time.Minute
+)
+
+// outboxLaneBatch is how many entries of each lane an OutboxWorker fetches
+// per poll
+const outboxLaneBatch = 64
+
+// OutboxState is the state of an OutboxEntry
+type OutboxState string
+
+const (
+	// OutboxPending entries are waiting to be delivered, or retried
+	OutboxPending OutboxState = "pending"
+
+	// OutboxDelivered entries have been delivered successfully
+	OutboxDelivered OutboxState = "delivered"
+
+	// OutboxFailed entries failed terminally, or ran out of attempts
+	OutboxFailed OutboxState = "failed"
+)
+
+// UnknownOutboxEntryErr is returned when an Outbox is asked for an entry
+// it does not hold
+type UnknownOutboxEntryErr struct{ id string }
+
+// Error returns the error text for this error
+func (e UnknownOutboxEntryErr) Error() string {
+	return fmt.Sprintf("unknown outbox entry %q", e.id)
+}
+
+// OutboxEntry is a single delivery queued by a Process configured with
+// WithOutbox, along with its outcome
+type OutboxEntry struct {
+	ID string `json:"id"`
+
+	// Seq orders entries, and is set by the Outbox on Enqueue
+	Seq uint64 `json:"seq"`
+
+	RequestID  string             `json:"request_id"`
+	Process    string             `json:"process"`
+	Target     string             `json:"target"`
+	Event      orchestrator.Event `json:"event"`
+	EnqueuedAt time.Time          `json:"enqueued_at"`
+
+	State    OutboxState `json:"state"`
+	Attempts int         `json:"attempts"`
+
+	// NextAttempt is the earliest time a pending entry may be retried
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+
+	// CompletedAt is when an entry was delivered, or failed for good
+	CompletedAt time.Time `json:"completed_at,omitempty"`
+
+	// Status is the HTTP status of the last attempt, or zero where no
+	// response was received
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// OutboxQuery filters the entries returned by Outbox.List; empty fields
+// match everything
+type OutboxQuery struct {
+	Process string
+	Target  string
+	State   OutboxState
+
+	// Limit caps the number of entries returned; zero is unlimited
+	Limit int
+}
+
+func (q OutboxQuery) match(e OutboxEntry) bool {
+	return (q.Process == "" || q.Process == e.Process) &&
+		(q.Target == "" || q.Target == e.Target) &&
+		(q.State == "" || q.State == e.State)
+}
+
+// Outbox durably queues the deliveries of Processes configured with
+// WithOutbox, for an OutboxWorker to make, and keeps their outcomes
+type Outbox interface {
+	// Enqueue stores a new entry, returning it with Seq set
+	Enqueue(context.Context, OutboxEntry) (OutboxEntry, error)
+
+	// Pending returns up to perLane of the oldest pending entries for
+	// each Process and target, oldest first, so that a target with a
+	// backlog never hides the entries of another
+	Pending(ctx context.Context, perLane int) ([]OutboxEntry, error)
+
+	// Update replaces the stored entry with the same ID
+	Update(context.Context, OutboxEntry) error
+
+	// Get returns an UnknownOutboxEntryErr for IDs which aren't held
+	Get(ctx context.Context, id string) (OutboxEntry, error)
+
+	// List returns the entries matching q, newest first
+	List(ctx context.Context, q OutboxQuery) ([]OutboxEntry, error)
+}
+
+// WithOutbox makes a Process asynchronous: rather than making its
+// deliveries, Run durably enqueues them into Outbox o and returns
+// immediately, leaving an OutboxWorker to deliver them in the background.
+//
+// Each target is queued, and delivered, independently; FanOutPolicyKey has
+// no effect on an asynchronous Process
+func WithOutbox(o Outbox) ProcessOption {
+	return func(p *Process) {
+		p.outbox = o
+	}
+}
+
+// enqueue adds a delivery to each target of a Process to its outbox
+func (w Process) enqueue(ctx context.Context, ps orchestrator.ProcessStatus, e orchestrator.Event, id string) (orchestrator.ProcessStatus, error) {
+	now := time.Now()
+
+	for _, t := range w.targets {
+		entry, err := w.outbox.Enqueue(ctx, OutboxEntry{
+			ID:          uuid.NewString(),
+			RequestID:   id,
+			Process:     w.ID(),
+			Target:      t.url,
+			Event:       e,
+			EnqueuedAt:  now,
+			State:       OutboxPending,
+			NextAttempt: now,
+		})
+		if err != nil {
+			ps.Status = orchestrator.ProcessFail
+			ps.Logs = append(ps.Logs, fmt.Sprintf("%s: error queueing delivery: %v", redactURL(t.url), err))
+
+			return ps, err
+		}
+
+		ps.Logs = append(ps.Logs, fmt.Sprintf("%s: queued as %s", redactURL(t.url), entry.ID))
+	}
+
+	ps.Status = orchestrator.ProcessSuccess
+
+	return ps, nil
+}
+
+// OutboxWorkerOption configures optional behaviour of an OutboxWorker
+type OutboxWorkerOption func(*OutboxWorker)
+
+// WithOutboxWorkers sets the most deliveries an OutboxWorker makes at once,
+// in place of DefaultOutboxWorkers
+func WithOutboxWorkers(n int) OutboxWorkerOption {
+	return func(w *OutboxWorker) {
+		w.workers = n
+	}
+}
+
+// WithOutboxPollInterval sets how often an OutboxWorker checks for new
+// entries, in place of DefaultOutboxPollInterval
+func WithOutboxPollInterval(d time.Duration) OutboxWorkerOption {
+	return func(w *OutboxWorker) {
+		w.interval = d
+	}
+}
+
+// WithOutboxRetries sets how many times an OutboxWorker attempts each
+// delivery, and the backoff before the first retry, which doubles with
+// each attempt up to DefaultOutboxMaxBackoff
+func WithOutboxRetries(attempts int, backoff time.Duration) OutboxWorkerOption {
+	return func(w *OutboxWorker) {
+		w.maxAttempts = attempts
+		w.backoff = backoff
+	}
+}
+
+// WithOutboxLogger sets the logger an OutboxWorker writes to, in place of
+// slog.Default()
+func WithOutboxLogger(l *slog.Logger) OutboxWorkerOption {
+	return func(w *OutboxWorker) {
+		w.logger = l
+	}
+}
+
+// OutboxWorker delivers the entries of an Outbox in the background, via
+// the Processes which queued them.
+//
+// Entries for the same Process and target are delivered one at a time, in
+// the order they were queued; a retryable failure holds back later entries
+// for that target until it has been retried. Entries for different targets
+// are delivered concurrently.
+//
+// Only a single OutboxWorker should run against an Outbox at once
+type OutboxWorker struct {
+	outbox    Outbox
+	processes map[string]Process
+	logger    *slog.Logger
+
+	workers     int
+	interval    time.Duration
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// NewOutboxWorker returns an OutboxWorker delivering the entries of Outbox
+// o via processes, which should be those configured WithOutbox(o)
+func NewOutboxWorker(o Outbox, processes []Process, opts ...OutboxWorkerOption) (w *OutboxWorker, err error) {
+	w = &OutboxWorker{
+		outbox:      o,
+		processes:   make(map[string]Process),
+		logger:      slog.Default(),
+		workers:     DefaultOutboxWorkers,
+		interval:    DefaultOutboxPollInterval,
+		maxAttempts: DefaultOutboxMaxAttempts,
+		backoff:     DefaultOutboxBackoff,
+	}
+
+	for _, p := range processes {
+		w.processes[p.ID()] = p
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.workers < 1 {
+		return nil, fmt.Errorf("outbox worker needs at least one worker, not %d", w.workers)
+	}
+
+	return
+}
+
+// Run delivers entries until ctx is cancelled, at which point it waits for
+// in-flight deliveries to finish before returning
+func (w *OutboxWorker) Run(ctx context.Context) error {
+	var (
+		// active lanes are only added to and removed from by this
+		// goroutine, between polls, so that a lane which has just
+		// finished is never restarted from stale entries
+		active = make(map[string]bool)
+		done   = make(chan string, w.workers)
+		slots  = make(chan struct{}, w.workers)
+		ticker = time.NewTicker(w.interval)
+	)
+
+	defer ticker.Stop()
+
+	for {
+		for drained := false; !drained; {
+			select {
+			case lane := <-done:
+				delete(active, lane)
+
+			default:
+				drained = true
+			}
+		}
+
+		entries, err := w.outbox.Pending(ctx, outboxLaneBatch)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Error("outbox poll failed", slog.String("error", err.Error()))
+		}
+
+		for _, lane := range lanes(entries) {
+			key := laneKey(lane[0])
+			if active[key] || lane[0].NextAttempt.After(time.Now()) {
+				continue
+			}
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return w.wait(ctx, active, done)
+			}
+
+			active[key] = true
+
+			go func(key string, lane []OutboxEntry) {
+				defer func() {
+					<-slots
+					done <- key
+				}()
+
+				w.deliverLane(ctx, lane)
+			}(key, lane)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return w.wait(ctx, active, done)
+		}
+	}
+}
+
+// wait blocks until every active lane has finished
+func (w *OutboxWorker) wait(ctx context.Context, active map[string]bool, done chan string) error {
+	for len(active) > 0 {
+		delete(active, <-done)
+	}
+
+	return ctx.Err()
+}
+
+// lanes groups entries by Process and target, keeping their order
+func lanes(entries []OutboxEntry) (l [][]OutboxEntry) {
+	idx := make(map[string]int)
+
+	for _, e := range entries {
+		key := laneKey(e)
+
+		i, ok := idx[key]
+		if !ok {
+			i = len(l)
+			idx[key] = i
+			l = append(l, nil)
+		}
+
+		l[i] = append(l[i], e)
+	}
+
+	return
+}
+
+// laneKey identifies the lane, of Process and target, e is delivered in
+func laneKey(e OutboxEntry) string {
+	return e.Process + "\x00" + e.Target + "\x00"
+}
+
+// deliverLane delivers the entries of a single lane in order, stopping at
+// the first which is to be retried later
+func (w *OutboxWorker) deliverLane(ctx context.Context, lane []OutboxEntry) {
+	for _, e := range lane {
+		if ctx.Err() != nil || e.NextAttempt.After(time.Now()) {
+			return
+		}
+
+		e = w.attempt(ctx, e)
+
+		err := w.outbox.Update(context.WithoutCancel(ctx), e)
+		if err != nil {
+			w.logger.Error("outbox update failed",
+				slog.String("id", e.ID),
+				slog.String("error", err.Error()),
+			)
+
+			return
+		}
+
+		if e.State == OutboxPending {
+			return
+		}
+	}
+}
+
+// attempt makes a single delivery of e, returning it updated with the
+// outcome
+func (w *OutboxWorker) attempt(ctx context.Context, e OutboxEntry) OutboxEntry {
+	e.Attempts++
+
+	p, ok := w.processes[e.Process]
+	if !ok {
+		return w.complete(e, OutboxFailed, 0, UnknownProcessErr{e.Process})
+	}
+
+	body, err := p.encode(ctx, e.Event, e.RequestID)
+	if err != nil {
+		return w.complete(e, OutboxFailed, 0, err)
+	}
+
+	t := target{url: e.Target}
+	for _, pt := range p.targets {
+		if pt.url == e.Target {
+			t = pt
+		}
+	}
+
+	// Dead letters are only written once an entry fails for good,
+	// rather than on every attempt
+	q := p
+	q.deadLetters = nil
+
+	d := q.deliver(ctx, t, e.Event, e.RequestID, body)
+
+	switch {
+	case d.err == nil:
+		return w.complete(e, OutboxDelivered, d.code, nil)
+
+	case ctx.Err() != nil:
+		// Shutting down; try again next time
+		e.Attempts--
+		e.Status = d.code
+		e.Error = p.redact(d.err.Error())
+
+		return e
+
+	case errors.As(d.err, new(TerminalStatusErr)), e.Attempts >= w.maxAttempts:
+		p.deadLetter(ctx, &d, e.RequestID, e.Event)
+
+		return w.complete(e, OutboxFailed, d.code, errors.New(p.redact(d.err.Error())))
+	}
+
+	backoff := w.backoff << (e.Attempts - 1)
+	if backoff <= 0 || backoff > DefaultOutboxMaxBackoff {
+		backoff = DefaultOutboxMaxBackoff
+	}
+
+	e.NextAttempt = time.Now().Add(backoff)
+	e.Status = d.code
+	e.Error = p.redact(d.err.Error())
+
+	return e
+}
+
+func (w *OutboxWorker) complete(e OutboxEntry, state OutboxState, status int, err error) OutboxEntry {
+	e.State = state
+	e.Status = status
+	e.CompletedAt = time.Now()
+	e.Error = ""
+
+	if err != nil {
+		e.Error = err.Error()
+
+		w.logger.Warn("outbox delivery failed",
+			slog.String("id", e.ID),
+			slog.String("request_id", e.RequestID),
+			slog.String("process", e.Process),
+			slog.String("url", redactURL(e.Target)),
+			slog.Int("attempts", e.Attempts),
+			slog.String("error", e.Error),
+		)
+	}
+
+	return e
+}
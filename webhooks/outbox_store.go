@@ -0,0 +1,405 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultOutboxTable is the table a PostgresOutbox uses when created with
+// an empty table name
+const DefaultOutboxTable = "webhook_outbox"
+
+var (
+	boltEntries = []byte("entries")
+	boltPending = []byte("pending")
+	boltLanes   = []byte("lanes")
+	boltIDs     = []byte("ids")
+)
+
+// BoltOutbox is an Outbox which stores entries in a local bbolt file.
+//
+// bbolt holds an exclusive lock on its file, so only a single process may
+// open a BoltOutbox at once
+type BoltOutbox struct {
+	db *bolt.DB
+}
+
+// NewBoltOutbox opens the BoltOutbox at path, creating it if it does not
+// already exist
+func NewBoltOutbox(path string) (o *BoltOutbox, err error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) (err error) {
+		for _, b := range [][]byte{boltEntries, boltPending, boltLanes, boltIDs} {
+			_, err = tx.CreateBucketIfNotExists(b)
+			if err != nil {
+				return
+			}
+		}
+
+		return
+	})
+	if err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+
+	return &BoltOutbox{db: db}, nil
+}
+
+// Close closes the underlying bbolt file
+func (o *BoltOutbox) Close() error {
+	return o.db.Close()
+}
+
+// Enqueue implements the Outbox interface
+func (o *BoltOutbox) Enqueue(_ context.Context, e OutboxEntry) (OutboxEntry, error) {
+	err := o.db.Update(func(tx *bolt.Tx) (err error) {
+		e.Seq, err = tx.Bucket(boltEntries).NextSequence()
+		if err != nil {
+			return
+		}
+
+		return o.put(tx, e)
+	})
+
+	return e, err
+}
+
+// Pending implements the Outbox interface
+func (o *BoltOutbox) Pending(_ context.Context, perLane int) (entries []OutboxEntry, err error) {
+	entries = make([]OutboxEntry, 0)
+
+	err = o.db.View(func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket(boltEntries)
+		c := tx.Bucket(boltLanes).Cursor()
+
+		// Lane keys sort by lane, and then by sequence, so each lane
+		// is read from its oldest entry until perLane entries have been
+		// read, at which point the rest of the lane is skipped
+		var (
+			lane []byte
+			n    int
+		)
+
+		for k, seq := c.First(); k != nil; {
+			prefix := k[:len(k)-8]
+			if !bytes.Equal(prefix, lane) {
+				lane, n = prefix, 0
+			}
+
+			if n == perLane {
+				k, seq = c.Seek(nextLane(lane))
+
+				continue
+			}
+
+			var e OutboxEntry
+
+			err = json.Unmarshal(b.Get(seq), &e)
+			if err != nil {
+				return
+			}
+
+			entries = append(entries, e)
+			n++
+
+			k, seq = c.Next()
+		}
+
+		return
+	})
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+
+	return
+}
+
+// Update implements the Outbox interface
+func (o *BoltOutbox) Update(_ context.Context, e OutboxEntry) error {
+	return o.db.Update(func(tx *bolt.Tx) error {
+		seq := tx.Bucket(boltIDs).Get([]byte(e.ID))
+		if seq == nil {
+			return UnknownOutboxEntryErr{e.ID}
+		}
+
+		e.Seq = binary.BigEndian.Uint64(seq)
+
+		return o.put(tx, e)
+	})
+}
+
+// Get implements the Outbox interface
+func (o *BoltOutbox) Get(_ context.Context, id string) (e OutboxEntry, err error) {
+	err = o.db.View(func(tx *bolt.Tx) error {
+		seq := tx.Bucket(boltIDs).Get([]byte(id))
+		if seq == nil {
+			return UnknownOutboxEntryErr{id}
+		}
+
+		return json.Unmarshal(tx.Bucket(boltEntries).Get(seq), &e)
+	})
+
+	return
+}
+
+// List implements the Outbox interface
+func (o *BoltOutbox) List(_ context.Context, q OutboxQuery) (entries []OutboxEntry, err error) {
+	entries = make([]OutboxEntry, 0)
+
+	err = o.db.View(func(tx *bolt.Tx) (err error) {
+		c := tx.Bucket(boltEntries).Cursor()
+
+		for k, v := c.Last(); k != nil && (q.Limit == 0 || len(entries) < q.Limit); k, v = c.Prev() {
+			var e OutboxEntry
+
+			err = json.Unmarshal(v, &e)
+			if err != nil {
+				return
+			}
+
+			if q.match(e) {
+				entries = append(entries, e)
+			}
+		}
+
+		return
+	})
+
+	return
+}
+
+// put writes e and its indexes; callers must be within an Update
+func (o *BoltOutbox) put(tx *bolt.Tx, e OutboxEntry) (err error) {
+	v, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, e.Seq)
+
+	err = tx.Bucket(boltEntries).Put(k, v)
+	if err != nil {
+		return
+	}
+
+	err = tx.Bucket(boltIDs).Put([]byte(e.ID), k)
+	if err != nil {
+		return
+	}
+
+	if e.State == OutboxPending {
+		err = tx.Bucket(boltPending).Put(k, nil)
+		if err != nil {
+			return
+		}
+
+		return tx.Bucket(boltLanes).Put(boltLaneKey(e), k)
+	}
+
+	err = tx.Bucket(boltPending).Delete(k)
+	if err != nil {
+		return
+	}
+
+	return tx.Bucket(boltLanes).Delete(boltLaneKey(e))
+}
+
+// boltLaneKey returns the key e is indexed under in the lanes bucket: its
+// lane, followed by its sequence
+func boltLaneKey(e OutboxEntry) []byte {
+	return binary.BigEndian.AppendUint64([]byte(laneKey(e)), e.Seq)
+}
+
+// nextLane returns the smallest key which sorts after every key in lane
+func nextLane(lane []byte) []byte {
+	next := bytes.Clone(lane)
+	next[len(next)-1]++
+
+	return next
+}
+
+// PostgresOutbox is an Outbox which stores entries in a Postgres table.
+//
+// As with PostgresDeadLetterStore, it accepts a *sql.DB so that callers can
+// use whichever driver they already depend on
+type PostgresOutbox struct {
+	db    *sql.DB
+	table string
+}
+
+// NewPostgresOutbox returns a PostgresOutbox storing entries in table,
+// creating it if it does not already exist.
+//
+// An empty table uses DefaultOutboxTable
+func NewPostgresOutbox(ctx context.Context, db *sql.DB, table string) (o PostgresOutbox, err error) {
+	if table == "" {
+		table = DefaultOutboxTable
+	}
+
+	o.db = db
+	o.table = quoteIdentifier(table)
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+    seq          bigserial PRIMARY KEY,
+    id           text NOT NULL UNIQUE,
+    request_id   text NOT NULL,
+    process      text NOT NULL,
+    target       text NOT NULL,
+    event        jsonb NOT NULL,
+    enqueued_at  timestamptz NOT NULL,
+    state        text NOT NULL,
+    attempts     integer NOT NULL,
+    next_attempt timestamptz NOT NULL,
+    completed_at timestamptz,
+    status       integer NOT NULL,
+    error        text NOT NULL
+)`, o.table))
+	if err != nil {
+		return
+	}
+
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (process, target, seq) WHERE state = 'pending'`,
+		quoteIdentifier(strings.ReplaceAll(table, ".", "_")+"_pending_lanes"), o.table,
+	))
+
+	return
+}
+
+const outboxColumns = `seq, id, request_id, process, target, event, enqueued_at, state, attempts, next_attempt, completed_at, status, error`
+
+// Enqueue implements the Outbox interface
+func (o PostgresOutbox) Enqueue(ctx context.Context, e OutboxEntry) (OutboxEntry, error) {
+	ev, err := json.Marshal(e.Event)
+	if err != nil {
+		return e, err
+	}
+
+	err = o.db.QueryRowContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, request_id, process, target, event, enqueued_at, state, attempts, next_attempt, status, error)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING seq`, o.table),
+		e.ID, e.RequestID, e.Process, e.Target, ev, e.EnqueuedAt, e.State, e.Attempts, e.NextAttempt, e.Status, e.Error,
+	).Scan(&e.Seq)
+
+	return e, err
+}
+
+// Pending implements the Outbox interface
+func (o PostgresOutbox) Pending(ctx context.Context, perLane int) ([]OutboxEntry, error) {
+	return o.query(ctx, fmt.Sprintf(`SELECT %[1]s FROM (
+    SELECT %[1]s, row_number() OVER (PARTITION BY process, target ORDER BY seq) AS lane_position
+    FROM %[2]s WHERE state = $1
+) pending WHERE lane_position <= $2 ORDER BY seq`, outboxColumns, o.table), OutboxPending, perLane)
+}
+
+// Update implements the Outbox interface
+func (o PostgresOutbox) Update(ctx context.Context, e OutboxEntry) (err error) {
+	var completed sql.NullTime
+	if !e.CompletedAt.IsZero() {
+		completed = sql.NullTime{Time: e.CompletedAt, Valid: true}
+	}
+
+	res, err := o.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET state = $2, attempts = $3, next_attempt = $4, completed_at = $5, status = $6, error = $7 WHERE id = $1`, o.table),
+		e.ID, e.State, e.Attempts, e.NextAttempt, completed, e.Status, e.Error,
+	)
+	if err != nil {
+		return
+	}
+
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		err = UnknownOutboxEntryErr{e.ID}
+	}
+
+	return
+}
+
+// Get implements the Outbox interface
+func (o PostgresOutbox) Get(ctx context.Context, id string) (e OutboxEntry, err error) {
+	e, err = scanOutboxEntry(o.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT %s FROM %s WHERE id = $1`, outboxColumns, o.table), id))
+	if errors.Is(err, sql.ErrNoRows) {
+		err = UnknownOutboxEntryErr{id}
+	}
+
+	return
+}
+
+// List implements the Outbox interface
+func (o PostgresOutbox) List(ctx context.Context, q OutboxQuery) ([]OutboxEntry, error) {
+	var (
+		where []string
+		args  []any
+	)
+
+	for col, v := range map[string]string{"process": q.Process, "target": q.Target, "state": string(q.State)} {
+		if v != "" {
+			args = append(args, v)
+			where = append(where, fmt.Sprintf("%s = $%d", col, len(args)))
+		}
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s`, outboxColumns, o.table)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	query += " ORDER BY seq DESC"
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", q.Limit)
+	}
+
+	return o.query(ctx, query, args...)
+}
+
+func (o PostgresOutbox) query(ctx context.Context, query string, args ...any) (entries []OutboxEntry, err error) {
+	rows, err := o.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return
+	}
+
+	defer rows.Close()
+
+	entries = make([]OutboxEntry, 0)
+	for rows.Next() {
+		var e OutboxEntry
+
+		e, err = scanOutboxEntry(rows)
+		if err != nil {
+			return
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+func scanOutboxEntry(row interface{ Scan(...any) error }) (e OutboxEntry, err error) {
+	var (
+		ev        []byte
+		completed sql.NullTime
+	)
+
+	err = row.Scan(&e.Seq, &e.ID, &e.RequestID, &e.Process, &e.Target, &ev, &e.EnqueuedAt, &e.State, &e.Attempts, &e.NextAttempt, &completed, &e.Status, &e.Error)
+	if err != nil {
+		return
+	}
+
+	e.CompletedAt = completed.Time
+
+	err = json.Unmarshal(ev, &e.Event)
+
+	return
+}
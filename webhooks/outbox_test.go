@@ -0,0 +1,479 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func newBoltOutbox(t *testing.T) *BoltOutbox {
+	t.Helper()
+
+	o, err := NewBoltOutbox(filepath.Join(t.TempDir(), "outbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { o.Close() })
+
+	return o
+}
+
+// orderServer records the IDs of the Events it receives, failing the
+// first failures calls with status
+func orderServer(t *testing.T, status int, failures int64) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		ids   []string
+		calls atomic.Int64
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+
+			return
+		}
+
+		var e orchestrator.Event
+		json.NewDecoder(r.Body).Decode(&e)
+
+		mu.Lock()
+		ids = append(ids, e.ID)
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), ids...)
+	}
+}
+
+// runWorker runs an OutboxWorker until the test is done
+func runWorker(t *testing.T, o Outbox, processes []Process, opts ...OutboxWorkerOption) {
+	t.Helper()
+
+	w, err := NewOutboxWorker(o, processes, append([]OutboxWorkerOption{WithOutboxPollInterval(10 * time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() { done <- w.Run(ctx) }()
+
+	t.Cleanup(func() {
+		cancel()
+
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+// waitForState waits until every entry in o is in state
+func waitForState(t *testing.T, o Outbox, n int, state OutboxState) []OutboxEntry {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err := o.List(context.Background(), OutboxQuery{State: state})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(entries) == n {
+			return entries
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for %d %s entries", n, state)
+
+	return nil
+}
+
+func TestBoltOutbox(t *testing.T) {
+	testOutbox(t, newBoltOutbox(t))
+}
+
+func TestPostgresOutbox(t *testing.T) {
+	db := testDB(t)
+
+	o, err := NewPostgresOutbox(context.Background(), db, "test_outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Exec("DROP TABLE test_outbox") })
+
+	testOutbox(t, o)
+}
+
+// testOutbox runs the tests every Outbox should pass against o, which must
+// start empty
+func testOutbox(t *testing.T, o Outbox) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b", "c"} {
+		e, err := o.Enqueue(ctx, OutboxEntry{ID: id, Process: "p", Target: "t-" + id, Event: orchestrator.Event{Operation: orchestrator.OperationCreate}, State: OutboxPending, EnqueuedAt: time.Now(), NextAttempt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Seq == 0 {
+			t.Errorf("expected sequence to be set")
+		}
+	}
+
+	b, err := o.Get(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.State = OutboxDelivered
+	b.Status = http.StatusOK
+
+	err = o.Update(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := o.Pending(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 2 || pending[0].ID != "a" || pending[1].ID != "c" {
+		t.Errorf("expected a and c to be pending in order, received %#v", pending)
+	}
+
+	all, err := o.List(ctx, OutboxQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 3 || all[0].ID != "c" || all[2].ID != "a" {
+		t.Errorf("expected every entry, newest first, received %#v", all)
+	}
+
+	for _, test := range []struct {
+		name   string
+		q      OutboxQuery
+		expect int
+	}{
+		{"by state", OutboxQuery{State: OutboxDelivered}, 1},
+		{"by target", OutboxQuery{Target: "t-a"}, 1},
+		{"by process", OutboxQuery{Process: "p"}, 3},
+		{"limited", OutboxQuery{Limit: 2}, 2},
+		{"unmatched", OutboxQuery{Process: "q"}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			entries, err := o.List(ctx, test.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != test.expect {
+				t.Errorf("expected %d entries, received %d", test.expect, len(entries))
+			}
+		})
+	}
+
+	_, err = o.Get(ctx, "nope")
+	if !errors.As(err, new(UnknownOutboxEntryErr)) {
+		t.Errorf("expected error of type %T, received %#v", UnknownOutboxEntryErr{}, err)
+	}
+
+	err = o.Update(ctx, OutboxEntry{ID: "nope"})
+	if !errors.As(err, new(UnknownOutboxEntryErr)) {
+		t.Errorf("expected error of type %T, received %#v", UnknownOutboxEntryErr{}, err)
+	}
+
+	t.Run("pending is limited per lane", func(t *testing.T) {
+		for _, id := range []string{"d", "e", "f"} {
+			_, err := o.Enqueue(ctx, OutboxEntry{ID: id, Process: "p", Target: "t-a", Event: orchestrator.Event{Operation: orchestrator.OperationCreate}, State: OutboxPending})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		pending, err := o.Pending(ctx, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]string, len(pending))
+		for i, e := range pending {
+			ids[i] = e.ID
+		}
+
+		if strings.Join(ids, ",") != "a,c,d" {
+			t.Errorf("expected a,c,d to be pending, received %v", ids)
+		}
+	})
+}
+
+func TestProcess_Run_Outbox(t *testing.T) {
+	srv := slowServer(t, time.Second, new(atomic.Int64))
+	o := newBoltOutbox(t)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLsKey: srv.URL + "/a," + srv.URL + "/b"},
+	}, WithOutbox(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected run to return without waiting on the receiver, took %s", elapsed)
+	}
+
+	if ps.Status != orchestrator.ProcessSuccess {
+		t.Errorf("expected success, received %v", ps.Status)
+	}
+
+	pending, err := o.Pending(context.Background(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 2 || pending[0].Target != srv.URL+"/a" || pending[1].Target != srv.URL+"/b" || pending[0].Event.ID != "1" {
+		t.Errorf("expected a pending entry per target, received %#v", pending)
+	}
+}
+
+func TestOutboxWorker_DeliversInOrder(t *testing.T) {
+	o := newBoltOutbox(t)
+
+	var (
+		processes []Process
+		received  []func() []string
+	)
+
+	for _, name := range []string{"first", "second"} {
+		srv, ids := orderServer(t, 0, 0)
+
+		p, err := NewProcess(orchestrator.ProcessConfig{
+			Name:             name,
+			ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+		}, WithOutbox(o))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		processes = append(processes, p)
+		received = append(received, ids)
+	}
+
+	expect := make([]string, 20)
+	for i := range expect {
+		expect[i] = string(rune('a' + i))
+
+		for _, p := range processes {
+			_, err := p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: expect[i]})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	runWorker(t, o, processes, WithOutboxWorkers(4))
+
+	entries := waitForState(t, o, 40, OutboxDelivered)
+	if entries[0].Attempts != 1 || entries[0].Status != http.StatusOK || entries[0].CompletedAt.IsZero() {
+		t.Errorf("expected results to be recorded, received %#v", entries[0])
+	}
+
+	for i, ids := range received {
+		got := ids()
+		if len(got) != len(expect) {
+			t.Fatalf("expected %d deliveries, received %d", len(expect), len(got))
+		}
+
+		for j := range expect {
+			if got[j] != expect[j] {
+				t.Errorf("%s: expected deliveries in order %v, received %v", processes[i].ID(), expect, got)
+
+				break
+			}
+		}
+	}
+}
+
+func TestOutboxWorker_DeadTargetDoesNotBlockOthers(t *testing.T) {
+	o := newBoltOutbox(t)
+
+	dead, _ := orderServer(t, http.StatusServiceUnavailable, 1<<30)
+	healthy, ids := orderServer(t, 0, 0)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: dead.URL},
+	}, WithOutbox(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "healthy",
+		ExecutionContext: map[string]string{TargetURLKey: healthy.URL},
+	}, WithOutbox(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// More than a poll's worth of entries for the dead target, all older
+	// than the one for the healthy target
+	for i := 0; i < outboxLaneBatch+10; i++ {
+		_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: "dead"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = q.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: "healthy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runWorker(t, o, []Process{p, q}, WithOutboxWorkers(1), WithOutboxRetries(5, time.Hour))
+
+	waitForState(t, o, 1, OutboxDelivered)
+
+	if got := ids(); len(got) != 1 || got[0] != "healthy" {
+		t.Errorf("expected the healthy target to receive its delivery, received %v", got)
+	}
+}
+
+func TestOutboxWorker_Retries(t *testing.T) {
+	o := newBoltOutbox(t)
+	srv, ids := orderServer(t, http.StatusServiceUnavailable, 2)
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+	}, WithOutbox(o))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runWorker(t, o, []Process{p}, WithOutboxRetries(5, 10*time.Millisecond))
+
+	entries := waitForState(t, o, 2, OutboxDelivered)
+
+	// Newest first
+	if entries[1].Attempts != 3 || entries[0].Attempts != 1 {
+		t.Errorf("expected the first entry to be retried before the second was sent, received %#v", entries)
+	}
+
+	if got := ids(); len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("expected deliveries in order, received %v", got)
+	}
+}
+
+func TestOutboxWorker_Failures(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		status         int
+		expectAttempts int
+	}{
+		{"terminal failures are not retried", http.StatusNotFound, 1},
+		{"retryable failures run out of attempts", http.StatusServiceUnavailable, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o := newBoltOutbox(t)
+			srv, _ := orderServer(t, test.status, 100)
+
+			dls, err := NewFileDeadLetterStore(filepath.Join(t.TempDir(), "dead-letters"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: map[string]string{TargetURLKey: srv.URL},
+			}, WithOutbox(o), WithDeadLetterStore(dls))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = p.Run(context.Background(), orchestrator.Event{Operation: orchestrator.OperationCreate, ID: "1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			runWorker(t, o, []Process{p}, WithOutboxRetries(3, time.Millisecond))
+
+			entries := waitForState(t, o, 1, OutboxFailed)
+			if entries[0].Attempts != test.expectAttempts || entries[0].Status != test.status || entries[0].Error == "" {
+				t.Errorf("unexpected result %#v", entries[0])
+			}
+
+			d, err := dls.List(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(d) != 1 {
+				t.Errorf("expected a single dead letter, received %d", len(d))
+			}
+		})
+	}
+}
+
+func TestOutboxWorker_UnknownProcess(t *testing.T) {
+	o := newBoltOutbox(t)
+
+	_, err := o.Enqueue(context.Background(), OutboxEntry{
+		ID:      "1",
+		Process: "webhooks.nope",
+		Target:  "http://example.com",
+		Event:   orchestrator.Event{Operation: orchestrator.OperationCreate},
+		State:   OutboxPending,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runWorker(t, o, nil)
+
+	entries := waitForState(t, o, 1, OutboxFailed)
+	if entries[0].Error != (UnknownProcessErr{"webhooks.nope"}).Error() {
+		t.Errorf("unexpected error %q", entries[0].Error)
+	}
+}
@@ -0,0 +1,188 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// ExecutionContext keys used to configure the limits a Process shares with
+// every other Process sending to the same host
+const (
+	// RateLimitKey sets the most requests per second sent to a target
+	// host, such as "10" or "0.5". Calls beyond this wait their turn, or
+	// until the context passed to Run is done.
+	//
+	// By default requests are not rate limited
+	RateLimitKey = "rate_limit"
+
+	// RateBurstKey sets how many requests may be sent to a target host at
+	// once, above RateLimitKey, after a quiet period. The default is 1
+	RateBurstKey = "rate_burst"
+
+	// MaxInFlightKey sets the most requests in flight to a target host at
+	// any one time; calls beyond this wait for an earlier call to finish,
+	// or until the context passed to Run is done.
+	//
+	// By default in-flight requests are not limited
+	MaxInFlightKey = "max_in_flight"
+)
+
+// HostLimiter enforces a rate limit and/or a cap on in-flight requests to
+// a single target host.
+//
+// Limiters are shared by every Process which targets the same host, and
+// can be listed with HostLimiters for monitoring
+type HostLimiter struct {
+	host    string
+	limiter *rate.Limiter
+	slots   chan struct{}
+}
+
+// limiters holds the HostLimiter of each target host
+var limiters = struct {
+	sync.Mutex
+	m map[string]*HostLimiter
+}{m: make(map[string]*HostLimiter)}
+
+// HostLimiters returns the host limiters in use, ordered by host
+func HostLimiters() (l []*HostLimiter) {
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	l = make([]*HostLimiter, 0, len(limiters.m))
+	for _, hl := range limiters.m {
+		l = append(l, hl)
+	}
+
+	sort.Slice(l, func(i, j int) bool { return l[i].host < l[j].host })
+
+	return
+}
+
+// limiterFromConfig returns the HostLimiter for the host of target,
+// creating it if this is the first Process to configure limits for that
+// host, or nil where no limits are configured for it.
+//
+// Where several Processes target the same host, the first to be created
+// with limits decides them, and every Process created afterwards shares
+// them; those configuring no limits of their own share them too, while
+// those configuring different limits return an InvalidConfigErr
+func limiterFromConfig(ec map[string]string, target string) (hl *HostLimiter, err error) {
+	var (
+		limit      rate.Limit = rate.Inf
+		burst      int
+		inFlight   int
+		configured bool
+	)
+
+	for _, k := range []string{RateLimitKey, RateBurstKey, MaxInFlightKey} {
+		if _, ok := ec[k]; ok {
+			configured = true
+		}
+	}
+
+	if v, ok := ec[RateLimitKey]; ok {
+		var f float64
+
+		f, err = strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return nil, InvalidConfigErr{RateLimitKey, v, fmt.Errorf("must be a positive number")}
+		}
+
+		limit = rate.Limit(f)
+	}
+
+	burst, err = intValue(ec, RateBurstKey, 1)
+	if err != nil {
+		return
+	}
+
+	inFlight, err = intValue(ec, MaxInFlightKey, 0)
+	if err != nil {
+		return
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, InvalidConfigErr{TargetURLKey, target, err}
+	}
+
+	limiters.Lock()
+	defer limiters.Unlock()
+
+	hl, ok := limiters.m[u.Host]
+	if ok && configured && (hl.limiter.Limit() != limit || hl.limiter.Burst() != max(burst, 1) || cap(hl.slots) != inFlight) {
+		return nil, InvalidConfigErr{TargetURLKey, redactURL(target), fmt.Errorf("%s is already limited by another Process with a different %s, %s, or %s", u.Host, RateLimitKey, RateBurstKey, MaxInFlightKey)}
+	}
+
+	if !ok && (limit != rate.Inf || inFlight > 0) {
+		hl = &HostLimiter{
+			host:    u.Host,
+			limiter: rate.NewLimiter(limit, max(burst, 1)),
+		}
+
+		if inFlight > 0 {
+			hl.slots = make(chan struct{}, inFlight)
+		}
+
+		limiters.m[u.Host] = hl
+	}
+
+	return
+}
+
+// Host returns the target host this limiter guards
+func (l *HostLimiter) Host() string {
+	return l.host
+}
+
+// InFlight returns the number of requests currently in flight to this
+// host, and the most allowed, where in-flight requests are capped
+func (l *HostLimiter) InFlight() (n, limit int) {
+	return len(l.slots), cap(l.slots)
+}
+
+// Limit returns the requests per second allowed to this host, and the
+// burst above that
+func (l *HostLimiter) Limit() (rps float64, burst int) {
+	return float64(l.limiter.Limit()), l.limiter.Burst()
+}
+
+// acquire waits for both an in-flight slot and the rate limit, returning a
+// function which frees the slot once the call is complete
+func (l *HostLimiter) acquire(ctx context.Context) (release func(), err error) {
+	release = func() {}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for in-flight requests to %s: %w", l.host, ctx.Err())
+		}
+	}
+
+	err = l.limiter.Wait(ctx)
+	if err != nil {
+		release()
+
+		// The limiter gives up early, before the context is done, where
+		// waiting would outlast its deadline
+		if ctx.Err() == nil {
+			if _, ok := ctx.Deadline(); ok {
+				err = fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+			}
+		}
+
+		return nil, fmt.Errorf("waiting for rate limit on %s: %w", l.host, err)
+	}
+
+	return
+}
@@ -0,0 +1,272 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// slowServer holds each request for delay, recording the most requests
+// it has seen in flight at once
+func slowServer(t *testing.T, delay time.Duration, peak *atomic.Int64) *httptest.Server {
+	t.Helper()
+
+	var current atomic.Int64
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		time.Sleep(delay)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+// newLimitedProcess creates a Process targeting url, forgetting any
+// limiter it creates once the test is done, since test servers may reuse
+// the ports of earlier tests
+func newLimitedProcess(t *testing.T, url string, ec map[string]string) Process {
+	t.Helper()
+
+	ec[TargetURLKey] = url
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name:             "tests",
+		ExecutionContext: ec,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := p.targets[0].limiter; l != nil {
+		t.Cleanup(func() {
+			limiters.Lock()
+			defer limiters.Unlock()
+
+			delete(limiters.m, l.host)
+		})
+	}
+
+	return p
+}
+
+func TestProcess_Run_RateLimit(t *testing.T) {
+	srv := slowServer(t, 0, new(atomic.Int64))
+
+	ec := map[string]string{RateLimitKey: "20", RateBurstKey: "2"}
+
+	// Both processes target the same host, and so share a limiter
+	a := newLimitedProcess(t, srv.URL, ec)
+	b := newLimitedProcess(t, srv.URL+"/other", map[string]string{RateLimitKey: "20", RateBurstKey: "2"})
+
+	if a.targets[0].limiter != b.targets[0].limiter {
+		t.Fatal("expected processes targeting the same host to share a limiter")
+	}
+
+	start := time.Now()
+
+	for i := 0; i < 6; i++ {
+		p := a
+		if i%2 == 1 {
+			p = b
+		}
+
+		_, err := p.Run(context.Background(), orchestrator.Event{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A burst of 2, then 4 more at 20/s, takes at least 200ms
+	if elapsed := time.Since(start); elapsed < 180*time.Millisecond {
+		t.Errorf("expected calls to be rate limited, took %s", elapsed)
+	}
+}
+
+func TestProcess_Run_MaxInFlight(t *testing.T) {
+	peak := new(atomic.Int64)
+	srv := slowServer(t, 50*time.Millisecond, peak)
+
+	a := newLimitedProcess(t, srv.URL, map[string]string{MaxInFlightKey: "2"})
+	b := newLimitedProcess(t, srv.URL, map[string]string{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		p := a
+		if i%2 == 1 {
+			p = b
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := p.Run(context.Background(), orchestrator.Event{})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if n := peak.Load(); n != 2 {
+		t.Errorf("expected at most 2 requests in flight, saw %d", n)
+	}
+
+	if n, limit := a.targets[0].limiter.InFlight(); n != 0 || limit != 2 {
+		t.Errorf("expected 0 of 2 in flight, received %d of %d", n, limit)
+	}
+}
+
+func TestProcess_Run_LimitWaitRespectsContext(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"rate limit", map[string]string{RateLimitKey: "0.1"}},
+		{"in-flight limit", map[string]string{MaxInFlightKey: "1"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv := slowServer(t, 200*time.Millisecond, new(atomic.Int64))
+			p := newLimitedProcess(t, srv.URL, test.ec)
+
+			// Use up the limit
+			go p.Run(context.Background(), orchestrator.Event{})
+			time.Sleep(20 * time.Millisecond)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+
+			ps, err := p.Run(ctx, orchestrator.Event{})
+			if err == nil {
+				t.Fatal("expected error, received none")
+			}
+
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected %v, received %v", context.DeadlineExceeded, err)
+			}
+
+			if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+				t.Errorf("expected wait to end with the context, took %s", elapsed)
+			}
+
+			if ps.Status != orchestrator.ProcessFail {
+				t.Errorf("expected failure, received %v", ps.Status)
+			}
+		})
+	}
+}
+
+func TestHostLimiters(t *testing.T) {
+	srv := slowServer(t, 0, new(atomic.Int64))
+	p := newLimitedProcess(t, srv.URL, map[string]string{RateLimitKey: "5", RateBurstKey: "3", MaxInFlightKey: "4"})
+
+	var found bool
+	for _, l := range HostLimiters() {
+		if l != p.targets[0].limiter {
+			continue
+		}
+
+		found = true
+
+		if rps, burst := l.Limit(); rps != 5 || burst != 3 {
+			t.Errorf("expected 5/s with burst 3, received %v/s with burst %d", rps, burst)
+		}
+
+		if _, limit := l.InFlight(); limit != 4 {
+			t.Errorf("expected in-flight limit of 4, received %d", limit)
+		}
+	}
+
+	if !found {
+		t.Errorf("expected %s to be listed", p.targets[0].limiter.Host())
+	}
+
+	if unlimited := newLimitedProcess(t, "https://unlimited.example.com", map[string]string{}); unlimited.targets[0].limiter != nil {
+		t.Error("expected no limiter where none is configured")
+	}
+}
+
+func TestNewProcess_RateLimitConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"invalid rate", map[string]string{RateLimitKey: "fast"}},
+		{"negative rate", map[string]string{RateLimitKey: "-1"}},
+		{"invalid burst", map[string]string{RateLimitKey: "1", RateBurstKey: "lots"}},
+		{"invalid in-flight limit", map[string]string{MaxInFlightKey: "many"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
+
+func TestNewProcess_ConflictingLimits(t *testing.T) {
+	srv := slowServer(t, 0, new(atomic.Int64))
+	p := newLimitedProcess(t, srv.URL, map[string]string{RateLimitKey: "5", MaxInFlightKey: "2"})
+
+	for _, test := range []struct {
+		name        string
+		ec          map[string]string
+		expectError bool
+	}{
+		{"unconfigured", map[string]string{}, false},
+		{"same limits", map[string]string{RateLimitKey: "5", RateBurstKey: "1", MaxInFlightKey: "2"}, false},
+		{"different rate", map[string]string{RateLimitKey: "10", MaxInFlightKey: "2"}, true},
+		{"different burst", map[string]string{RateLimitKey: "5", RateBurstKey: "3", MaxInFlightKey: "2"}, true},
+		{"different in-flight limit", map[string]string{RateLimitKey: "5"}, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = srv.URL + "/other"
+
+			q, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if test.expectError {
+				if !errors.As(err, new(InvalidConfigErr)) {
+					t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if q.targets[0].limiter != p.targets[0].limiter {
+				t.Error("expected processes targeting the same host to share a limiter")
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// ExecutionContext keys used to configure what a Process records of the
+// responses it receives
+const (
+	// CaptureResponseKey, when "true", records the status, selected
+	// headers, and body of each response into ProcessStatus.Logs, from
+	// where they can be read back with CapturedResponses
+	CaptureResponseKey = "capture_response"
+
+	// CaptureHeadersKey sets a comma separated list of response headers
+	// to capture. By default no headers are captured
+	CaptureHeadersKey = "capture_headers"
+
+	// MaxResponseBytesKey sets the most of a response body which is
+	// captured, or chained into a new Event. The default is
+	// DefaultMaxResponseBytes
+	MaxResponseBytesKey = "max_response_bytes"
+)
+
+// DefaultMaxResponseBytes is the most of a response body captured when no
+// MaxResponseBytesKey is set
+const DefaultMaxResponseBytes = 64 << 10
+
+// responseLogPrefix prefixes captured responses in ProcessStatus.Logs
+const responseLogPrefix = "response: "
+
+// CapturedResponse is a response received by a Process configured with
+// CaptureResponseKey
+type CapturedResponse struct {
+	Target    string            `json:"target"`
+	Status    int               `json:"status"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      string            `json:"body,omitempty"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// CapturedResponses returns the responses recorded into ps, in the order
+// they were received
+func CapturedResponses(ps orchestrator.ProcessStatus) (r []CapturedResponse) {
+	r = make([]CapturedResponse, 0)
+
+	for _, l := range ps.Logs {
+		s, ok := strings.CutPrefix(l, responseLogPrefix)
+		if !ok {
+			continue
+		}
+
+		var cr CapturedResponse
+		if json.Unmarshal([]byte(s), &cr) == nil {
+			r = append(r, cr)
+		}
+	}
+
+	return
+}
+
+// capture configures what a Process records of the responses it receives
+type capture struct {
+	enabled  bool
+	headers  []string
+	maxBytes int
+}
+
+func captureFromConfig(ec map[string]string) (c capture, err error) {
+	if v, ok := ec[CaptureResponseKey]; ok {
+		c.enabled, err = strconv.ParseBool(v)
+		if err != nil {
+			return c, InvalidConfigErr{CaptureResponseKey, v, err}
+		}
+	}
+
+	for _, h := range strings.Split(ec[CaptureHeadersKey], ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			c.headers = append(c.headers, http.CanonicalHeaderKey(h))
+		}
+	}
+
+	c.maxBytes, err = intValue(ec, MaxResponseBytesKey, DefaultMaxResponseBytes)
+
+	return
+}
+
+// WithChainInput turns the JSON body of every successful response into a
+// new orchestrator.Event, which is fed back into the orchestrator via
+// ChainInput ci, allowing pipelines to chain HTTP calls together.
+//
+// Bodies are mapped using the EventMapper ci was created with, and must
+// fit within MaxResponseBytesKey
+func WithChainInput(ci *ChainInput) ProcessOption {
+	return func(p *Process) {
+		p.chain = ci
+	}
+}
+
+// ChainInput implements the orchestrator.Input interface, emitting Events
+// built from the responses received by any Process configured with
+// WithChainInput
+type ChainInput struct {
+	ic     orchestrator.InputConfig
+	opts   inputOptions
+	health *inputHealth
+
+	mu sync.Mutex
+	c  chan orchestrator.Event
+}
+
+// NewChainInput creates a ChainInput, to be passed to one or more Processes
+// via WithChainInput, and added to the orchestrator as any other Input.
+//
+// Of the InputOptions, only WithEventMapper, WithInputLogger, and
+// WithQueueLimit have any effect
+func NewChainInput(ic orchestrator.InputConfig, opts ...InputOption) (ci *ChainInput, err error) {
+	return &ChainInput{
+		ic:     ic,
+		opts:   defaultInputOptions(opts),
+		health: new(inputHealth),
+	}, nil
+}
+
+// Handle implements the Handle function of the orchestrator.Input
+// interface.
+//
+// Events are emitted by the Processes this ChainInput was passed to, and
+// so Handle simply blocks until ctx is cancelled, since the orchestrator
+// expects Handle to return on errors only
+func (ci *ChainInput) Handle(ctx context.Context, c chan orchestrator.Event) error {
+	ci.mu.Lock()
+	ci.c = c
+	ci.health.state.Store(stateRunning)
+	ci.mu.Unlock()
+
+	<-ctx.Done()
+
+	ci.mu.Lock()
+	ci.c = nil
+	ci.health.state.Store(stateStopped)
+	ci.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// ID returns an ID for this input
+func (ci *ChainInput) ID() string {
+	return ci.ic.ID()
+}
+
+// Health implements the HealthChecker interface.
+//
+// A ChainInput is live until the context passed to Handle is cancelled,
+// and ready while fewer Events than the queue limit are waiting on the
+// orchestrator
+func (ci *ChainInput) Health() (live, ready bool, detail map[string]any) {
+	state := ci.health.state.Load()
+	pending := ci.health.pending.Load()
+	saturated := pending >= int64(ci.opts.queueLimit)
+
+	return state != stateStopped, state == stateRunning && !saturated, map[string]any{
+		"state":       stateNames[state],
+		"queue_depth": pending,
+		"queue_limit": ci.opts.queueLimit,
+		"saturated":   saturated,
+	}
+}
+
+// emit maps a response body to an Event, and passes it to the orchestrator
+// with the same request ID as the call which produced it
+func (ci *ChainInput) emit(ctx context.Context, id string, body []byte) (err error) {
+	ci.mu.Lock()
+	c := ci.c
+	ci.mu.Unlock()
+
+	if c == nil {
+		return InputNotRunningErr{ci.ID()}
+	}
+
+	e, err := ci.opts.mapper(body)
+	if err != nil {
+		return fmt.Errorf("mapping response to event: %w", err)
+	}
+
+	e.Trigger = ci.ID()
+	rememberRequestID(e, id)
+
+	ci.health.pending.Add(1)
+	defer ci.health.pending.Add(-1)
+
+	select {
+	case c <- e:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readResponse reads as much of a response body as is needed to capture,
+// chain, classify, or record it, returning whether it was truncated
+func (w Process) readResponse(d *delivery, resp *http.Response) (b []byte, truncated bool) {
+	if !w.capture.enabled && w.chain == nil && len(w.classifier.body) == 0 && !w.classifier.graphQL {
+		return
+	}
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, int64(w.capture.maxBytes)+1))
+	if err != nil {
+		d.logs = append(d.logs, fmt.Sprintf("error reading response: %v", err))
+
+		return nil, false
+	}
+
+	if len(b) > w.capture.maxBytes {
+		return b[:w.capture.maxBytes], true
+	}
+
+	return b, false
+}
+
+// handleResponse captures and chains a response, as configured, appending
+// anything of note to the logs of d
+func (w Process) handleResponse(ctx context.Context, d *delivery, id string, resp *http.Response, b []byte, truncated bool) {
+	if w.classifier.graphQL {
+		w.recordGraphQL(d, b, truncated)
+	}
+
+	if w.capture.enabled {
+		cr := CapturedResponse{
+			Target:    redactURL(d.target),
+			Status:    resp.StatusCode,
+			Body:      string(b),
+			Truncated: truncated,
+		}
+
+		for _, h := range w.capture.headers {
+			if v := resp.Header.Get(h); v != "" {
+				if cr.Headers == nil {
+					cr.Headers = make(map[string]string)
+				}
+
+				cr.Headers[h] = v
+			}
+		}
+
+		out, _ := json.Marshal(cr)
+		d.logs = append(d.logs, responseLogPrefix+w.redact(string(out)))
+	}
+
+	if w.chain == nil || d.err != nil {
+		return
+	}
+
+	err := fmt.Errorf("response exceeds %d bytes", w.capture.maxBytes)
+	if !truncated {
+		err = w.chain.emit(ctx, id, b)
+	}
+
+	if err != nil {
+		d.logs = append(d.logs, fmt.Sprintf("error chaining response: %v", err))
+		w.logger.LogAttrs(ctx, slog.LevelError, "webhook chain failed",
+			slog.String("request_id", id),
+			slog.String("process", w.ID()),
+			slog.String("url", redactURL(d.target)),
+			slog.String("error", err.Error()),
+		)
+	}
+}
@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// bodyServer responds to every request with status and body
+func bodyServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Rate-Limit-Remaining", "99")
+		w.Header().Set("X-Secret-Header", "nope")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestProcess_Run_CaptureResponse(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		status int
+		body   string
+		ec     map[string]string
+		expect CapturedResponse
+	}{
+		{"status and body", http.StatusOK, `{"hello":"world"}`, map[string]string{}, CapturedResponse{Status: 200, Body: `{"hello":"world"}`}},
+		{"failures are captured too", http.StatusTeapot, `short and stout`, map[string]string{}, CapturedResponse{Status: 418, Body: `short and stout`}},
+		{"selected headers", http.StatusOK, ``, map[string]string{CaptureHeadersKey: "content-type, x-rate-limit-remaining"}, CapturedResponse{
+			Status:  200,
+			Headers: map[string]string{"Content-Type": "application/json", "X-Rate-Limit-Remaining": "99"},
+		}},
+		{"truncated body", http.StatusOK, `0123456789`, map[string]string{MaxResponseBytesKey: "4"}, CapturedResponse{Status: 200, Body: `0123`, Truncated: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			srv := bodyServer(t, test.status, test.body)
+
+			test.ec[TargetURLKey] = srv.URL
+			test.ec[CaptureResponseKey] = "true"
+			test.expect.Target = srv.URL
+
+			p, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ps, _ := p.Run(context.Background(), orchestrator.Event{})
+
+			r := CapturedResponses(ps)
+			if len(r) != 1 {
+				t.Fatalf("expected a single captured response, received %#v", ps.Logs)
+			}
+
+			if r[0].Target != test.expect.Target || r[0].Status != test.expect.Status || r[0].Body != test.expect.Body || r[0].Truncated != test.expect.Truncated || len(r[0].Headers) != len(test.expect.Headers) {
+				t.Errorf("expected\n%#v\nreceived\n%#v", test.expect, r[0])
+			}
+
+			for k, v := range test.expect.Headers {
+				if r[0].Headers[k] != v {
+					t.Errorf("expected header %s: %s, received %q", k, v, r[0].Headers[k])
+				}
+			}
+		})
+	}
+}
+
+func TestProcess_Run_CaptureResponseFanOut(t *testing.T) {
+	a := bodyServer(t, http.StatusOK, "a")
+	b := bodyServer(t, http.StatusOK, "b")
+
+	p, err := NewProcess(orchestrator.ProcessConfig{
+		Name: "tests",
+		ExecutionContext: map[string]string{
+			TargetURLsKey:      a.URL + "," + b.URL,
+			CaptureResponseKey: "true",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps, err := p.Run(context.Background(), orchestrator.Event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := CapturedResponses(ps)
+	if len(r) != 2 || r[0].Body != "a" || r[1].Body != "b" {
+		t.Errorf("expected a captured response per target, received %#v", r)
+	}
+}
+
+func TestProcess_Run_ChainInput(t *testing.T) {
+	ci, err := NewChainInput(orchestrator.InputConfig{Name: "chain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newProcess := func(t *testing.T, status int, body string, ec map[string]string) Process {
+		ec[TargetURLKey] = bodyServer(t, status, body).URL
+
+		p, err := NewProcess(orchestrator.ProcessConfig{
+			Name:             "tests",
+			ExecutionContext: ec,
+		}, WithChainInput(ci))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return p
+	}
+
+	t.Run("not yet running", func(t *testing.T) {
+		p := newProcess(t, http.StatusOK, `{"location":"enriched","operation":"create","id":"1"}`, map[string]string{})
+
+		ps, err := p.Run(context.Background(), orchestrator.Event{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(strings.Join(ps.Logs, "\n"), "is not running") {
+			t.Errorf("expected chain failure to be logged, received %#v", ps.Logs)
+		}
+	})
+
+	c := make(chan orchestrator.Event, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handled := make(chan error, 1)
+	go func() { handled <- ci.Handle(ctx, c) }()
+
+	for ci.health.state.Load() != stateRunning {
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Run("successful responses are chained", func(t *testing.T) {
+		p := newProcess(t, http.StatusOK, `{"location":"enriched","operation":"create","id":"1"}`, map[string]string{})
+
+		in := orchestrator.Event{Location: "original", Operation: orchestrator.OperationCreate, ID: "0"}
+
+		_, err := p.Run(ContextWithRequestID(context.Background(), "chain-request"), in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case e := <-c:
+			if e.Location != "enriched" || e.ID != "1" || e.Trigger != ci.ID() {
+				t.Errorf("unexpected event %#v", e)
+			}
+
+			if id := eventRequestID(context.Background(), e); id != "chain-request" {
+				t.Errorf("expected chained event to keep request id, received %q", id)
+			}
+
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for chained event")
+		}
+	})
+
+	for _, test := range []struct {
+		name   string
+		status int
+		body   string
+		ec     map[string]string
+		expect string
+	}{
+		{"failed responses are not chained", http.StatusBadGateway, `{"location":"enriched","operation":"create"}`, map[string]string{}, ""},
+		{"invalid bodies are logged", http.StatusOK, `not json`, map[string]string{}, "mapping response to event"},
+		{"truncated bodies are logged", http.StatusOK, `{"location":"enriched","operation":"create"}`, map[string]string{MaxResponseBytesKey: "8"}, "exceeds 8 bytes"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := newProcess(t, test.status, test.body, test.ec)
+
+			ps, _ := p.Run(context.Background(), orchestrator.Event{})
+
+			logs := strings.Join(ps.Logs, "\n")
+			if test.expect != "" && !strings.Contains(logs, test.expect) {
+				t.Errorf("expected logs to contain %q, received %#v", test.expect, ps.Logs)
+			}
+
+			select {
+			case e := <-c:
+				t.Errorf("unexpected chained event %#v", e)
+
+			default:
+			}
+		})
+	}
+
+	live, ready, _ := ci.Health()
+	if !live || !ready {
+		t.Errorf("expected running chain input to be live and ready")
+	}
+
+	// The orchestrator treats Handle returning as the Input failing, and
+	// so it must block until cancelled
+	select {
+	case err := <-handled:
+		t.Fatalf("expected Handle to block until cancelled, returned %v", err)
+
+	default:
+	}
+
+	cancel()
+
+	if err := <-handled; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, received %v", context.Canceled, err)
+	}
+
+	p := newProcess(t, http.StatusOK, `{"location":"enriched","operation":"create","id":"1"}`, map[string]string{})
+
+	ps, _ := p.Run(context.Background(), orchestrator.Event{})
+	if !strings.Contains(strings.Join(ps.Logs, "\n"), "is not running") {
+		t.Errorf("expected chaining to a stopped input to fail, received %#v", ps.Logs)
+	}
+}
+
+func TestNewProcess_CaptureConfig(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ec   map[string]string
+	}{
+		{"invalid capture flag", map[string]string{CaptureResponseKey: "sometimes"}},
+		{"invalid max bytes", map[string]string{MaxResponseBytesKey: "lots"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			test.ec[TargetURLKey] = "https://example.com"
+
+			_, err := NewProcess(orchestrator.ProcessConfig{
+				Name:             "tests",
+				ExecutionContext: test.ec,
+			})
+			if !errors.As(err, new(InvalidConfigErr)) {
+				t.Errorf("expected error of type %T, received %#v", InvalidConfigErr{}, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package webhooks
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+// UnsupportedStreamSchemeErr is returned when the ConnectionString passed
+// to NewStreamInput is neither an http(s) URL, for Server-Sent Events, nor
+// a ws(s) URL, for WebSockets
+type UnsupportedStreamSchemeErr struct{ scheme string }
+
+// Error returns the error text for this error
+func (e UnsupportedStreamSchemeErr) Error() string {
+	return fmt.Sprintf("error creating stream input: unsupported scheme %q", e.scheme)
+}
+
+// BadStreamErr is returned when a stream endpoint refuses a connection, or
+// responds with something other than an event stream
+type BadStreamErr struct{ url, reason string }
+
+// Error returns the error text for this error
+func (e BadStreamErr) Error() string {
+	return fmt.Sprintf("error connecting to stream: %s %s", e.url, e.reason)
+}
+
+// DefaultMaxLineSize is the longest line a StreamInput reads from a
+// Server-Sent Events feed, unless set with WithMaxLineSize
+const DefaultMaxLineSize = bufio.MaxScanTokenSize
+
+// WithMaxLineSize sets the longest line, in bytes, a StreamInput reads
+// from a Server-Sent Events feed; see DefaultMaxLineSize. Events with a
+// longer line are logged and discarded
+func WithMaxLineSize(n int) InputOption {
+	return func(o *inputOptions) {
+		if n > 0 {
+			o.maxLineSize = n
+		}
+	}
+}
+
+// WithBackoff sets the minimum and maximum delays a StreamInput waits
+// between reconnection attempts.
+//
+// The delay starts at min, doubles on each consecutive failure up to max,
+// and resets to min once a connection yields an event. The defaults are
+// one second and one minute respectively.
+//
+// A Server-Sent Events feed may override the delay before reconnecting
+// with a `retry` field, which applies only to the connection it was sent
+// on
+func WithBackoff(min, max time.Duration) InputOption {
+	return func(o *inputOptions) {
+		o.minBackoff = min
+		o.maxBackoff = max
+	}
+}
+
+// StreamInput implements the orchestrator.Input interface
+//
+// Rather than waiting for events to be pushed to it, as Input does, it
+// connects out to a change feed, specified in InputConfig.ConnectionString,
+// and turns each message it receives into an orchestrator.Event using the
+// same EventMapper rules as Input.
+//
+// Feeds with an http:// or https:// URL are read as Server-Sent Events, and
+// feeds with a ws:// or wss:// URL are read as WebSockets, where each
+// message is a single payload.
+//
+// When a connection drops, StreamInput reconnects with exponential backoff,
+// sending a Last-Event-ID header so that the feed may resume where it left
+// off. For Server-Sent Events this is the last `id` field received; for
+// WebSockets, which have no such concept, it is the ID of the last Event
+type StreamInput struct {
+	ic          orchestrator.InputConfig
+	opts        inputOptions
+	websocket   bool
+	lastEventID string
+	health      *inputHealth
+	connected   *atomic.Bool
+}
+
+// NewStreamInput is an orchestrator.NewInputFunc which configures a new
+// StreamInput, connecting to the feed specified in the ConnectionString
+// field of the InputConfig passed to this function.
+//
+// No connection is made until Handle is called
+func NewStreamInput(ic orchestrator.InputConfig, opts ...InputOption) (s *StreamInput, err error) {
+	u, err := url.Parse(ic.ConnectionString)
+	if err != nil {
+		return
+	}
+
+	s = new(StreamInput)
+	s.ic = ic
+	s.opts = defaultInputOptions(opts)
+	s.health = new(inputHealth)
+	s.connected = new(atomic.Bool)
+
+	switch u.Scheme {
+	case "http", "https":
+	case "ws", "wss":
+		s.websocket = true
+
+	default:
+		err = UnsupportedStreamSchemeErr{u.Scheme}
+	}
+
+	return
+}
+
+// Handle implements the Handle function of the orchestrator.Input interface
+//
+// It connects to the configured feed and streams Events down chan `c`,
+// reconnecting whenever the feed goes away.
+//
+// This function only returns when ctx is cancelled
+func (s *StreamInput) Handle(ctx context.Context, c chan orchestrator.Event) (err error) {
+	backoff := s.opts.minBackoff
+
+	s.health.state.Store(stateRunning)
+	defer s.health.state.Store(stateStopped)
+
+	for {
+		var (
+			received bool
+			retry    time.Duration
+		)
+
+		if s.websocket {
+			received, err = s.readWebsocket(ctx, c)
+		} else {
+			received, retry, err = s.readSSE(ctx, c)
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if received {
+			backoff = s.opts.minBackoff
+		}
+
+		// A retry field sent by the feed sets the delay before the
+		// next attempt only, after which backoff carries on as usual
+		wait := backoff
+		if retry > 0 {
+			wait = min(retry, s.opts.maxBackoff)
+		}
+
+		s.opts.logger.Warn("stream disconnected",
+			slog.String("input", s.ID()),
+			slog.String("url", s.ic.ConnectionString),
+			slog.Any("error", err),
+			slog.Duration("retry_in", wait),
+		)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-time.After(wait):
+		}
+
+		backoff = min(backoff*2, s.opts.maxBackoff)
+	}
+}
+
+// ID returns an ID for this input
+func (s *StreamInput) ID() string {
+	return s.ic.ID()
+}
+
+// readSSE reads a single Server-Sent Events connection until it drops,
+// returning whether any events were read, and the reconnection delay the
+// feed asked for, if any
+func (s *StreamInput) readSSE(ctx context.Context, c chan orchestrator.Event) (received bool, retry time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.ic.ConnectionString, nil)
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	s.setLastEventID(req.Header)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, 0, BadStreamErr{s.ic.ConnectionString, fmt.Sprintf("returned %q", resp.Status)}
+	}
+
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mt != "text/event-stream" {
+		return false, 0, BadStreamErr{s.ic.ConnectionString, fmt.Sprintf("returned content type %q", mt)}
+	}
+
+	s.connected.Store(true)
+	defer s.connected.Store(false)
+
+	var (
+		data    strings.Builder
+		id      = s.lastEventID
+		tooLong bool
+		r       = bufio.NewReader(resp.Body)
+	)
+
+	for {
+		var (
+			line string
+			long bool
+		)
+
+		line, long, err = readLine(r, s.opts.maxLineSize)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+
+			return
+		}
+
+		if long {
+			tooLong = true
+
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "":
+			// A blank line dispatches the buffered event, whereas a line
+			// starting with a colon is a comment and can be ignored
+			if line != "" || (data.Len() == 0 && !tooLong) {
+				continue
+			}
+
+			if tooLong {
+				// Reconnecting would only resume from before the
+				// same event, so skip it
+				s.opts.logger.Warn("discarding stream event with an overlong line",
+					slog.String("input", s.ID()),
+					slog.Int("max_line_size", s.opts.maxLineSize),
+				)
+
+				s.lastEventID = id
+			} else if s.emit(ctx, c, []byte(strings.TrimSuffix(data.String(), "\n")), id) {
+				received = true
+			}
+
+			data.Reset()
+			tooLong = false
+
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				id = value
+			}
+
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil {
+				retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// readLine reads a line from r, without its line ending, reporting lines
+// longer than max bytes, which are read in full but not returned
+func readLine(r *bufio.Reader, max int) (line string, tooLong bool, err error) {
+	var b []byte
+
+	for {
+		var chunk []byte
+
+		chunk, err = r.ReadSlice('\n')
+		if !tooLong {
+			b = append(b, chunk...)
+			tooLong = len(b) > max+len("\r\n")
+		}
+
+		switch err {
+		case nil:
+			b = bytes.TrimSuffix(bytes.TrimSuffix(b, []byte("\n")), []byte("\r"))
+			if tooLong || len(b) > max {
+				return "", true, nil
+			}
+
+			return string(b), false, nil
+
+		case bufio.ErrBufferFull:
+			continue
+		}
+
+		return
+	}
+}
+
+// readWebsocket reads a single WebSocket connection until it drops,
+// returning whether any events were read
+func (s *StreamInput) readWebsocket(ctx context.Context, c chan orchestrator.Event) (received bool, err error) {
+	h := make(http.Header)
+	s.setLastEventID(h)
+
+	conn, _, err := websocket.Dial(ctx, s.ic.ConnectionString, &websocket.DialOptions{
+		HTTPHeader: h,
+	})
+	if err != nil {
+		return
+	}
+
+	defer conn.CloseNow()
+
+	s.connected.Store(true)
+	defer s.connected.Store(false)
+
+	for {
+		var b []byte
+
+		_, b, err = conn.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		if s.emit(ctx, c, b, s.lastEventID) {
+			received = true
+		}
+	}
+}
+
+// emit maps a payload, with event ID id, into an Event and sends it down
+// c, returning false where the payload could not be mapped.
+//
+// Where the feed provides no event IDs of its own (as with WebSockets)
+// the ID of the Event is used for resumption
+func (s *StreamInput) emit(ctx context.Context, c chan orchestrator.Event, b []byte, id string) bool {
+	e, err := s.opts.mapper(b)
+	if err != nil {
+		s.opts.logger.Warn("could not map stream message",
+			slog.String("input", s.ID()),
+			slog.Any("error", err),
+		)
+
+		// The payload would only fail to map again
+		s.lastEventID = id
+
+		return false
+	}
+
+	e.Trigger = s.ID()
+
+	if s.websocket {
+		id = e.ID
+	}
+
+	select {
+	case c <- e:
+		// Only once sent, so that an Event cancelled mid-send is
+		// resumed from, rather than skipped
+		s.lastEventID = id
+
+		return true
+
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *StreamInput) setLastEventID(h http.Header) {
+	if s.lastEventID != "" {
+		h.Set("Last-Event-ID", s.lastEventID)
+	}
+}
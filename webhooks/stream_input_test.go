@@ -0,0 +1,370 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	orchestrator "github.com/dapper-data/dapper-orchestrator"
+)
+
+func TestNewStreamInput(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		url         string
+		expectError error
+	}{
+		{"sse url is fine", "https://example.com/events", nil},
+		{"websocket url is fine", "wss://example.com/events", nil},
+		{"unsupported scheme errors", "ftp://example.com/events", UnsupportedStreamSchemeErr{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewStreamInput(orchestrator.InputConfig{
+				Name:             "test-stream-input",
+				ConnectionString: test.url,
+			})
+			if err == nil && test.expectError != nil {
+				t.Errorf("expected error, received none")
+			} else if err != nil && test.expectError == nil {
+				t.Errorf("unexpected error %#v", err)
+			}
+
+			if err != nil && test.expectError != nil {
+				_ = err.Error() // does nothing but increase codecoverage /shrug
+
+				if fmt.Sprintf("%T", test.expectError) != fmt.Sprintf("%T", err) {
+					t.Errorf("expected error of type %T, received %T", test.expectError, err)
+				}
+			}
+		})
+	}
+}
+
+// streamServer records the Last-Event-ID header of each connection it
+// receives, serving a different set of messages per connection
+type streamServer struct {
+	sync.Mutex
+
+	lastEventIDs []string
+	connectedAt  []time.Time
+	connections  [][]string
+}
+
+func (s *streamServer) next(r *http.Request) (messages []string, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.lastEventIDs = append(s.lastEventIDs, r.Header.Get("Last-Event-ID"))
+	s.connectedAt = append(s.connectedAt, time.Now())
+	if len(s.connections) == 0 {
+		return nil, false
+	}
+
+	messages, s.connections = s.connections[0], s.connections[1:]
+
+	return messages, true
+}
+
+func (s *streamServer) seen() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]string{}, s.lastEventIDs...)
+}
+
+func (s *streamServer) times() []time.Time {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]time.Time{}, s.connectedAt...)
+}
+
+func (s *streamServer) sse(w http.ResponseWriter, r *http.Request) {
+	messages, ok := s.next(r)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, m := range messages {
+		fmt.Fprint(w, m)
+	}
+}
+
+func (s *streamServer) websocket(w http.ResponseWriter, r *http.Request) {
+	messages, ok := s.next(r)
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	defer conn.CloseNow()
+
+	for _, m := range messages {
+		conn.Write(r.Context(), websocket.MessageText, []byte(m))
+	}
+
+	conn.Close(websocket.StatusNormalClosure, "")
+}
+
+func TestStreamInput_Handle(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		scheme       string
+		connections  [][]string
+		expectIDs    []string
+		expectEvents int
+	}{
+		{"sse resumes from last id", "http", [][]string{
+			{
+				": a comment\n\n",
+				"id: 1\ndata: {\"location\":\"a-table\",\"operation\":\"create\",\"id\":\"a\"}\n\n",
+				"id: 2\nevent: change\ndata: {\"location\":\"a-table\",\n",
+				"data: \"operation\":\"update\",\"id\":\"a\"}\n\n",
+			},
+			{
+				"id: 3\ndata: some bollocks\n\n",
+				"data: {\"location\":\"a-table\",\"operation\":\"delete\",\"id\":\"a\"}\n\n",
+			},
+		}, []string{"", "2", "3"}, 3},
+
+		{"websocket resumes from last event", "ws", [][]string{
+			{
+				`{"location":"a-table","operation":"create","id":"a"}`,
+				`{"location":"a-table","operation":"create","id":"b"}`,
+			},
+			{
+				`some bollocks`,
+				`{"location":"a-table","operation":"create","id":"c"}`,
+			},
+		}, []string{"", "b", "c"}, 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ss := &streamServer{connections: test.connections}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/sse", ss.sse)
+			mux.HandleFunc("/ws", ss.websocket)
+
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			u := strings.Replace(srv.URL, "http", test.scheme, 1)
+			if test.scheme == "ws" {
+				u += "/ws"
+			} else {
+				u += "/sse"
+			}
+
+			s, err := NewStreamInput(orchestrator.InputConfig{
+				Name:             "test-stream-input",
+				ConnectionString: u,
+			}, WithBackoff(time.Millisecond, time.Millisecond*10))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			c := make(chan orchestrator.Event)
+			errC := make(chan error)
+
+			go func() {
+				errC <- s.Handle(ctx, c)
+			}()
+
+			events := make([]orchestrator.Event, 0)
+			for len(events) < test.expectEvents {
+				select {
+				case e := <-c:
+					events = append(events, e)
+
+				case <-time.After(time.Second):
+					t.Fatalf("timed out waiting for events, received %#v", events)
+				}
+			}
+
+			// Wait for the input to reconnect a final time, so we can be
+			// sure of the id it resumes from
+			for len(ss.seen()) < len(test.expectIDs) {
+				time.Sleep(time.Millisecond)
+			}
+
+			cancel()
+
+			err = <-errC
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("unexpected error %#v", err)
+			}
+
+			for _, e := range events {
+				if e.Trigger != "test-stream-input" {
+					t.Errorf("expected trigger %q, received %q", "test-stream-input", e.Trigger)
+				}
+			}
+
+			seen := ss.seen()[:len(test.expectIDs)]
+			if fmt.Sprint(test.expectIDs) != fmt.Sprint(seen) {
+				t.Errorf("expected Last-Event-IDs %q, received %q", test.expectIDs, seen)
+			}
+		})
+	}
+}
+
+func TestStreamInput_Handle_Retry(t *testing.T) {
+	ss := &streamServer{connections: [][]string{
+		{"retry: 100\ndata: {\"location\":\"a-table\",\"operation\":\"create\",\"id\":\"a\"}\n\n"},
+	}}
+
+	srv := httptest.NewServer(http.HandlerFunc(ss.sse))
+	defer srv.Close()
+
+	s, err := NewStreamInput(orchestrator.InputConfig{
+		Name:             "test-stream-input",
+		ConnectionString: srv.URL,
+	}, WithBackoff(time.Millisecond, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := make(chan orchestrator.Event)
+	go s.Handle(ctx, c)
+
+	<-c
+
+	for len(ss.times()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	times := ss.times()
+
+	// The retry field applies to the reconnection after the connection
+	// it was sent on, and no further
+	if gap := times[1].Sub(times[0]); gap < 100*time.Millisecond {
+		t.Errorf("expected to wait at least 100ms to reconnect, waited %v", gap)
+	}
+
+	if gap := times[2].Sub(times[1]); gap >= 100*time.Millisecond {
+		t.Errorf("expected retry field to apply to a single reconnection, waited %v", gap)
+	}
+
+	if s.opts.minBackoff != time.Millisecond {
+		t.Errorf("expected configured backoff to be left alone, received %v", s.opts.minBackoff)
+	}
+}
+
+func TestStreamInput_Handle_LineTooLong(t *testing.T) {
+	ss := &streamServer{connections: [][]string{
+		{
+			"id: 1\ndata: " + strings.Repeat("a", 2048) + "\n\n",
+			"id: 2\ndata: {\"location\":\"a-table\",\"operation\":\"create\",\"id\":\"b\"}\r\n\r\n",
+		},
+	}}
+
+	srv := httptest.NewServer(http.HandlerFunc(ss.sse))
+	defer srv.Close()
+
+	s, err := NewStreamInput(orchestrator.InputConfig{
+		Name:             "test-stream-input",
+		ConnectionString: srv.URL,
+	}, WithBackoff(time.Millisecond, time.Millisecond), WithMaxLineSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := make(chan orchestrator.Event)
+	errC := make(chan error, 1)
+
+	go func() {
+		errC <- s.Handle(ctx, c)
+	}()
+
+	// The overlong event is skipped, and the rest of the feed read
+	select {
+	case e := <-c:
+		if e.ID != "b" {
+			t.Errorf("expected event b, received %#v", e)
+		}
+
+	case err := <-errC:
+		t.Fatalf("unexpected return from Handle %#v", err)
+
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	for len(ss.seen()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+
+	if err := <-errC; !errors.Is(err, context.Canceled) {
+		t.Errorf("unexpected error %#v", err)
+	}
+
+	if seen := ss.seen(); seen[1] != "2" {
+		t.Errorf("expected to resume from 2, received %q", seen[1])
+	}
+}
+
+func TestStreamInput_Handle_CancelledMidSend(t *testing.T) {
+	ss := &streamServer{connections: [][]string{
+		{"id: 1\ndata: {\"location\":\"a-table\",\"operation\":\"create\",\"id\":\"a\"}\n\n"},
+	}}
+
+	srv := httptest.NewServer(http.HandlerFunc(ss.sse))
+	defer srv.Close()
+
+	s, err := NewStreamInput(orchestrator.InputConfig{
+		Name:             "test-stream-input",
+		ConnectionString: srv.URL,
+	}, WithBackoff(time.Millisecond, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+
+	// Nothing reads from c, so the event is never sent
+	go func() {
+		errC <- s.Handle(ctx, make(chan orchestrator.Event))
+	}()
+
+	for len(ss.seen()) < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-errC
+
+	if s.lastEventID != "" {
+		t.Errorf("expected to resume from before the unsent event, received %q", s.lastEventID)
+	}
+}
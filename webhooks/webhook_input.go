@@ -3,22 +3,122 @@ package webhooks
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
+	"sort"
+	"sync"
+	"time"
 
 	orchestrator "github.com/dapper-data/dapper-orchestrator"
 )
 
+// EventMapper turns a raw payload, as received by an Input or StreamInput,
+// into an orchestrator.Event
+//
+// Inputs set the Trigger of the resulting Event themselves, and so mappers
+// need not bother
+type EventMapper func([]byte) (orchestrator.Event, error)
+
+// JSONEventMapper is the default EventMapper, and expects to receive a
+// valid orchestrator.Event as JSON
+func JSONEventMapper(b []byte) (e orchestrator.Event, err error) {
+	err = json.Unmarshal(b, &e)
+
+	return
+}
+
+// InputOption configures optional behaviour of an Input or a StreamInput,
+// and of a GRPCInput via WithInputOptions
+type InputOption func(*inputOptions)
+
+type inputOptions struct {
+	mapper      EventMapper
+	mapped      bool
+	schema      Schema
+	auth        Authenticator
+	journal     *Journal
+	logger      *slog.Logger
+	queueLimit  int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	maxLineSize int
+}
+
+func defaultInputOptions(opts []InputOption) (o inputOptions) {
+	o = inputOptions{
+		mapper:      JSONEventMapper,
+		logger:      slog.Default(),
+		queueLimit:  DefaultQueueLimit,
+		minBackoff:  time.Second,
+		maxBackoff:  time.Minute,
+		maxLineSize: DefaultMaxLineSize,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return
+}
+
+// WithEventMapper replaces the JSONEventMapper used to turn payloads into
+// orchestrator.Events, allowing for custom input payloads
+func WithEventMapper(m EventMapper) InputOption {
+	return func(o *inputOptions) {
+		o.mapper = m
+		o.mapped = true
+	}
+}
+
+// WithSchema sets the JSON Schema used to describe the payloads this Input
+// accepts in generated OpenAPI documents; inputs configured with a custom
+// EventMapper should set this, otherwise payloads are documented as being
+// of any type.
+//
+// Payloads are documented as application/json, unless s sets a
+// contentMediaType, such as "application/xml"
+func WithSchema(s Schema) InputOption {
+	return func(o *inputOptions) {
+		o.schema = s
+	}
+}
+
+// WithAuthenticator requires callers of an Input to authenticate, refusing
+// requests which fail with a 401 Unauthorized
+func WithAuthenticator(a Authenticator) InputOption {
+	return func(o *inputOptions) {
+		o.auth = a
+	}
+}
+
+// WithInputLogger sets the logger an Input or StreamInput writes access
+// logs and connection errors to, in place of slog.Default()
+func WithInputLogger(l *slog.Logger) InputOption {
+	return func(o *inputOptions) {
+		o.logger = l
+	}
+}
+
 // Input implements the orchestrator.Input interface
 //
 // It listens to a user specified path (as specified in the InputConfig.ConnectionString
 // argument to NewWebhookInput), and expects to receive a valid orchestrator.Event as
 // JSON
 //
-// For custom input payloads, simply copy the code in github.com/dapper-data/dapper-orchestrator-contrib/webhooks
+// Each request is given a request ID, taken from the X-Request-ID header where
+// callers provide one, which is echoed back to the caller, written to access
+// logs, and propagated onto any webhooks.Process the resulting Event reaches.
+//
+// For custom input payloads, either provide an EventMapper via WithEventMapper,
+// or simply copy the code in github.com/dapper-data/dapper-orchestrator-contrib/webhooks
 // and replace the bits you want to replace
 type Input struct {
-	ic orchestrator.InputConfig
-	c  chan orchestrator.Event
+	ic       orchestrator.InputConfig
+	c        chan orchestrator.Event
+	opts     inputOptions
+	health   *inputHealth
+	register *sync.Once
 }
 
 // NewInput is an orchestrator.NewInputFunc which configures a new
@@ -28,9 +128,25 @@ type Input struct {
 // This Input wont automatically expose an HTTP server; the application this
 // type is embedded in needs to do that- see this package's examples for an
 // example of how this might be done
-func NewInput(ic orchestrator.InputConfig) (wh *Input, err error) {
+//
+// Inputs are registered with this package as they are created, so that they
+// can be described by GenerateOpenAPI and friends, until they are closed
+func NewInput(ic orchestrator.InputConfig, opts ...InputOption) (wh *Input, err error) {
 	wh = new(Input)
 	wh.ic = ic
+	wh.opts = defaultInputOptions(opts)
+	wh.health = new(inputHealth)
+	wh.register = new(sync.Once)
+
+	// Created here, rather than in Handle, so that the handler and any
+	// replays from a Journal never race with Handle starting up
+	wh.c = make(chan orchestrator.Event)
+
+	if wh.opts.journal != nil {
+		wh.opts.journal.register(wh)
+	}
+
+	registerInput(wh)
 
 	return
 }
@@ -40,27 +156,65 @@ func NewInput(ic orchestrator.InputConfig) (wh *Input, err error) {
 // It registers a handler function against the default server provided by the
 // net/http package and listens for Events which are then passed down Event chan `c`
 //
-// This function exits immediately
+// This function blocks until ctx is cancelled, returning ctx.Err(). It may be
+// called again afterwards, such as by a LockedInput from
+// github.com/dapper-data/dapper-orchestrator-contrib/locking-postgres; the
+// handler is only registered the first time, and responds with a 503 to
+// requests received while Handle isn't running
 func (w *Input) Handle(ctx context.Context, c chan orchestrator.Event) (err error) {
-	w.c = make(chan orchestrator.Event)
-	http.HandleFunc(w.ic.ConnectionString, w.handler)
+	w.health.state.Store(stateRunning)
+	defer w.health.state.Store(stateStopped)
+
+	// http.HandleFunc panics when a pattern is registered twice
+	w.register.Do(func() {
+		http.HandleFunc(w.ic.ConnectionString, w.handlerChain())
+	})
 
-	// This allows us to keep this supposedly long running function
-	// running, rather than registering am http.HandleFunc and returning
-	// early- the orchestrator expects a Handle to return on errors only,
-	// and so will bomb out
-	for e := range w.c {
-		c <- e
+	for {
+		select {
+		case e := <-w.c:
+			select {
+			case c <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+}
 
-	return
+// handlerChain wraps handler with whichever access logging and
+// authentication this Input is configured with
+func (w Input) handlerChain() http.HandlerFunc {
+	h := w.handler
+
+	if w.opts.auth != nil {
+		h = requireAuth(w.opts.auth, h)
+	}
+
+	return accessLog(w.opts.logger, w.ID(), h)
 }
 
 func (w Input) handler(wr http.ResponseWriter, req *http.Request) {
 	defer req.Body.Close()
 
-	e := new(orchestrator.Event)
-	err := json.NewDecoder(req.Body).Decode(e)
+	// Events can't be passed on until Handle is called again
+	if w.health.state.Load() == stateStopped {
+		wr.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	b, err := io.ReadAll(req.Body)
+	if err != nil {
+		wr.WriteHeader(http.StatusBadRequest)
+
+		return
+	}
+
+	e, err := w.opts.mapper(b)
 	if err != nil {
 		wr.WriteHeader(http.StatusBadRequest)
 
@@ -69,12 +223,99 @@ func (w Input) handler(wr http.ResponseWriter, req *http.Request) {
 
 	e.Trigger = w.ID()
 
-	w.c <- *e
+	rememberRequestID(e, requestID(req))
 
-	wr.WriteHeader(http.StatusAccepted)
+	w.health.pending.Add(1)
+	defer w.health.pending.Add(-1)
+
+	select {
+	case w.c <- e:
+		// Only deliveries which made it into the pipeline are
+		// journalled, so replays never duplicate refused ones
+		if w.opts.journal != nil {
+			w.opts.journal.record(w.ID(), req, b, e)
+		}
+
+		wr.WriteHeader(http.StatusAccepted)
+
+	case <-req.Context().Done():
+		wr.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// inject pushes an Event into the pipeline as though it had been received
+// by the handler, such as when replaying deliveries from a Journal
+func (w *Input) inject(ctx context.Context, e orchestrator.Event) error {
+	if w.health.state.Load() != stateRunning {
+		return InputNotRunningErr{w.ID()}
+	}
+
+	w.health.pending.Add(1)
+	defer w.health.pending.Add(-1)
+
+	select {
+	case w.c <- e:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close removes this Input from the Inputs described by GenerateOpenAPI,
+// and checked by LivenessHandler and ReadinessHandler, where none are
+// specified, and from those its Journal replays to. Inputs which are no
+// longer in use should be closed
+func (w *Input) Close() {
+	unregisterInput(w)
+
+	if w.opts.journal != nil {
+		w.opts.journal.unregister(w)
+	}
 }
 
 // ID returns an ID for this input
 func (w Input) ID() string {
 	return w.ic.ID()
 }
+
+// inputs holds every Input created by NewInput, keyed by ID
+var inputs = struct {
+	sync.Mutex
+	m map[string]*Input
+}{m: make(map[string]*Input)}
+
+func registerInput(in *Input) {
+	inputs.Lock()
+	defer inputs.Unlock()
+
+	inputs.m[in.ID()] = in
+}
+
+// unregisterInput removes in from the registry, leaving alone any Input
+// which has since been registered under the same ID
+func unregisterInput(in *Input) {
+	inputs.Lock()
+	defer inputs.Unlock()
+
+	if inputs.m[in.ID()] == in {
+		delete(inputs.m, in.ID())
+	}
+}
+
+// registeredInputs returns every Input created by NewInput, sorted by ID
+func registeredInputs() (out []*Input) {
+	inputs.Lock()
+	defer inputs.Unlock()
+
+	out = make([]*Input, 0, len(inputs.m))
+	for _, in := range inputs.m {
+		out = append(out, in)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ID() < out[j].ID()
+	})
+
+	return
+}
@@ -2,6 +2,7 @@ package webhooks
 
 import (
 	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -62,3 +63,66 @@ func TestInput_Handle(t *testing.T) {
 		t.Errorf("expected 2 event(s), recieved %d:\n%#v", len(events), events)
 	}
 }
+
+func TestInput_Handle_Restart(t *testing.T) {
+	wh, err := NewInput(orchestrator.InputConfig{
+		Name:             "restarted-webhook-input",
+		ConnectionString: "/webhooks/restarted-webhook-input/events",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer wh.Close()
+
+	srv := httptest.NewServer(http.DefaultServeMux)
+	defer srv.Close()
+
+	post := func() int {
+		resp, err := http.Post(srv.URL+"/webhooks/restarted-webhook-input/events", "application/json", bytes.NewBufferString(`{"operation":"create"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	// As a LockedInput does, each time it loses and then regains its
+	// lock
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		c := make(chan orchestrator.Event, 1)
+		errs := make(chan error, 1)
+
+		go func() {
+			errs <- wh.Handle(ctx, c)
+		}()
+
+		for wh.health.state.Load() != stateRunning {
+			time.Sleep(time.Millisecond)
+		}
+
+		if status := post(); status != http.StatusAccepted {
+			t.Errorf("%d: expected %d, received %d", i, http.StatusAccepted, status)
+		}
+
+		<-c
+		cancel()
+
+		select {
+		case err := <-errs:
+			if err != context.Canceled {
+				t.Errorf("%d: expected %v, received %v", i, context.Canceled, err)
+			}
+
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d: expected Handle to return once cancelled", i)
+		}
+
+		if status := post(); status != http.StatusServiceUnavailable {
+			t.Errorf("%d: expected %d while stopped, received %d", i, http.StatusServiceUnavailable, status)
+		}
+	}
+}
@@ -4,10 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	orchestrator "github.com/dapper-data/dapper-orchestrator"
+	"github.com/google/uuid"
 )
 
 // Constant ExecutionContext keys used in creating
@@ -29,6 +35,11 @@ const (
 	// an event
 	TargetURLKey = "url"
 
+	// TargetURLsKey may be used alongside, or in place of, TargetURLKey
+	// to send each event to several URLs, separated by commas. See
+	// FanOutPolicyKey for how the outcome of such a Process is decided
+	TargetURLsKey = "urls"
+
 	// MethodKey should point to the http verb/ method used to
 	// hit the endpoint defined under TargetURLKey
 	//
@@ -42,7 +53,7 @@ type MissingWebhookURLErr struct{}
 
 // Error returns the error text for this error
 func (e MissingWebhookURLErr) Error() string {
-	return fmt.Sprintf("error creating webhook: missing %q config value", TargetURLKey)
+	return fmt.Sprintf("error creating webhook: missing %q or %q config value", TargetURLKey, TargetURLsKey)
 }
 
 // BadStatusErr is returned when a call returns a non-2xx response
@@ -53,18 +64,79 @@ func (e BadStatusErr) Error() string {
 	return fmt.Sprintf("error calling webhook: %s returned %q", e.url, e.status)
 }
 
+// ProcessOption configures optional behaviour of a Process which can't
+// be expressed in an ExecutionContext
+type ProcessOption func(*Process)
+
+// WithProcessLogger sets the logger a Process writes delivery logs to, in
+// place of slog.Default()
+func WithProcessLogger(l *slog.Logger) ProcessOption {
+	return func(p *Process) {
+		p.logger = l
+	}
+}
+
+// PayloadFunc renders the body a Process sends for an Event.
+//
+// ctx carries the request ID the Event is sent with, which can be read via
+// RequestIDFromContext
+type PayloadFunc func(ctx context.Context, e orchestrator.Event) ([]byte, error)
+
+// WithPayload sets the function used to render the body a Process sends,
+// in place of encoding the Event as JSON. Bodies are sent with a
+// Content-Type of application/json, and so should be JSON encoded.
+//
+// Rendered bodies are then wrapped and compressed as configured via
+// MultipartThresholdKey and ContentEncodingKey
+func WithPayload(f PayloadFunc) ProcessOption {
+	return func(p *Process) {
+		p.payload = f
+	}
+}
+
 // Process implements the orchestrator.Process interface
 //
 // When triggered, it sends a the orchestrator.Event is was called with
 // as JSON to the endpoint the WebhookProcess was instantiated with via the arguments to
 // orchestrator.ProcessConfig.ExecutionContext, passed as argument 'pc'
 //
+// Each call carries an X-Request-ID header; where the Event arrived via a
+// webhooks.Input this is the request ID of that inbound request, otherwise a
+// new one is generated.
+//
 // For custom process endpoints, simply copy the code in github.com/dapper-data/dapper-orchestrator-contrib/webhooks
 // and replace the bits you want to replace
 type Process struct {
-	pc        orchestrator.ProcessConfig
-	targetURL string
-	method    string
+	pc      orchestrator.ProcessConfig
+	targets []target
+	method  string
+	logger  *slog.Logger
+	client  *http.Client
+	payload PayloadFunc
+
+	cassette *Cassette
+	dryRun   bool
+	encoding encoding
+
+	credentials []Credentials
+	secrets     []string
+	deadLetters DeadLetterStore
+	outbox      Outbox
+
+	fanOutPolicy FanOutPolicy
+	quorum       int
+
+	capture    capture
+	chain      *ChainInput
+	classifier classifier
+}
+
+// target is a single endpoint a Process delivers to, along with the
+// circuit breaker and limiter guarding its host, if any
+type target struct {
+	url     string
+	breaker *CircuitBreaker
+	limiter *HostLimiter
 }
 
 // NewProcess is an orchestrator.NewProcessFunc which configures a new
@@ -77,14 +149,132 @@ type Process struct {
 //	    webhooks.MethodKey:     http.MethodPut,              // defaults to POST
 //	    webhooks.TargetURLKey: "https://example.com/",       // errors if unset or empty
 //	}
-func NewProcess(pc orchestrator.ProcessConfig) (wh Process, err error) {
-	var ok bool
-
+//
+// Events can be sent to several URLs at once by setting TargetURLsKey, with
+// FanOutPolicyKey deciding how many must succeed.
+//
+// The HTTP client used to send requests can be tuned with further keys, such
+// as TimeoutKey, CAFileKey, and ProxyURLKey, or replaced outright with
+// the WithHTTPClient option.
+//
+// Requests can be authenticated with keys such as BasicUsernameKey,
+// BearerTokenFileKey, and OAuth2TokenURLKey, or with the WithCredentials
+// option. Secrets are never written to ProcessStatus.Logs.
+//
+// Failed deliveries can be kept for later redrive with the
+// WithDeadLetterStore option, and receivers which are down can be failed
+// fast by setting BreakerThresholdKey.
+//
+// Responses can be recorded by setting CaptureResponseKey, or chained into
+// new Events with the WithChainInput option
+func NewProcess(pc orchestrator.ProcessConfig, opts ...ProcessOption) (wh Process, err error) {
 	wh.pc = pc
+	wh.logger = slog.Default()
 	wh.method = wh.executionContextOrDefault(MethodKey, http.MethodPost)
-	wh.targetURL, ok = pc.ExecutionContext[TargetURLKey]
-	if !ok {
+	wh.payload = encodeEvent
+
+	urls := targetURLs(pc.ExecutionContext)
+	if len(urls) == 0 {
 		err = MissingWebhookURLErr{}
+
+		return
+	}
+
+	for _, opt := range opts {
+		opt(&wh)
+	}
+
+	if wh.client == nil {
+		wh.client, err = newHTTPClient(pc.ExecutionContext)
+		if err != nil {
+			return
+		}
+	}
+
+	if wh.cassette == nil {
+		wh.cassette, err = cassetteFromConfig(pc.ExecutionContext)
+		if err != nil {
+			return
+		}
+	}
+
+	if wh.cassette != nil {
+		c := *wh.client
+		c.Transport = wh.cassette.transport(c.Transport)
+		wh.client = &c
+	}
+
+	creds, secrets, err := credentialsFromConfig(pc.ExecutionContext, wh.client)
+	if err != nil {
+		return
+	}
+
+	wh.credentials = append(creds, wh.credentials...)
+	wh.secrets = append(secrets, wh.secrets...)
+
+	if wh.cassette != nil {
+		wh.cassette.addSecrets(wh.secrets)
+	}
+
+	wh.targets = make([]target, len(urls))
+	for i, u := range urls {
+		wh.targets[i].url = u
+
+		wh.targets[i].breaker, err = breakerFromConfig(pc.ExecutionContext, u, wh.logger)
+		if err != nil {
+			return
+		}
+
+		wh.targets[i].limiter, err = limiterFromConfig(pc.ExecutionContext, u)
+		if err != nil {
+			return
+		}
+	}
+
+	wh.fanOutPolicy, wh.quorum, err = fanOutFromConfig(pc.ExecutionContext, len(urls))
+	if err != nil {
+		return
+	}
+
+	wh.encoding, err = encodingFromConfig(pc.ExecutionContext)
+	if err != nil {
+		return
+	}
+
+	dryRun, err := dryRunFromConfig(pc.ExecutionContext)
+	if err != nil {
+		return
+	}
+
+	wh.dryRun = wh.dryRun || dryRun
+
+	wh.capture, err = captureFromConfig(pc.ExecutionContext)
+	if err != nil {
+		return
+	}
+
+	// Rules set via WithBodyRules are kept, and follow those configured
+	// in the ExecutionContext
+	rules := wh.classifier.body
+
+	wh.classifier, err = classifierFromConfig(pc.ExecutionContext)
+	wh.classifier.body = append(wh.classifier.body, rules...)
+
+	return
+}
+
+// targetURLs returns the URLs set under TargetURLKey and TargetURLsKey,
+// in that order, with duplicates removed so that each target is sent to,
+// and counted towards a FanOutPolicy, once
+func targetURLs(ec map[string]string) (urls []string) {
+	if u, ok := ec[TargetURLKey]; ok {
+		urls = append(urls, u)
+	}
+
+	for _, u := range strings.Split(ec[TargetURLsKey], ",") {
+		if u = strings.TrimSpace(u); u != "" && !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
 	}
 
 	return
@@ -93,8 +283,26 @@ func NewProcess(pc orchestrator.ProcessConfig) (wh Process, err error) {
 // Run will, given an orchestrator.Event, encode that Event to JSON and send it
 // to the endpoint the WebhookProcess was configured with via the function NewWebhookProcess
 //
-// A non-2xx response will return a webhooks.BadStatusErr which describes status
-// returned.
+// A response which isn't classified as successful will return either a
+// webhooks.RetryableStatusErr or a webhooks.TerminalStatusErr, both of which
+// wrap a webhooks.BadStatusErr describing the status returned. By default
+// only 2xx responses succeed; see SuccessStatusesKey and BodyRulesKey for
+// changing this. A call which isn't made because the circuit breaker for the
+// target host is open will return a webhooks.CircuitOpenErr.
+//
+// Where RateLimitKey or MaxInFlightKey are set, calls wait for their turn
+// before being sent, returning an error wrapping the context's error should
+// ctx be done first.
+//
+// Where a Process has several targets, the Event is sent to each of them
+// concurrently, and a webhooks.FanOutErr is returned when too few succeed
+// to satisfy the configured FanOutPolicy.
+//
+// A Process which is dry running renders each request it would send into
+// the returned logs, and succeeds, without sending anything; see DryRunKey.
+//
+// A Process configured WithOutbox instead queues the Event for each target
+// and returns immediately, leaving delivery to an OutboxWorker.
 //
 // Additionally, the logs field of the returned orchestrator.ProcessStatus will contain
 // errors, warnings, and response metadata (which can be ignored if err == nil)
@@ -103,42 +311,232 @@ func (w Process) Run(ctx context.Context, e orchestrator.Event) (ps orchestrator
 	ps.Status = orchestrator.ProcessUnstarted
 	ps.Logs = make([]string, 0)
 
-	b := new(bytes.Buffer)
-	err = json.NewEncoder(b).Encode(e)
+	id := eventRequestID(ctx, e)
+
+	b, err := w.encode(ctx, e, id)
 	if err != nil {
 		ps.Logs = append(ps.Logs, err.Error())
 
+		if errors.As(err, new(PayloadTooLargeErr)) {
+			// Sending would never succeed, so there's nothing to
+			// retry, but the Event may be redriven once the
+			// limit is raised
+			ps.Status = orchestrator.ProcessFail
+
+			for _, t := range w.targets {
+				d := delivery{target: t.url, err: err}
+				w.deadLetter(ctx, &d, id, e)
+
+				ps.Logs = append(ps.Logs, d.logs...)
+			}
+		}
+
 		return
 	}
 
-	req, err := http.NewRequestWithContext(ctx, w.method, w.targetURL, b)
+	if w.outbox != nil && !w.isDryRun() {
+		return w.enqueue(ctx, ps, e, id)
+	}
+
+	if len(w.targets) > 1 {
+		return w.fanOut(ctx, ps, e, id, b)
+	}
+
+	d := w.deliver(ctx, w.targets[0], e, id, b)
+	ps.Status = d.status
+	ps.Logs = append(ps.Logs, d.logs...)
+
+	return ps, d.err
+}
+
+// ID returns an ID for this process
+func (w Process) ID() string {
+	return w.pc.ID()
+}
+
+// delivery is the outcome of sending an Event to a single target
+type delivery struct {
+	target string
+	code   int
+	status orchestrator.ProcessExitStatus
+	logs   []string
+	err    error
+}
+
+// deliver sends an encoded Event to target t
+func (w Process) deliver(ctx context.Context, t target, e orchestrator.Event, id string, body outgoing) (d delivery) {
+	d.target = t.url
+	d.status = orchestrator.ProcessUnstarted
+
+	if w.cassette != nil {
+		ctx = context.WithValue(ctx, cassettePayloadKey{}, body.payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, w.method, t.url, bytes.NewReader(body.data))
 	if err != nil {
+		d.err = err
+
 		return
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	req.Header.Set(RequestIDHeader, id)
+	req.Header.Set("Content-Type", body.contentType)
+	if body.contentEncoding != "" {
+		req.Header.Set("Content-Encoding", body.contentEncoding)
+	}
+
+	for _, c := range w.credentials {
+		if _, ok := c.(OAuth2Credentials); ok && w.isDryRun() {
+			// Fetching a token would mean a call to the token
+			// endpoint
+			req.Header.Set("Authorization", redacted)
+
+			continue
+		}
+
+		err = c.Apply(req)
+		if err != nil {
+			d.fail(w.redact(err.Error()), err)
+			w.deadLetter(ctx, &d, id, e)
+
+			return
+		}
+	}
+
+	if w.isDryRun() {
+		w.renderRequest(&d, req, body.raw)
+		d.status = orchestrator.ProcessSuccess
+
 		return
 	}
 
-	if resp.StatusCode/100 != 2 {
-		err = BadStatusErr{w.targetURL, resp.Status}
+	if t.breaker != nil {
+		err = t.breaker.allow()
+		if err != nil {
+			d.fail(err.Error(), err)
+			w.deadLetter(ctx, &d, id, e)
+
+			return
+		}
 	}
 
+	if t.limiter != nil {
+		var release func()
+
+		release, err = t.limiter.acquire(ctx)
+		if err != nil {
+			// No call was made, so this says nothing of the
+			// health of the host
+			if t.breaker != nil {
+				t.breaker.record(outcomeIgnored)
+			}
+
+			d.fail(err.Error(), err)
+			w.deadLetter(ctx, &d, id, e)
+
+			return
+		}
+
+		defer release()
+	}
+
+	start := time.Now()
+	resp, err := w.client.Do(req)
+	if err != nil {
+		t.recordOutcome(ctx, err)
+
+		d.err = redactURLErr(err)
+		w.logDelivery(ctx, t.url, id, start, 0, err)
+		w.deadLetter(ctx, &d, id, e)
+
+		return
+	}
+
+	defer drain(resp.Body)
+
+	d.code = resp.StatusCode
+
+	respBody, truncated := w.readResponse(&d, resp)
+
+	err = w.classifier.classify(t.url, resp, respBody)
+	t.recordOutcome(ctx, err)
+
+	w.logDelivery(ctx, t.url, id, start, resp.StatusCode, err)
+
 	switch err {
 	case nil:
-		ps.Status = orchestrator.ProcessSuccess
+		d.status = orchestrator.ProcessSuccess
 	default:
-		ps.Logs = append(ps.Logs, err.Error())
-		ps.Status = orchestrator.ProcessFail
+		d.fail(w.redact(err.Error()), err)
+		w.deadLetter(ctx, &d, id, e)
 	}
 
+	w.handleResponse(ctx, &d, id, resp, respBody, truncated)
+
 	return
 }
 
-// ID returns an ID for this process
-func (w Process) ID() string {
-	return w.pc.ID()
+// encodeEvent is the default PayloadFunc, sending the Event itself as
+// JSON
+func encodeEvent(_ context.Context, e orchestrator.Event) ([]byte, error) {
+	b := new(bytes.Buffer)
+	err := json.NewEncoder(b).Encode(e)
+
+	return b.Bytes(), err
+}
+
+// fail marks a delivery as failed with error err, logging msg
+func (d *delivery) fail(msg string, err error) {
+	d.logs = append(d.logs, msg)
+	d.status = orchestrator.ProcessFail
+	d.err = err
+}
+
+func (w Process) logDelivery(ctx context.Context, url, id string, start time.Time, status int, err error) {
+	attrs := []slog.Attr{
+		slog.String("request_id", id),
+		slog.String("process", w.ID()),
+		slog.String("method", w.method),
+		slog.String("url", redactURL(url)),
+		slog.Int("status", status),
+		slog.Duration("latency", time.Since(start)),
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", w.redact(err.Error())))
+	}
+
+	w.logger.LogAttrs(ctx, level, "webhook delivery", attrs...)
+}
+
+// deadLetter records a failed delivery into the DeadLetterStore this
+// Process was configured with, if any. Failing to do so is noted in the
+// logs of d, but doesn't otherwise change its outcome
+func (w Process) deadLetter(ctx context.Context, d *delivery, id string, e orchestrator.Event) {
+	if w.deadLetters == nil {
+		return
+	}
+
+	// The delivery may have failed because ctx was cancelled, which
+	// shouldn't stop it being recorded
+	ctx = context.WithoutCancel(ctx)
+
+	err := w.deadLetters.Put(ctx, DeadLetter{
+		ID:        uuid.NewString(),
+		RequestID: id,
+		Process:   w.ID(),
+		Method:    w.method,
+		Target:    d.target,
+		Event:     e,
+		FailedAt:  time.Now(),
+		Status:    d.code,
+		Error:     w.redact(d.err.Error()),
+	})
+	if err != nil {
+		d.logs = append(d.logs, fmt.Sprintf("error writing dead letter: %v", err))
+	}
 }
 
 func (w Process) executionContextOrDefault(key, def string) string {
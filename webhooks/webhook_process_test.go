@@ -31,7 +31,7 @@ func TestNewProcess(t *testing.T) {
 			}
 
 			if err != nil && test.expectError != nil {
-				err.Error() // does nothing but increase codecoverage /shrug
+				_ = err.Error() // does nothing but increase codecoverage /shrug
 
 				if !errors.Is(err, test.expectError) {
 					t.Errorf("expected error of type %T, received %T", test.expectError, err)
@@ -82,8 +82,8 @@ func TestProcess_Run(t *testing.T) {
 		{"webhook returns 203, no error", "https://httpbin.org/status/203", successPS, nil},
 		{"webhook returns 204, no error", "https://httpbin.org/status/204", successPS, nil},
 
-		{"webhook returns 404, errors", "https://httpbin.org/status/404", status404PS, BadStatusErr{}},
-		{"webhook returns 503, errors", "https://httpbin.org/status/503", status503PS, BadStatusErr{}},
+		{"webhook returns 404, errors", "https://httpbin.org/status/404", status404PS, TerminalStatusErr{}},
+		{"webhook returns 503, errors", "https://httpbin.org/status/503", status503PS, RetryableStatusErr{}},
 
 		{"malformed url", "this is a malformed address", unstartedPS, new(url.Error)},
 		{"non-existent url", "https://webhooks.test/webhook", unstartedPS, new(url.Error)},
@@ -113,7 +113,7 @@ func TestProcess_Run(t *testing.T) {
 			}
 
 			if err != nil && test.expectError != nil {
-				err.Error() // does nothing but increase codecoverage /shrug
+				_ = err.Error() // does nothing but increase codecoverage /shrug
 
 				expectType := fmt.Sprintf("%T", test.expectError)
 				receivedType := fmt.Sprintf("%T", err)
@@ -9,7 +9,7 @@ import (
 	"github.com/dapper-data/dapper-orchestrator-contrib/webhooks"
 )
 
-func ExampleWebhookInputAndProcess() {
+func Example() {
 	// Create a WebhookInput listening on the path /webhooks/test-webhook-input/events
 	wh, err := webhooks.NewInput(orchestrator.InputConfig{
 		Name:             "test-webhook-input",